@@ -4,8 +4,8 @@ import (
   "io"
   "os"
   "fmt"
+  "bytes"
   "image"
-  "regexp"
   "strings"
   "io/ioutil"
   "path/filepath"
@@ -21,6 +21,14 @@ type AlbumArt struct {
   Fullpath string
   WithParentDir bool
   Source string
+  // size, quality & format policy; DefaultOptions if nil
+  Options *Options
+  // queried when no embedded or path artwork is found
+  Covers CoverProvider
+  Query *CoverQuery
+  // rendered when no artwork is found or fetched
+  Placeholder *Placeholder
+  PlaceholderText *PlaceholderText
   Ffmpeg interface {
     OptimizeAlbumArt(s, d string) (string, error)
     Exec(args ...string) (string, error)
@@ -44,19 +52,29 @@ func Process(a *AlbumArt) (string, error) {
 
   // TODO: if folder.jpg, use (do not compress) as is (skip embedded)
 
-  // probe to determine if has embedded artwork
-  _, err = os.Stat(a.Fullpath)
-  if err == nil {
-    _, err = a.Ffprobe.GetData(a.Fullpath)
-    if err != nil {
-      return "", err
+  // read embedded artwork directly, otherwise probe with ffprobe
+  w, h, has := 0, 0, false
+  pic, _ := ExtractPicture(a.Fullpath)
+  if pic != nil {
+    has = true
+    c, _, err := a.decodeConfig()(bytes.NewReader(pic))
+    if err == nil {
+      w, h = c.Width, c.Height
     }
+  } else if a.Ffprobe != nil {
+    _, err = os.Stat(a.Fullpath)
+    if err == nil {
+      _, err = a.Ffprobe.GetData(a.Fullpath)
+      if err != nil {
+        return "", err
+      }
+    }
+    w, h, has = a.Ffprobe.EmbeddedImage()
   }
 
   // if file has embedded artwork, extract & optimize
-  w, h, has := a.Ffprobe.EmbeddedImage()
   if has {
-    err = a.embedded(w, h)
+    err = a.embedded(w, h, pic)
     if err != nil {
       fmt.Printf("\nNo embedded artwork found.\n")
     }
@@ -75,33 +93,77 @@ func Process(a *AlbumArt) (string, error) {
     if err != nil {
       return a.Source, err
     }
+    a.TempDir = td
+  }
+
+  // fetch from cover provider (if nothing local found)
+  if a.Covers != nil && a.Query != nil && len(a.Source) == 0 {
+    err = a.fromCovers()
+    if err != nil {
+      fmt.Printf("\nCover not fetched: %v\n", err)
+    }
+  }
+
+  // render placeholder cover (if nothing else found)
+  if a.Placeholder != nil && a.PlaceholderText != nil && len(a.Source) == 0 {
+    // render at configured size
+    ph := *a.Placeholder
+    ph.Size = a.options().MaxSize
+
+    src := filepath.Join(a.TempDir, "placeholder.jpg")
+    err = ph.WriteJpeg(src, a.PlaceholderText)
+    if err != nil {
+      return a.Source, err
+    }
+
+    err = a.copyAsFolderJpg(src)
+    if err != nil {
+      return a.Source, err
+    }
   }
 
   return a.Source, nil
 }
 
-// extract & optimize embedded artwork
-func (a *AlbumArt) embedded(width, height int) error {
-  // extract image with ffmpeg
+// extract & optimize embedded artwork; pic is image data read directly from
+// file, otherwise extracted with ffmpeg
+func (a *AlbumArt) embedded(width, height int, pic []byte) error {
   src := filepath.Join(a.TempDir, "embedded-orig.jpg")
-  _, err := a.Ffmpeg.Exec([]string{ "-y", "-i", a.Fullpath, src }...)
+
+  var err error
+  convert := false
+  if pic != nil {
+    err = ioutil.WriteFile(src, pic, 0644)
+
+    // re-encode non JPEG (ie PNG) pictures since saved as folder.jpg
+    _, format, _ := a.decodeConfig()(bytes.NewReader(pic))
+    convert = format != "jpeg"
+  } else if a.Ffmpeg != nil {
+    _, err = a.Ffmpeg.Exec([]string{ "-y", "-i", a.Fullpath, src }...)
+  } else {
+    err = fmt.Errorf("No embedded artwork found: %s", a.Fullpath)
+  }
   if err != nil {
     return err
   }
 
-  if width > 501 {
+  resize := a.options().resize(width, height)
+  if resize || convert {
     // optimize image
     opt := filepath.Join(a.TempDir, "embedded.jpg")
-    _, err = a.Ffmpeg.OptimizeAlbumArt(src, opt)
+    err = a.optimizeImage(src, opt, resize)
     if err != nil {
       return err
     }
 
-    // use the smallest size
-    r, _ := fsutil.NthFileSize([]string{src, opt}, true)
+    // use the smallest size (unless converted to JPEG)
+    r := opt
+    if !convert {
+      r, _ = fsutil.NthFileSize([]string{src, opt}, true)
+    }
 
     // if optimized is smaller, copy original to folder-orig.jpg if larger
-    if r == opt {
+    if r == opt && !convert {
       err = a.copyAsFolderOrigJpg(src)
       if err != nil {
         return err
@@ -111,6 +173,11 @@ func (a *AlbumArt) embedded(width, height int) error {
     src = r
   }
 
+  src, err = a.finalize(src)
+  if err != nil {
+    return err
+  }
+
   err = a.copyAsFolderJpg(src)
   if err != nil {
     return err
@@ -119,58 +186,92 @@ func (a *AlbumArt) embedded(width, height int) error {
   return nil
 }
 
-// iterate to find best image, then optimize
+// iterate to find best image, then optimize; folder.jpg takes precedence,
+// then front image, then largest image without a role (ie not back or disc)
 func (a *AlbumArt) fromPath() error {
-  // specific names that take precedence over file size
-  matches := []string{
-    `^(?i)folder\.jpg$`,
-  }
-
   found := ""
-  imgs := []string{}
   fd := filepath.Dir(a.Fullpath)
-  images := fsutil.FilesImage(fd)
-
-  // break if find specific match
-  for i := range images {
-    imgs = append(imgs, filepath.Join(fd, images[i]))
-    for x := range matches {
-      if regexp.MustCompile(matches[x]).MatchString(images[i]) {
-        found = imgs[i]
-        break
-      }
+  images := Classify(fd, a.decodeConfig())
+
+  others := []string{}
+  for _, img := range images {
+    if strings.EqualFold(img.Path, filepath.Join(fd, "folder.jpg")) {
+      found = img.Path
+      break
+    }
+    if img.Role == RoleOther {
+      others = append(others, img.Path)
     }
   }
 
-  // if didn't find specific, try largest file size
-  if len(imgs) > 0 && len(found) == 0 {
-    found, _ = fsutil.NthFileSize(imgs, false)
+  if len(found) == 0 {
+    if img := FrontImage(images); img != nil {
+      found = img.Path
+    }
+  }
+
+  // if didn't find front, try largest file size
+  if len(others) > 0 && len(found) == 0 {
+    found, _ = fsutil.NthFileSize(others, false)
   }
   if len(found) == 0 {
     return nil
   }
 
+  return a.optimize(found)
+}
+
+// fetch cover from provider, then optimize
+func (a *AlbumArt) fromCovers() error {
+  b, err := a.Covers.Cover(a.Query)
+  if err != nil || b == nil {
+    return err
+  }
+
+  found := filepath.Join(a.TempDir, "cover.jpg")
+  err = ioutil.WriteFile(found, b, 0644)
+  if err != nil {
+    return err
+  }
+
+  return a.optimize(found)
+}
+
+// optimize image (if necessary) & copy as folder.jpg
+func (a *AlbumArt) optimize(found string) error {
   // open image file and determine width/height
   file, err := os.Open(found)
   if err != nil {
     return err
   }
-  img, _, err := a.ImgDecode(file)
+  img, format, err := a.decodeConfig()(file)
+  file.Close()
   if err != nil {
     return err
   }
 
-  // only optimize if width > 501
-  if img.Width > 501 {
+  // re-encode non JPEG (ie PNG) images since saved as folder.jpg
+  resize := a.options().resize(img.Width, img.Height)
+  convert := format != "jpeg"
+  if resize || convert {
     // optimize through ffmpeg
     opt := filepath.Join(a.TempDir, "path.jpg")
-    _, err := a.Ffmpeg.OptimizeAlbumArt(found, opt)
+    err = a.optimizeImage(found, opt, resize)
     if err != nil {
       return err
     }
 
-    // use smallest size
-    found, _ = fsutil.NthFileSize([]string{found, opt}, true)
+    // use smallest size (unless converted to JPEG)
+    if !convert {
+      found, _ = fsutil.NthFileSize([]string{found, opt}, true)
+    } else {
+      found = opt
+    }
+  }
+
+  found, err = a.finalize(found)
+  if err != nil {
+    return err
   }
 
   err = a.copyAsFolderJpg(found)
@@ -181,6 +282,47 @@ func (a *AlbumArt) fromPath() error {
   return nil
 }
 
+func (a *AlbumArt) options() *Options {
+  if a.Options == nil {
+    return DefaultOptions()
+  }
+  return a.Options
+}
+
+// resize (if necessary) & encode src as jpeg dst; ffmpeg fallback with
+// default options uses ffmpeg.OptimizeAlbumArt
+func (a *AlbumArt) optimizeImage(src, dst string, resize bool) error {
+  o := a.options()
+
+  // pure Go, falling back to ffmpeg (ie unsupported image format)
+  err := o.convert(src, dst, resize)
+  if err == nil || a.Ffmpeg == nil {
+    return err
+  }
+
+  if *o == *DefaultOptions() && resize {
+    _, err = a.Ffmpeg.OptimizeAlbumArt(src, dst)
+    return err
+  }
+
+  _, err = a.Ffmpeg.Exec(o.ffmpegArgs(src, dst, resize)...)
+  if err != nil {
+    return err
+  }
+  if _, err = os.Stat(dst); err != nil {
+    return fmt.Errorf("Artwork not optimized: %s", src)
+  }
+  return nil
+}
+
+// convert to progressive jpeg (if specified)
+func (a *AlbumArt) finalize(src string) (string, error) {
+  if !a.options().Progressive {
+    return src, nil
+  }
+  return progressive(src, filepath.Join(a.TempDir, "progressive.jpg"))
+}
+
 // if parent folder does not contain audio files, copy any images files
 // TODO: tests
 func (a *AlbumArt) processParentFolderArtwork() (string, error) {
@@ -222,6 +364,10 @@ func (a *AlbumArt) processParentFolderArtwork() (string, error) {
 
 // copy src to folder-orig.jpg if larger
 func (a *AlbumArt) copyAsFolderOrigJpg(src string) error {
+  if !a.options().KeepOriginal {
+    return nil
+  }
+
   orig := filepath.Join(filepath.Dir(a.Fullpath), "folder-orig.jpg")
   if fsutil.IsLarger(src, orig) {
     err := fsutil.CopyFile(src, orig)
@@ -3,10 +3,15 @@ package albumart
 import (
   "io"
   "os"
+  "bytes"
   "image"
+  "strings"
   "testing"
+  "net/http"
   "io/ioutil"
   "path/filepath"
+  "image/png"
+  "net/http/httptest"
 
   "github.com/jamlib/libaudio/ffmpeg"
   "github.com/jamlib/libaudio/ffprobe"
@@ -110,7 +115,7 @@ func TestArtworkEmbedded(t *testing.T) {
       testArtworkFiles(t, tests[i].files, func(dir string) {
         a.Fullpath = filepath.Join(dir, "1-1 Title.mp3")
 
-        err := a.embedded(tests[i].width, 1)
+        err := a.embedded(tests[i].width, 1, nil)
         if err != nil {
           t.Fatal(err)
         }
@@ -147,7 +152,7 @@ func TestArtworkFromPath(t *testing.T) {
     for i := range tests {
       imageDecode := func (r io.Reader) (image.Config, string, error) {
         c := image.Config{ Width: tests[i].width }
-        return c, "", nil
+        return c, "jpeg", nil
       }
 
       a := &AlbumArt{ Ffmpeg: &ffmpeg.MockFfmpeg{}, TempDir: td, ImgDecode: imageDecode }
@@ -216,3 +221,416 @@ func TestArtworkCopyAsFolderJpg(t *testing.T) {
     })
   })
 }
+
+func TestCoverProviders(t *testing.T) {
+  ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+    r *http.Request) {
+
+    if r.URL.Path != "/release/mbid-1/front" {
+      http.NotFound(w, r)
+      return
+    }
+    w.Write([]byte("front"))
+  }))
+  defer ts.Close()
+
+  testArtworkFiles(t, map[string]string{
+    "local/Artist - Album.jpg": "local",
+  }, func(dir string) {
+    cacheDir := filepath.Join(dir, "cache")
+    p := NewCoverProvider(ts.URL, cacheDir)
+    p.(*CoverCache).Provider.(*CoverArtArchive).Search =
+      func(artist, album string) (string, error) {
+        if album == "Album" {
+          return "mbid-1", nil
+        }
+        return "", nil
+      }
+
+    tests := []struct {
+      q *CoverQuery
+      result string
+    }{
+      { q: &CoverQuery{ MBID: "mbid-1" }, result: "front" },
+      { q: &CoverQuery{ MBID: "mbid-2" }, result: "" },
+      { q: &CoverQuery{ Artist: "Artist", Album: "Album" }, result: "front" },
+      { q: &CoverQuery{ Artist: "Artist", Album: "Other" }, result: "" },
+    }
+
+    for i := range tests {
+      b, err := p.Cover(tests[i].q)
+      if err != nil {
+        t.Fatal(err)
+      }
+      if string(b) != tests[i].result {
+        t.Errorf("Expected %v, got %v", tests[i].result, string(b))
+      }
+    }
+
+    // fetched covers are cached by MBID or artist & album
+    for _, k := range []string{ "mbid-1.jpg", "Artist - Album.jpg" } {
+      b, _ := ioutil.ReadFile(filepath.Join(cacheDir, k))
+      if string(b) != "front" {
+        t.Errorf("Expected cached %v, got %v", k, string(b))
+      }
+    }
+
+    // local folder of covers
+    b, _ := NewCoverProvider(filepath.Join(dir, "local"), "").Cover(
+      &CoverQuery{ Artist: "Artist", Album: "Album" })
+    if string(b) != "local" {
+      t.Errorf("Expected %v, got %v", "local", string(b))
+    }
+  })
+}
+
+func TestArtworkFromCovers(t *testing.T) {
+  testArtwork(t, func(td, f, fo string) {
+    imageDecode := func (r io.Reader) (image.Config, string, error) {
+      return image.Config{ Width: 500 }, "jpeg", nil
+    }
+
+    testArtworkFiles(t, map[string]string{
+      "covers/Artist - Album.jpg": "cover",
+    }, func(dir string) {
+      a := &AlbumArt{ Ffmpeg: &ffmpeg.MockFfmpeg{}, TempDir: td,
+        ImgDecode: imageDecode, Fullpath: filepath.Join(dir, "1-1 Title.mp3"),
+        Covers: NewCoverProvider(filepath.Join(dir, "covers"), ""),
+        Query: &CoverQuery{ Artist: "Artist", Album: "Album" } }
+
+      err := a.fromCovers()
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      b, _ := ioutil.ReadFile(filepath.Join(dir, f))
+      if string(b) != "cover" {
+        t.Errorf("Expected %v, got %v", "cover", string(b))
+      }
+    })
+  })
+}
+
+func TestPlaceholder(t *testing.T) {
+  p := NewPlaceholder()
+  text := &PlaceholderText{ Artist: "Grateful Dead", Year: "1977", Month: "05",
+    Day: "08", Venue: "Barton Hall, Cornell University, Ithaca, NY" }
+
+  lines := p.Lines(text)
+  results := []string{ "Grateful Dead", "1977.05.08", "Barton Hall, Cornell",
+    "University, Ithaca,", "NY" }
+  if strings.Join(lines, "|") != strings.Join(results, "|") {
+    t.Errorf("Expected %v, got %v", results, lines)
+  }
+
+  // unicode transliterated to glyphs within font5x7
+  lines = p.Lines(&PlaceholderText{ Artist: "Sigur Rós", Venue: "Café Nobbë" })
+  results = []string{ "Sigur Ros", "..", "Cafe Nobbe" }
+  if strings.Join(lines, "|") != strings.Join(results, "|") {
+    t.Errorf("Expected %v, got %v", results, lines)
+  }
+
+  testArtworkFiles(t, map[string]string{
+    "colors.txt": "grateful dead = #102030, #f0e0d0\n",
+  }, func(dir string) {
+    err := p.ReadColors(filepath.Join(dir, "colors.txt"))
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    img := p.Render(text)
+    if img.Bounds().Dx() != 500 || img.RGBAAt(0, 0) != p.Colors["grateful dead"].Background {
+      t.Errorf("Expected 500px with configured background, got %v %v",
+        img.Bounds().Dx(), img.RGBAAt(0, 0))
+    }
+
+    // foreground drawn somewhere within image
+    found := false
+    for y := 0; y < 500 && !found; y++ {
+      for x := 0; x < 500; x++ {
+        if img.RGBAAt(x, y) == p.Colors["grateful dead"].Foreground {
+          found = true
+          break
+        }
+      }
+    }
+    if !found {
+      t.Errorf("Expected text drawn in foreground color")
+    }
+  })
+
+  // colors derived from artist are consistent
+  if *p.ArtistColors("Phish") != *p.ArtistColors("phish") {
+    t.Errorf("Expected consistent artist colors")
+  }
+
+  if _, err := ParseColor("#12345"); err == nil {
+    t.Errorf("Expected invalid color error")
+  }
+}
+
+func TestArtworkPlaceholder(t *testing.T) {
+  testArtworkFiles(t, map[string]string{ "1-1 Title.mp3": "{}" }, func(dir string) {
+    a := &AlbumArt{ Ffmpeg: &ffmpeg.MockFfmpeg{}, Ffprobe: &ffprobe.MockFfprobe{},
+      Fullpath: filepath.Join(dir, "1-1 Title.mp3"),
+      Placeholder: NewPlaceholder(),
+      PlaceholderText: &PlaceholderText{ Artist: "Phish", Year: "2003" } }
+
+    src, err := Process(a)
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    f, err := os.Open(src)
+    if err != nil {
+      t.Fatal(err)
+    }
+    defer f.Close()
+
+    c, format, err := image.DecodeConfig(f)
+    if err != nil || format != "jpeg" || c.Width != 500 {
+      t.Errorf("Expected 500px jpeg, got %v %v %v", format, c.Width, err)
+    }
+  })
+}
+
+func TestImageRole(t *testing.T) {
+  tests := []struct {
+    file string
+    width, height int
+    role Role
+  }{
+    { file: "Front.jpg", role: RoleFront },
+    { file: "cover.png", role: RoleFront },
+    { file: "Cover Back.jpg", role: RoleBack },
+    { file: "cd1.jpg", role: RoleDisc },
+    { file: "discogs.jpg", role: RoleOther },
+    { file: "inlay.jpg", role: RoleInlay },
+    { file: "booklet-02.jpg", role: RoleBooklet },
+    { file: "page3.jpg", role: RoleBooklet },
+    { file: "bookmarks.jpg", role: RoleOther },
+    { file: "insertion.jpg", role: RoleOther },
+    { file: "scan.jpg", width: 600, height: 600, role: RoleFront },
+    { file: "scan.jpg", width: 1400, height: 1200, role: RoleBack },
+    { file: "scan.jpg", width: 600, height: 900, role: RoleBooklet },
+  }
+
+  for _, x := range tests {
+    r := ImageRole(x.file, x.width, x.height)
+    if r != x.role {
+      t.Errorf("Expected %v for %v, got %v", x.role, x.file, r)
+    }
+  }
+
+  if RoleDisc.PictureType() != 6 || RoleInlay.PictureType() != 0 {
+    t.Errorf("Expected picture types 6 & 0")
+  }
+}
+
+func TestArtworkFromPathRoles(t *testing.T) {
+  testArtwork(t, func(td, f, fo string) {
+    tests := []struct {
+      files map[string]string
+      result string
+    }{
+      { files: map[string]string{ "back.jpg": "bbbbbbbb", "cd.jpg": "cccccccc",
+          "front.jpg": "ff" },
+        result: "ff",
+      },{
+        files: map[string]string{ "back.jpg": "bbbbbbbb", "scan.jpg": "ss" },
+        result: "ss",
+      },{
+        files: map[string]string{ "back.jpg": "bbbbbbbb" },
+        result: "",
+      },
+    }
+
+    imageDecode := func (r io.Reader) (image.Config, string, error) {
+      return image.Config{}, "jpeg", nil
+    }
+
+    for i := range tests {
+      a := &AlbumArt{ Ffmpeg: &ffmpeg.MockFfmpeg{}, TempDir: td, ImgDecode: imageDecode }
+
+      testArtworkFiles(t, tests[i].files, func(dir string) {
+        a.Fullpath = filepath.Join(dir, "1-1 Title.mp3")
+
+        err := a.fromPath()
+        if err != nil {
+          t.Fatal(err)
+        }
+
+        b, _ := ioutil.ReadFile(filepath.Join(dir, f))
+        if string(b) != tests[i].result {
+          t.Errorf("Expected %v, got %v", tests[i].result, string(b))
+        }
+      })
+    }
+  })
+}
+
+// records Exec args, writing output (last arg) when optimizing
+type testOptimizeFfmpeg struct {
+  ffmpeg.MockFfmpeg
+  args []string
+}
+
+func (f *testOptimizeFfmpeg) Exec(args ...string) (string, error) {
+  f.args = args
+  return "", ioutil.WriteFile(args[len(args)-1], []byte("opt"), 0644)
+}
+
+func TestParseOptions(t *testing.T) {
+  o, err := ParseOptions("size=300, quality=85, baseline, no-orig")
+  if err != nil {
+    t.Fatal(err)
+  }
+  r := Options{ MaxSize: 300, Quality: 85 }
+  if *o != r {
+    t.Errorf("Expected %+v, got %+v", r, *o)
+  }
+  if o.qscale() != 6 {
+    t.Errorf("Expected qscale %v, got %v", 6, o.qscale())
+  }
+
+  for _, spec := range []string{ "size=0", "quality=101", "huge", "png" } {
+    if _, err := ParseOptions(spec); err == nil {
+      t.Errorf("Expected error for %v", spec)
+    }
+  }
+}
+
+func TestArtworkOptions(t *testing.T) {
+  testArtwork(t, func(td, f, fo string) {
+    tests := []struct {
+      spec, format string
+      width, height int
+      args string
+      results map[string]string
+    }{
+      { spec: "size=300,quality=85,no-orig", format: "jpeg", width: 400,
+        height: 400,
+        args: "-y -qscale:v 6 -vf scale=w=300:h=300:force_original_aspect_ratio=decrease",
+        results: map[string]string{ f: "opt", fo: "a" },
+      },{
+        // PNG always re-encoded as folder.jpg
+        spec: "size=1200", format: "png", width: 1000, height: 1000,
+        args: "-y -qscale:v 2",
+        results: map[string]string{ f: "opt", fo: "a" },
+      },{
+        spec: "size=1200", format: "jpeg", width: 1000, height: 1000,
+        results: map[string]string{ f: "largeimage", fo: "a" },
+      },
+    }
+
+    for i := range tests {
+      o, _ := ParseOptions(tests[i].spec)
+      ff := &testOptimizeFfmpeg{}
+      imageDecode := func (r io.Reader) (image.Config, string, error) {
+        c := image.Config{ Width: tests[i].width, Height: tests[i].height }
+        return c, tests[i].format, nil
+      }
+
+      a := &AlbumArt{ Ffmpeg: ff, TempDir: td, ImgDecode: imageDecode,
+        Options: o }
+
+      testArtworkFiles(t, map[string]string{ "cover.png": "largeimage",
+        fo: "a" }, func(dir string) {
+
+        a.Fullpath = filepath.Join(dir, "1-1 Title.mp3")
+        err := a.fromPath()
+        if err != nil {
+          t.Fatal(err)
+        }
+
+        if len(tests[i].args) > 0 {
+          args := strings.Join(ff.args[2:len(ff.args)-1], " ")
+          if args != tests[i].args {
+            t.Errorf("Expected %v, got %v", tests[i].args, args)
+          }
+        }
+
+        for k, v := range tests[i].results {
+          b, _ := ioutil.ReadFile(filepath.Join(dir, k))
+          if string(b) != v {
+            t.Errorf("Expected %v, got %v", v, string(b))
+          }
+        }
+      })
+    }
+
+    // folder-orig.jpg not written (if no-orig)
+    testArtworkFiles(t, map[string]string{ "cover.jpg": "abc" }, func(dir string) {
+      a := &AlbumArt{ Fullpath: filepath.Join(dir, "1-1 Title.mp3"),
+        Options: &Options{ MaxSize: 500 } }
+      err := a.copyAsFolderOrigJpg(filepath.Join(dir, "cover.jpg"))
+      if err != nil {
+        t.Fatal(err)
+      }
+      if _, err := os.Stat(filepath.Join(dir, fo)); err == nil {
+        t.Errorf("Expected no %v", fo)
+      }
+    })
+  })
+}
+
+func TestArtworkNative(t *testing.T) {
+  // 800x600 PNG embedded as FLAC front cover
+  img := image.NewRGBA(image.Rect(0, 0, 800, 600))
+  var buf bytes.Buffer
+  png.Encode(&buf, img)
+
+  pic := []byte{}
+  for _, v := range []int{ 3, 9 } {
+    pic = append(pic, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v))
+  }
+  pic = append(pic, "image/png"...)
+  for _, v := range []int{ 0, 800, 600, 24, 0, buf.Len() } {
+    pic = append(pic, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v))
+  }
+  pic = append(pic, buf.Bytes()...)
+
+  data := append([]byte("fLaC"), 0x80 | 6, byte(len(pic) >> 16),
+    byte(len(pic) >> 8), byte(len(pic)))
+  data = append(data, pic...)
+
+  testArtworkFiles(t, map[string]string{ "1-1 Title.flac": string(data) },
+    func(dir string) {
+
+    // no ffmpeg or ffprobe
+    a := &AlbumArt{ Fullpath: filepath.Join(dir, "1-1 Title.flac") }
+    src, err := Process(a)
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    f, err := os.Open(src)
+    if err != nil {
+      t.Fatal(err)
+    }
+    defer f.Close()
+
+    c, format, err := image.DecodeConfig(f)
+    if err != nil || format != "jpeg" || c.Width != 500 || c.Height != 375 {
+      t.Errorf("Expected 500x375 jpeg, got %v %vx%v %v", format, c.Width,
+        c.Height, err)
+    }
+  })
+}
+
+func TestResize(t *testing.T) {
+  tests := []struct {
+    w, h, max, rw, rh int
+  }{
+    { w: 1000, h: 500, max: 300, rw: 300, rh: 150 },
+    { w: 400, h: 1200, max: 300, rw: 100, rh: 300 },
+    { w: 200, h: 200, max: 300, rw: 200, rh: 200 },
+  }
+
+  for _, x := range tests {
+    r := Resize(image.NewRGBA(image.Rect(0, 0, x.w, x.h)), x.max).Bounds()
+    if r.Dx() != x.rw || r.Dy() != x.rh {
+      t.Errorf("Expected %vx%v, got %vx%v", x.rw, x.rh, r.Dx(), r.Dy())
+    }
+  }
+}
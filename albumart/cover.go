@@ -0,0 +1,131 @@
+package albumart
+
+import (
+  "os"
+  "fmt"
+  "regexp"
+  "strings"
+  "net/url"
+  "net/http"
+  "io/ioutil"
+  "path/filepath"
+)
+
+// identifies album when querying a cover provider
+type CoverQuery struct {
+  Artist, Album string
+  // MusicBrainz release id
+  MBID string
+}
+
+// provides front cover image data for an album; returns nil data (and nil
+// error) when no cover exists
+type CoverProvider interface {
+  Cover(q *CoverQuery) ([]byte, error)
+}
+
+// returns http provider if source is url, otherwise folder of cover images;
+// when cacheDir is provided, covers are cached within as they are fetched
+func NewCoverProvider(source, cacheDir string) CoverProvider {
+  var p CoverProvider
+  if strings.HasPrefix(source, "http://") ||
+    strings.HasPrefix(source, "https://") {
+    p = &CoverArtArchive{ BaseURL: strings.TrimSuffix(source, "/"),
+      Client: http.DefaultClient }
+  } else if len(source) > 0 {
+    p = &CoverCache{ Dir: source }
+  }
+
+  if len(cacheDir) > 0 {
+    return &CoverCache{ Dir: cacheDir, Provider: p }
+  }
+  return p
+}
+
+// folder of cover images named by release id (ie "{MBID}.jpg") or by artist
+// and album (ie "Artist - Album.jpg"); if Provider is set, covers not found
+// within Dir are fetched & saved within Dir
+type CoverCache struct {
+  Dir string
+  Provider CoverProvider
+}
+
+func (c *CoverCache) Cover(q *CoverQuery) ([]byte, error) {
+  keys := coverKeys(q)
+  for _, k := range keys {
+    b, err := ioutil.ReadFile(filepath.Join(c.Dir, k + ".jpg"))
+    if err == nil {
+      return b, nil
+    }
+  }
+
+  if c.Provider == nil || len(keys) == 0 {
+    return nil, nil
+  }
+
+  b, err := c.Provider.Cover(q)
+  if err != nil || b == nil {
+    return b, err
+  }
+
+  err = os.MkdirAll(c.Dir, 0777)
+  if err != nil {
+    return b, err
+  }
+  return b, ioutil.WriteFile(filepath.Join(c.Dir, keys[0] + ".jpg"), b, 0644)
+}
+
+// cache file names (without extension) in order of precedence
+func coverKeys(q *CoverQuery) []string {
+  keys := []string{}
+  if len(q.MBID) > 0 {
+    keys = append(keys, safeKey(q.MBID))
+  }
+  if len(q.Artist) > 0 && len(q.Album) > 0 {
+    keys = append(keys, safeKey(q.Artist + " - " + q.Album))
+  }
+  return keys
+}
+
+func safeKey(s string) string {
+  return regexp.MustCompile(`[/\\:*?"<>|]`).ReplaceAllString(s, "_")
+}
+
+// queries a server implementing the Cover Art Archive API
+// (/release/{MBID}/front); Search resolves a release id from artist & album
+// when the query does not include one
+type CoverArtArchive struct {
+  BaseURL string
+  Client *http.Client
+  Search func(artist, album string) (string, error)
+}
+
+func (c *CoverArtArchive) Cover(q *CoverQuery) ([]byte, error) {
+  id := q.MBID
+  if len(id) == 0 && c.Search != nil && len(q.Album) > 0 {
+    var err error
+    id, err = c.Search(q.Artist, q.Album)
+    if err != nil {
+      return nil, err
+    }
+  }
+  if len(id) == 0 {
+    return nil, nil
+  }
+
+  resp, err := c.Client.Get(c.BaseURL + "/release/" + url.PathEscape(id) +
+    "/front")
+  if err != nil {
+    return nil, err
+  }
+  defer resp.Body.Close()
+
+  if resp.StatusCode == http.StatusNotFound {
+    return nil, nil
+  }
+  if resp.StatusCode != http.StatusOK {
+    return nil, fmt.Errorf("cover art: %v returned %v", id, resp.Status)
+  }
+
+  return ioutil.ReadAll(resp.Body)
+}
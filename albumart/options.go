@@ -0,0 +1,110 @@
+package albumart
+
+import (
+  "fmt"
+  "strings"
+  "strconv"
+  "os/exec"
+)
+
+// artwork size, quality & format policy
+type Options struct {
+  // images wider or taller are resized to fit
+  MaxSize int
+  // JPEG quality from 1 to 100; 0 uses ffmpeg default (qscale 2)
+  Quality int
+  // progressive JPEG (requires jpegtran), otherwise baseline
+  Progressive bool
+  // keep larger original as folder-orig.jpg
+  KeepOriginal bool
+}
+
+func DefaultOptions() *Options {
+  return &Options{ MaxSize: 500, KeepOriginal: true }
+}
+
+// parse comma separated options onto defaults, ie
+// "size=300,quality=85,baseline,no-orig" or "size=1200,progressive"
+func ParseOptions(spec string) (*Options, error) {
+  o := DefaultOptions()
+
+  for _, s := range strings.Split(spec, ",") {
+    s = strings.ToLower(strings.TrimSpace(s))
+    kv := strings.SplitN(s, "=", 2)
+
+    var err error
+    switch kv[0] {
+    case "":
+    case "size", "quality":
+      n := 0
+      if len(kv) == 2 {
+        n, err = strconv.Atoi(kv[1])
+      }
+      if err != nil || n < 1 || (kv[0] == "quality" && n > 100) {
+        return o, fmt.Errorf("invalid artwork option: %v", s)
+      }
+      if kv[0] == "size" {
+        o.MaxSize = n
+      } else {
+        o.Quality = n
+      }
+    case "progressive":
+      o.Progressive = true
+    case "baseline":
+      o.Progressive = false
+    case "orig":
+      o.KeepOriginal = true
+    case "no-orig":
+      o.KeepOriginal = false
+    default:
+      return o, fmt.Errorf("invalid artwork option: %v", s)
+    }
+  }
+
+  return o, nil
+}
+
+// ffmpeg qscale (2 best to 31 worst) from JPEG quality
+func (o *Options) qscale() int {
+  if o.Quality == 0 {
+    return 2
+  }
+  q := 2 + ((100 - o.Quality) * 29 + 50) / 100
+  if q > 31 {
+    q = 31
+  }
+  return q
+}
+
+// true if image of width & height must be resized
+func (o *Options) resize(width, height int) bool {
+  return width > o.MaxSize || height > o.MaxSize
+}
+
+// ffmpeg args to resize (if necessary) & encode input as output jpeg
+func (o *Options) ffmpegArgs(input, output string, resize bool) []string {
+  args := []string{ "-i", input, "-y", "-qscale:v", strconv.Itoa(o.qscale()) }
+  if resize {
+    args = append(args, "-vf", fmt.Sprintf(
+      "scale=w=%d:h=%d:force_original_aspect_ratio=decrease", o.MaxSize,
+      o.MaxSize))
+  }
+  return append(args, output)
+}
+
+// losslessly convert jpeg to progressive with jpegtran; returns input if
+// jpegtran is not installed
+func progressive(input, output string) (string, error) {
+  bin, err := exec.LookPath("jpegtran")
+  if err != nil {
+    fmt.Printf("\njpegtran not found, artwork left as baseline JPEG.\n")
+    return input, nil
+  }
+
+  out, err := exec.Command(bin, "-progressive", "-optimize", "-copy", "none",
+    "-outfile", output, input).CombinedOutput()
+  if err != nil {
+    return input, fmt.Errorf("%v: %s", err, out)
+  }
+  return output, nil
+}
@@ -0,0 +1,119 @@
+package albumart
+
+import (
+  "io"
+  "os"
+  "image"
+  "strings"
+  "image/jpeg"
+  "path/filepath"
+  _ "golang.org/x/image/webp"
+
+  xdraw "golang.org/x/image/draw"
+
+  "github.com/jamlib/audioc/id3"
+  "github.com/jamlib/audioc/flac"
+)
+
+// sorted image extensions decoded natively (fsutil.ImageExts plus webp)
+var imageExts = []string{ "jpeg", "jpg", "png", "webp" }
+
+// JPEG quality when Options.Quality is not set
+const defaultQuality = 90
+
+// embedded front picture read directly from MP3 (APIC frame) or FLAC
+// (PICTURE block); nil if file has none or only compressed or encrypted APIC
+// frames, which are left to ffprobe
+func ExtractPicture(file string) ([]byte, error) {
+  switch strings.ToLower(filepath.Ext(file)) {
+  case ".mp3":
+    t, err := id3.ReadFile(file)
+    if err != nil {
+      if err == id3.ErrNoTag {
+        return nil, nil
+      }
+      return nil, err
+    }
+    if p := t.FrontPicture(); p != nil {
+      return p.Data, nil
+    }
+  case ".flac":
+    blocks, err := flac.ReadFile(file)
+    if err != nil {
+      return nil, err
+    }
+    if p := flac.FrontPicture(blocks); p != nil {
+      return p.Data, nil
+    }
+  }
+  return nil, nil
+}
+
+// scale img to fit within max pixels (width & height) using Catmull-Rom
+// resampling; returns img if already fits
+func Resize(img image.Image, max int) image.Image {
+  b := img.Bounds()
+  w, h := b.Dx(), b.Dy()
+  if w <= max && h <= max {
+    return img
+  }
+
+  if w >= h {
+    w, h = max, h * max / w
+  } else {
+    w, h = w * max / h, max
+  }
+  if w < 1 {
+    w = 1
+  }
+  if h < 1 {
+    h = 1
+  }
+
+  dst := image.NewRGBA(image.Rect(0, 0, w, h))
+  xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, xdraw.Src, nil)
+  return dst
+}
+
+// decode src (JPEG, PNG or WebP), resize (if specified) & encode as jpeg dst
+func (o *Options) convert(src, dst string, resize bool) error {
+  f, err := os.Open(src)
+  if err != nil {
+    return err
+  }
+  img, _, err := image.Decode(f)
+  f.Close()
+  if err != nil {
+    return err
+  }
+
+  if resize {
+    img = Resize(img, o.MaxSize)
+  }
+
+  quality := o.Quality
+  if quality == 0 {
+    quality = defaultQuality
+  }
+
+  out, err := os.Create(dst)
+  if err != nil {
+    return err
+  }
+  defer out.Close()
+
+  return jpeg.Encode(out, img, &jpeg.Options{ Quality: quality })
+}
+
+// resize & encode src as jpeg dst per options (ie artwork of synced copies)
+func (o *Options) Export(src, dst string) error {
+  return o.convert(src, dst, true)
+}
+
+// image.DecodeConfig unless AlbumArt.ImgDecode is provided
+func (a *AlbumArt) decodeConfig() func (r io.Reader) (image.Config, string, error) {
+  if a.ImgDecode == nil {
+    return image.DecodeConfig
+  }
+  return a.ImgDecode
+}
@@ -0,0 +1,218 @@
+package albumart
+
+import (
+  "os"
+  "fmt"
+  "bufio"
+  "image"
+  "strings"
+  "hash/fnv"
+  "image/draw"
+  "image/color"
+  "image/jpeg"
+
+  "github.com/jamlib/audioc/metadata"
+)
+
+// default lines of placeholder cover; separated by "|"
+const PlaceholderTemplate = "{artist}|{date}|{venue}"
+
+// text available to placeholder template as {artist}, {date}, {year},
+// {month}, {day} & {venue}
+type PlaceholderText struct {
+  Artist, Year, Month, Day, Venue string
+}
+
+type Colors struct {
+  Background, Foreground color.RGBA
+}
+
+// renders a cover for albums without artwork
+type Placeholder struct {
+  // width & height in pixels
+  Size int
+  Template string
+  // colors keyed by lowercase artist; derived from artist name if not found
+  Colors map[string]*Colors
+}
+
+func NewPlaceholder() *Placeholder {
+  return &Placeholder{ Size: 500, Template: PlaceholderTemplate,
+    Colors: map[string]*Colors{} }
+}
+
+// lines of text from template, transliterated to the ASCII of font5x7 (ie
+// "Sigur Rós" to "Sigur Ros") & wrapping long lines at spaces
+func (p *Placeholder) Lines(t *PlaceholderText) []string {
+  date := strings.Join([]string{ t.Year, t.Month, t.Day }, ".")
+  r := strings.NewReplacer("{artist}", t.Artist, "{date}", date,
+    "{year}", t.Year, "{month}", t.Month, "{day}", t.Day, "{venue}", t.Venue)
+
+  lines := []string{}
+  text := metadata.Transliterate(r.Replace(p.Template))
+  for _, l := range strings.Split(text, "|") {
+    lines = append(lines, wrapLine(strings.TrimSpace(l), 20)...)
+  }
+  return lines
+}
+
+func wrapLine(s string, max int) []string {
+  lines := []string{}
+  line := ""
+  for _, w := range strings.Fields(s) {
+    if len(line) > 0 && len(line) + 1 + len(w) > max {
+      lines = append(lines, line)
+      line = ""
+    }
+    if len(line) > 0 {
+      line += " "
+    }
+    line += w
+  }
+  if len(line) > 0 {
+    lines = append(lines, line)
+  }
+  return lines
+}
+
+// colors for artist; a consistent color is derived from the artist name
+// when none are configured
+func (p *Placeholder) ArtistColors(artist string) *Colors {
+  if c, ok := p.Colors[strings.ToLower(artist)]; ok {
+    return c
+  }
+
+  h := fnv.New32a()
+  h.Write([]byte(strings.ToLower(artist)))
+  v := h.Sum32()
+
+  // dark background with light foreground of same hue
+  bg := color.RGBA{ uint8(v >> 16) % 96, uint8(v >> 8) % 96, uint8(v) % 96, 255 }
+  fg := color.RGBA{ bg.R + 159, bg.G + 159, bg.B + 159, 255 }
+  return &Colors{ Background: bg, Foreground: fg }
+}
+
+// draw text centered on background of artist colors
+func (p *Placeholder) Render(t *PlaceholderText) *image.RGBA {
+  c := p.ArtistColors(t.Artist)
+  img := image.NewRGBA(image.Rect(0, 0, p.Size, p.Size))
+  draw.Draw(img, img.Bounds(), &image.Uniform{ c.Background }, image.ZP,
+    draw.Src)
+
+  lines := p.Lines(t)
+  if len(lines) == 0 {
+    return img
+  }
+
+  // scale each line to fit width (10% margin), limited by height per line
+  margin := p.Size / 10
+  maxScale := (p.Size - 2*margin) / (len(lines) * 9)
+  scales := make([]int, len(lines))
+  height := 0
+  for x, l := range lines {
+    scales[x] = maxScale
+    if w := len([]rune(l)) * 6 - 1; w > 0 && (p.Size - 2*margin) / w < maxScale {
+      scales[x] = (p.Size - 2*margin) / w
+    }
+    if scales[x] < 1 {
+      scales[x] = 1
+    }
+    height += scales[x] * 9
+  }
+
+  y := (p.Size - height) / 2
+  for x, l := range lines {
+    w := (len([]rune(l)) * 6 - 1) * scales[x]
+    drawText(img, l, (p.Size - w) / 2, y + scales[x], scales[x], c.Foreground)
+    y += scales[x] * 9
+  }
+
+  return img
+}
+
+// draw text using font5x7 with each dot scaled to a square of scale pixels;
+// characters without a glyph are drawn as '?'
+func drawText(img draw.Image, s string, x, y, scale int, c color.RGBA) {
+  u := &image.Uniform{ c }
+  for _, r := range s {
+    if r < 32 || r > 126 {
+      r = '?'
+    }
+    g := font5x7[r-32]
+    for row := 0; row < 7; row++ {
+      for col := 0; col < 5; col++ {
+        if g[row] & (0x10 >> uint(col)) == 0 {
+          continue
+        }
+        px := x + col*scale
+        py := y + row*scale
+        draw.Draw(img, image.Rect(px, py, px+scale, py+scale), u, image.ZP,
+          draw.Src)
+      }
+    }
+    x += 6 * scale
+  }
+}
+
+// render & save as jpeg
+func (p *Placeholder) WriteJpeg(file string, t *PlaceholderText) error {
+  f, err := os.Create(file)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+
+  return jpeg.Encode(f, p.Render(t), &jpeg.Options{ Quality: 90 })
+}
+
+// read per artist colors from file; one artist per line as
+// "Artist Name = #background, #foreground"
+func (p *Placeholder) ReadColors(file string) error {
+  f, err := os.Open(file)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+
+  s := bufio.NewScanner(f)
+  for s.Scan() {
+    l := strings.TrimSpace(s.Text())
+    if len(l) == 0 || strings.HasPrefix(l, "#") {
+      continue
+    }
+
+    kv := strings.SplitN(l, "=", 2)
+    cs := []string{}
+    if len(kv) == 2 {
+      cs = strings.Split(kv[1], ",")
+    }
+    if len(cs) != 2 {
+      return fmt.Errorf("invalid placeholder colors: %v", l)
+    }
+
+    bg, err := ParseColor(cs[0])
+    if err != nil {
+      return err
+    }
+    fg, err := ParseColor(cs[1])
+    if err != nil {
+      return err
+    }
+
+    artist := strings.ToLower(strings.TrimSpace(kv[0]))
+    p.Colors[artist] = &Colors{ Background: bg, Foreground: fg }
+  }
+
+  return s.Err()
+}
+
+// parse hex color, ie "#1d3557"
+func ParseColor(s string) (color.RGBA, error) {
+  c := color.RGBA{ A: 255 }
+  s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+  _, err := fmt.Sscanf(s, "%02x%02x%02x", &c.R, &c.G, &c.B)
+  if err != nil || len(s) != 6 {
+    return c, fmt.Errorf("invalid color: %v", s)
+  }
+  return c, nil
+}
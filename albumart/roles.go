@@ -0,0 +1,134 @@
+package albumart
+
+import (
+  "io"
+  "os"
+  "image"
+  "regexp"
+  "path/filepath"
+
+  "github.com/jamlib/libaudio/fsutil"
+)
+
+// role of an artwork image within an album
+type Role string
+
+const (
+  RoleFront Role = "front"
+  RoleBack Role = "back"
+  RoleDisc Role = "disc"
+  RoleInlay Role = "inlay"
+  RoleBooklet Role = "booklet"
+  RoleArtist Role = "artist"
+  RoleOther Role = "other"
+)
+
+// filename patterns for each role, in order of precedence
+var rolePatterns = []struct {
+  role Role
+  re *regexp.Regexp
+}{
+  { RoleBack, regexp.MustCompile(`(?i)(^|[^a-z])(back|rear)([^a-z]|$)`) },
+  { RoleInlay, regexp.MustCompile(`(?i)(^|[^a-z])(inlay|inside|tray)([^a-z]|$)`) },
+  { RoleBooklet, regexp.MustCompile(`(?i)(^|[^a-z])(booklet|book|page|insert)([^a-z]|$)`) },
+  { RoleDisc, regexp.MustCompile(`(?i)(^|[^a-z])(cd|disc|disk|matrix)([^a-z]|\d|$)`) },
+  { RoleArtist, regexp.MustCompile(`(?i)(^|[^a-z])(artist|band)([^a-z]|$)`) },
+  { RoleFront, regexp.MustCompile(`(?i)(^|[^a-z])(front|cover|folder)([^a-z]|$)`) },
+}
+
+// FLAC & ID3 APIC picture type
+func (r Role) PictureType() int {
+  switch r {
+  case RoleFront:
+    return 3
+  case RoleBack:
+    return 4
+  case RoleBooklet:
+    return 5
+  case RoleDisc:
+    return 6
+  case RoleArtist:
+    return 8
+  }
+  return 0
+}
+
+type Image struct {
+  Path string
+  Role Role
+  Width, Height int
+}
+
+// role from filename, else from aspect ratio: square images are front
+// candidates, landscape images are back covers (with spines) & portrait
+// images are booklet pages. width & height of 0 are unknown
+func ImageRole(file string, width, height int) Role {
+  name := filepath.Base(file)
+  for _, p := range rolePatterns {
+    if p.re.MatchString(name) {
+      return p.role
+    }
+  }
+
+  if width == 0 || height == 0 {
+    return RoleOther
+  }
+
+  ratio := float64(width) / float64(height)
+  switch {
+  case ratio >= 0.95 && ratio <= 1.05:
+    return RoleFront
+  case ratio > 1.1:
+    return RoleBack
+  case ratio < 0.9:
+    return RoleBooklet
+  }
+  return RoleOther
+}
+
+// classify images within dir (including nested, ie "Artwork/back.jpg")
+func Classify(dir string,
+  decode func (r io.Reader) (image.Config, string, error)) []*Image {
+
+  images := []*Image{}
+  for _, f := range fsutil.FilesByExtension(dir, imageExts) {
+    img := &Image{ Path: filepath.Join(dir, f) }
+    if file, err := os.Open(img.Path); err == nil {
+      if c, _, err := decode(file); err == nil {
+        img.Width, img.Height = c.Width, c.Height
+      }
+      file.Close()
+    }
+
+    img.Role = ImageRole(f, img.Width, img.Height)
+    images = append(images, img)
+  }
+  return images
+}
+
+// best front image: named front (ie "front.jpg", "cover.jpg"), then
+// largest square image; returns nil if neither found
+func FrontImage(images []*Image) *Image {
+  var named, square *Image
+  for _, img := range images {
+    if img.Role != RoleFront {
+      continue
+    }
+
+    if rolePatterns[len(rolePatterns)-1].re.MatchString(filepath.Base(img.Path)) {
+      if named == nil || img.Width > named.Width {
+        named = img
+      }
+      continue
+    }
+
+    if square == nil || img.Width > square.Width {
+      square = img
+    }
+  }
+
+  if named != nil {
+    return named
+  }
+  return square
+}
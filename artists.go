@@ -0,0 +1,64 @@
+package audioc
+
+import (
+  "strings"
+
+  "github.com/jamlib/audioc/metadata"
+)
+
+// album artist of bundle from track artist tags. when track artists differ,
+// the artist of most tracks (or --artist) is album artist (ie guest sit-ins),
+// otherwise bundle is a compilation of "Various Artists"
+func (a *audioc) processArtists(indexes []int) {
+  a.AlbumArtist, a.Compilation = "", false
+  artist := a.InfoFromConfig(indexes[0]).Artist
+
+  // artist folder of compilations (ie --collection "Various Artists/...")
+  if strings.EqualFold(artist, metadata.VariousArtists) {
+    a.AlbumArtist, a.Compilation = metadata.VariousArtists, true
+    return
+  }
+
+  counts := map[string]int{}
+  names := map[string]string{}
+  total := 0
+  for _, x := range indexes {
+    d, err := a.probe(x)
+    if err != nil || d.Format == nil || d.Format.Tags == nil {
+      continue
+    }
+
+    name := strings.TrimSpace(d.Format.Tags.Artist)
+    if len(name) == 0 {
+      continue
+    }
+    key := strings.ToLower(name)
+    counts[key]++
+    if _, ok := names[key]; !ok {
+      names[key] = name
+    }
+    total++
+  }
+
+  if len(counts) < 2 {
+    return
+  }
+
+  top := ""
+  for k := range counts {
+    if len(top) == 0 || counts[k] > counts[top] ||
+      counts[k] == counts[top] && k < top {
+      top = k
+    }
+  }
+
+  if counts[top] * 2 <= total {
+    a.AlbumArtist, a.Compilation = metadata.VariousArtists, true
+    return
+  }
+
+  a.AlbumArtist = names[top]
+  if len(artist) > 0 {
+    a.AlbumArtist = artist
+  }
+}
@@ -5,15 +5,50 @@ import (
   "fmt"
   "runtime"
   "strings"
+  "sync"
 
   "github.com/jamlib/libaudio/ffmpeg"
   "github.com/jamlib/libaudio/ffprobe"
   "github.com/jamlib/libaudio/fsutil"
+  "github.com/jamlib/audioc/ignore"
+  "github.com/jamlib/audioc/lookup"
+  "github.com/jamlib/audioc/metadata"
+  "github.com/jamlib/audioc/fsprofile"
+  "github.com/jamlib/audioc/tagmap"
+  "github.com/jamlib/audioc/albumart"
+  "github.com/jamlib/audioc/fingerprint"
 )
 
 type Config struct {
-  Dir, Artist, Album, Bitrate string
-  Collection, Fix, Force, Write bool
+  Command, Dir, Artist, Album, Bitrate string
+  Checksums, Collection, Companions, Extras, Fix, Flatten, Force, Gapless bool
+  Placeholder, ReplayGain, Verify, Write bool
+  // release lookup JSON dump file or web service url
+  Lookup string
+  LookupThreshold float64
+  // fingerprint database file or lookup service url & client key
+  Fingerprint, FingerprintKey string
+  // artwork options for MP3 & FLAC output, ie "size=300,quality=85,baseline"
+  Artwork, ArtworkFlac string
+  // folder of cover images or cover art service url & cover cache folder
+  Covers, CoversCache string
+  // placeholder cover template & per artist colors file
+  PlaceholderTemplate, PlaceholderColors string
+  // source tags preserved, renamed & set per artist
+  TagRules string
+  // filename policy: strict (default), unicode or ascii; & filesystem
+  // profile of resulting paths: posix (default), windows or fat32
+  Filenames, Filesystem string
+  // title case track titles & per artist song title dictionary file
+  TitleCase bool
+  Titles string
+  // sync destination folder, format (mp3, opus, aac, flac) & selection, ie
+  // "artist=Phish,year>=1995"
+  To, Format, Select string
+  // conditions of files processed & skipped, ie "artist=Phish,year<2000"
+  Include, Exclude string
+  // comma separated preferences used by dupes, ie "FLAC,V0,320"
+  PreferFormat, PreferSource string
 }
 
 type audioc struct {
@@ -21,9 +56,38 @@ type audioc struct {
   Ffmpeg ffmpeg.Ffmpeger
   Ffprobe ffprobe.Ffprober
   Image string
+  Pictures []*albumart.Image
+  ArtOptions, ArtOptionsFlac *albumart.Options
   Files []string
   Workers int
   Workdir string
+  Lookup lookup.Provider
+  Release *lookup.Release
+  ReleaseTracks map[int]*lookup.Track
+  Identifier fingerprint.Identifier
+  Covers albumart.CoverProvider
+  Placeholder *albumart.Placeholder
+  TagRules *tagmap.Rules
+  Titles *metadata.Titles
+  Profile *fsprofile.Profile
+  Paths *fsprofile.Paths
+  // per folder markers (.audioc), keyed by folder relative to Config.Dir
+  Markers map[string]*marker
+  // patterns of .audiocignore files within Config.Dir
+  Ignore *ignore.Matcher
+  SourceInfo *metadata.Info
+  DiscDirs []string
+  TrackTotals map[int]string
+  // probe data of bundle files, by index
+  Probes map[int]*ffprobe.Data
+  DiscTotal string
+  // album artist when track artists of bundle differ
+  AlbumArtist string
+  Compilation bool
+  // files split from gapless stream of bundle, by source
+  Gapless map[string]string
+  Gains []*trackGain
+  gainsMutex sync.Mutex
 }
 
 func New(c *Config, ffm ffmpeg.Ffmpeger, ffp ffprobe.Ffprober) *audioc {
@@ -42,8 +106,89 @@ func (a *audioc) Process() error {
     return fmt.Errorf("Invalid directory: %s", a.Config.Dir)
   }
 
+  // filesystem profile of resulting paths
+  a.Profile, err = fsprofile.Get(a.Config.Filesystem)
+  if err != nil {
+    return err
+  }
+  a.Paths = a.Profile.NewPaths(a.Config.Dir)
+
+  // setup release lookup provider
+  if len(a.Config.Lookup) > 0 && a.Lookup == nil {
+    a.Lookup, err = lookup.New(a.Config.Lookup)
+    if err != nil {
+      return err
+    }
+  }
+
+  // artwork options per output format; FLAC defaults to MP3 options
+  a.ArtOptions, err = albumart.ParseOptions(a.Config.Artwork)
+  if err != nil {
+    return err
+  }
+  a.ArtOptionsFlac = a.ArtOptions
+  if len(a.Config.ArtworkFlac) > 0 {
+    a.ArtOptionsFlac, err = albumart.ParseOptions(a.Config.ArtworkFlac)
+    if err != nil {
+      return err
+    }
+  }
+
+  // setup cover provider; album lookup resolves release ids (if provided)
+  if (len(a.Config.Covers) > 0 || len(a.Config.CoversCache) > 0) &&
+    a.Covers == nil {
+    a.Covers = albumart.NewCoverProvider(a.Config.Covers, a.Config.CoversCache)
+    a.setCoverSearch(a.Covers)
+  }
+
+  // setup placeholder artwork for live performances
+  if a.Config.Placeholder && a.Placeholder == nil {
+    a.Placeholder = albumart.NewPlaceholder()
+    if len(a.Config.PlaceholderTemplate) > 0 {
+      a.Placeholder.Template = a.Config.PlaceholderTemplate
+    }
+    if len(a.Config.PlaceholderColors) > 0 {
+      err = a.Placeholder.ReadColors(a.Config.PlaceholderColors)
+      if err != nil {
+        return err
+      }
+    }
+  }
+
+  // setup tag mapping rules
+  if len(a.Config.TagRules) > 0 && a.TagRules == nil {
+    a.TagRules, err = tagmap.ReadRules(a.Config.TagRules)
+    if err != nil {
+      return err
+    }
+  }
+
+  // setup title normalization
+  if (a.Config.TitleCase || len(a.Config.Titles) > 0) && a.Titles == nil {
+    a.Titles = metadata.NewTitles()
+    a.Titles.Case = a.Config.TitleCase
+    if len(a.Config.Titles) > 0 {
+      err = a.Titles.ReadDictionary(a.Config.Titles)
+      if err != nil {
+        return err
+      }
+    }
+  }
+
+  // setup fingerprint identification
+  if len(a.Config.Fingerprint) > 0 && a.Identifier == nil {
+    a.Identifier, err = fingerprint.New(a.Config.Fingerprint,
+      a.Config.FingerprintKey)
+    if err != nil {
+      return err
+    }
+  }
+
   // obtain audio file list
-  a.Files = fsutil.FilesAudio(a.Config.Dir)
+  a.Files, err = a.audioFiles()
+  if err != nil {
+    return err
+  }
 
   // if --artist mode, move innermost dir from a.Config.Dir and add to
   // each file path within a.Files since this folder could be the album name.
@@ -57,9 +202,21 @@ func (a *audioc) Process() error {
     }
   }
 
-  // group files by parent directory; call a.processBundle
-  // a.processBundle found within bundle.go
-  err = fsutil.BundleFiles(a.Config.Dir, a.Files, a.processBundle)
+  // per folder markers (after paths are relative to a.Config.Dir)
+  err = a.readMarkers()
+  if err != nil {
+    return err
+  }
+
+  // only files selected by --include & --exclude
+  err = a.filterFiles()
+  if err != nil {
+    return err
+  }
+
+  // group files by parent directory (sibling disc folders combined);
+  // call a.processBundle found within bundle.go
+  err = a.bundleFiles(a.processBundle)
   if err != nil {
     return err
   }
@@ -67,3 +224,14 @@ func (a *audioc) Process() error {
   fmt.Printf("\naudioc finished.\n")
   return nil
 }
+
+// audio files nested within a.Config.Dir, except those ignored by
+// .audiocignore files
+func (a *audioc) audioFiles() ([]string, error) {
+  var err error
+  a.Ignore, err = ignore.Read(a.Config.Dir)
+  if err != nil {
+    return []string{}, err
+  }
+  return a.Ignore.Filter(fsutil.FilesAudio(a.Config.Dir)), nil
+}
@@ -2,13 +2,25 @@ package audioc
 
 import (
   "os"
+  "fmt"
+  "math"
+  "sync"
+  "strings"
   "testing"
+  "io/ioutil"
   "encoding/json"
   "path/filepath"
 
   "github.com/jamlib/libaudio/ffmpeg"
   "github.com/jamlib/libaudio/ffprobe"
   "github.com/jamlib/libaudio/fsutil"
+  "github.com/jamlib/audioc/id3"
+  "github.com/jamlib/audioc/mp3"
+  "github.com/jamlib/audioc/lookup"
+  "github.com/jamlib/audioc/tagmap"
+  "github.com/jamlib/audioc/fsprofile"
+  "github.com/jamlib/audioc/metadata"
+  "github.com/jamlib/audioc/fingerprint"
 )
 
 func TestSkipFolderOnCollection(t *testing.T) {
@@ -164,3 +176,1402 @@ func TestProcessMain(t *testing.T) {
 
   // TODO: actually read & compare json data encoded within file
 }
+
+func TestProcessLookup(t *testing.T) {
+  a, indexes := createTestProcessFiles(t, "Grateful Dead", []*TestProcessFiles{
+    { "1975 Blues For Allah/01 help.mp3", &ffprobe.Tags{} },
+    { "1975 Blues For Allah/02 slip.mp3", &ffprobe.Tags{} },
+  })
+  defer os.RemoveAll(filepath.Dir(a.Config.Dir))
+
+  a.Config.Artist = "Grateful Dead"
+  a.Lookup = &lookup.Dump{ Releases: []*lookup.Release{
+    { ID: "r1", Title: "Blues for Allah", Artist: "Grateful Dead",
+      Date: "1975-09-01", Tracks: []*lookup.Track{
+        { ID: "t1", Title: "Help on the Way", Disc: 1, Number: 1 },
+        { ID: "t2", Title: "Slipknot!", Disc: 1, Number: 2 },
+      },
+    },
+  }}
+
+  // durations unknown (mock) scores 0.5
+  a.Config.LookupThreshold = 0.9
+  err := a.processLookup(indexes)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if a.Release != nil {
+    t.Errorf("Expected no release match under threshold")
+  }
+
+  a.Config.LookupThreshold = 0.5
+  err = a.processLookup(indexes)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if a.Release == nil {
+    t.Fatalf("Expected release match")
+  }
+
+  i := &metadata.Info{ Artist: "Grateful Dead", Track: "2", Title: "slip" }
+  if !a.applyRelease(indexes[1], i) {
+    t.Errorf("Expected info to change")
+  }
+
+  e := metadata.Info{ Artist: "Grateful Dead", Album: "Blues for Allah",
+    Year: "1975", Track: "2", Title: "Slipknot!", MBAlbumID: "r1",
+    MBTrackID: "t2" }
+  if *i != e {
+    t.Errorf("Expected %v, got %v", e, *i)
+  }
+}
+
+type testIdentifier struct {
+  entry *fingerprint.Entry
+  score float64
+}
+
+func (i *testIdentifier) Identify(fp []uint32,
+  d float64) (*fingerprint.Entry, float64, error) {
+  return i.entry, i.score, nil
+}
+
+func TestIdentify(t *testing.T) {
+  a, _ := createTestProcessFiles(t, "Unknown", []*TestProcessFiles{
+    { "Track01.wav", &ffprobe.Tags{} },
+  })
+  defer os.RemoveAll(filepath.Dir(a.Config.Dir))
+
+  e := &fingerprint.Entry{ Artist: "Jerry Garcia", Album: "1972 Garcia",
+    Title: "Sugaree" }
+
+  tests := []struct {
+    title string
+    score float64
+    result metadata.Info
+  }{
+    { title: "Track01", score: 0.95, result: metadata.Info{
+      Artist: "Jerry Garcia", Album: "Garcia", Year: "1972", Title: "Sugaree" },
+    },{
+      title: "Track01", score: 0.5, result: metadata.Info{ Title: "Track01" },
+    },{
+      title: "Deal", score: 0.95, result: metadata.Info{ Title: "Deal" },
+    },
+  }
+
+  for x := range tests {
+    a.Identifier = &testIdentifier{ entry: e, score: tests[x].score }
+    i := &metadata.Info{ Title: tests[x].title }
+
+    _, err := a.identify(filepath.Join(a.Config.Dir, a.Files[0]), i)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if *i != tests[x].result {
+      t.Errorf("Expected %v, got %v", tests[x].result, *i)
+    }
+  }
+}
+
+func TestDupes(t *testing.T) {
+  a, _ := createTestProcessFiles(t, "Collection", []*TestProcessFiles{
+    { "Grateful Dead/1977/1977.05.08 Barton Hall, Ithaca, NY [AUD]/01 a.flac", &ffprobe.Tags{} },
+    { "Grateful Dead/1977/1977.05.08 Barton Hall, Ithaca, NY [SBD]/01 a.flac", &ffprobe.Tags{} },
+    { "Grateful Dead/1977/1977.05.08 Cornell/01 a.mp3", &ffprobe.Tags{} },
+    { "Grateful Dead/1977/1977 Terrapin Station/01 a.mp3", &ffprobe.Tags{} },
+    { "Grateful Dead/2004/2004 Terrapin Station - FLAC/01 a.flac", &ffprobe.Tags{} },
+    { "Phish/1977/1977 Terrapin Station/01 a.flac", &ffprobe.Tags{} },
+  })
+  defer os.RemoveAll(filepath.Dir(a.Config.Dir))
+
+  a.Config.Collection = true
+  a.Files = fsutil.FilesAudio(a.Config.Dir)
+
+  albums := []*album{}
+  for x := range a.Files {
+    al, err := a.albumFromBundle([]int{ x })
+    if err != nil {
+      t.Fatal(err)
+    }
+    albums = append(albums, al)
+  }
+
+  results := [][]string{
+    {
+      "Grateful Dead/2004/2004 Terrapin Station - FLAC",
+      "Grateful Dead/1977/1977 Terrapin Station",
+    },{
+      "Grateful Dead/1977/1977.05.08 Barton Hall, Ithaca, NY [SBD]",
+      "Grateful Dead/1977/1977.05.08 Barton Hall, Ithaca, NY [AUD]",
+      "Grateful Dead/1977/1977.05.08 Cornell",
+    },
+  }
+
+  groups := a.rankDupes(albums)
+  if len(groups) != len(results) {
+    t.Fatalf("Expected %v groups, got %v", len(results), len(groups))
+  }
+
+  for x := range groups {
+    dirs := []string{}
+    for y := range groups[x] {
+      dirs = append(dirs, groups[x][y].Dir)
+    }
+    if strings.Join(dirs, "\n") != strings.Join(results[x], "\n") {
+      t.Errorf("Expected %v, got %v", results[x], dirs)
+    }
+  }
+}
+
+func TestDupesDiscs(t *testing.T) {
+  a, _ := createTestProcessFiles(t, "Collection", []*TestProcessFiles{
+    { "Phish/1995/1995 A Live One/CD1/01 a.flac", &ffprobe.Tags{} },
+    { "Phish/1995/1995 A Live One/CD2/01 b.flac", &ffprobe.Tags{} },
+    { "Phish/1995/1995 A Live One - FLAC/01 a.flac", &ffprobe.Tags{} },
+  })
+  defer os.RemoveAll(filepath.Dir(a.Config.Dir))
+
+  a.Config.Collection = true
+  a.Files = fsutil.FilesAudio(a.Config.Dir)
+
+  // disc folders of one album are never dupes of each other
+  albums := []*album{}
+  err := a.bundleFiles(func(indexes []int) error {
+    al, err := a.albumFromBundle(indexes)
+    albums = append(albums, al)
+    return err
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  e := []string{ "Phish/1995/1995 A Live One - FLAC", "Phish/1995/1995 A Live One" }
+  if len(albums) != len(e) {
+    t.Fatalf("Expected %v albums, got %v", len(e), len(albums))
+  }
+  for x := range e {
+    if albums[x].Dir != e[x] {
+      t.Errorf("Expected %v, got %v", e[x], albums[x].Dir)
+    }
+  }
+  if albums[1].Tracks != 2 || albums[0].Key != albums[1].Key {
+    t.Errorf("Expected 2 tracks & same key, got %v, %v", albums[1].Tracks,
+      albums[1].Key)
+  }
+}
+
+func TestAudioFormat(t *testing.T) {
+  tests := [][]string{
+    { "a.flac", "", "FLAC" },
+    { "a.mp3", "320000", "320" },
+    { "a.MP3", "245123", "V0" },
+    { "a.mp3", "128000", "other" },
+    { "a.m4a", "256000", "other" },
+  }
+
+  for x := range tests {
+    r := audioFormat(tests[x][0], tests[x][1])
+    if r != tests[x][2] {
+      t.Errorf("Expected %v, got %v", tests[x][2], r)
+    }
+  }
+}
+
+func TestParseLoudness(t *testing.T) {
+  tests := []struct {
+    out string
+    loudness, peak float64
+    ok bool
+  }{
+    { out: "", ok: false },
+    { out: "frame:0\nlavfi.r128.I=-70.000\nlavfi.r128.true_peaks_ch0=0.000\n",
+      loudness: -70, ok: true },
+    { out: "lavfi.r128.I=-inf\n", ok: false },
+    { out: "lavfi.r128.I=-30.1\nlavfi.r128.true_peaks_ch0=0.5\n" +
+      "lavfi.r128.true_peaks_ch1=0.7\nlavfi.r128.I=-20.5\n" +
+      "lavfi.r128.true_peaks_ch0=0.6\n", loudness: -20.5, peak: 0.7, ok: true },
+  }
+
+  for x := range tests {
+    l, p, ok := parseLoudness(tests[x].out)
+    if ok != tests[x].ok || ok && (l != tests[x].loudness || p != tests[x].peak) {
+      t.Errorf("Expected %v %v %v, got %v %v %v", tests[x].loudness,
+        tests[x].peak, tests[x].ok, l, p, ok)
+    }
+  }
+}
+
+func TestAlbumGain(t *testing.T) {
+  l, p := albumGain([]*trackGain{
+    { Loudness: -20, Peak: 0.5, Duration: 100 },
+    { Loudness: -20, Peak: 0.9, Duration: 300 },
+  })
+  if math.Abs(l + 20) > 0.0001 || p != 0.9 {
+    t.Errorf("Expected -20 0.9, got %v %v", l, p)
+  }
+
+  tags := replayGainTags("ALBUM", l, p)
+  if tags["REPLAYGAIN_ALBUM_GAIN"] != "2.00 dB" ||
+    tags["REPLAYGAIN_ALBUM_PEAK"] != "0.900000" {
+    t.Errorf("Unexpected tags %v", tags)
+  }
+}
+
+func TestSourceSamples(t *testing.T) {
+  tests := []struct {
+    d *ffprobe.Data
+    samples int
+    exact bool
+  }{
+    { d: &ffprobe.Data{ Format: &ffprobe.Format{} }, samples: 0 },
+    { d: &ffprobe.Data{ Streams: []*ffprobe.Stream{
+      { CodecType: "audio", SampleRate: "44100", TimeBase: "1/44100",
+        DurationTs: 441000 },
+      }, Format: &ffprobe.Format{ Duration: 9 },
+    }, samples: 441000, exact: true },
+    { d: &ffprobe.Data{ Streams: []*ffprobe.Stream{
+      { CodecType: "audio", SampleRate: "48000", TimeBase: "1/14112000",
+        DurationTs: 35280000 },
+      }, Format: &ffprobe.Format{ Duration: 2.6 },
+    }, samples: 120000, exact: true },
+    { d: &ffprobe.Data{ Streams: []*ffprobe.Stream{
+      { CodecType: "audio", SampleRate: "48000", TimeBase: "1/14112000" },
+      }, Format: &ffprobe.Format{ Duration: 2.5 },
+    }, samples: 120000 },
+  }
+
+  for x := range tests {
+    r, exact := sourceSamples(tests[x].d)
+    if r != tests[x].samples || exact != tests[x].exact {
+      t.Errorf("Expected %v (exact %v), got %v (%v)", tests[x].samples,
+        tests[x].exact, r, exact)
+    }
+  }
+}
+
+// ffmpeg mock returning output from exec function
+type testExecFfmpeg struct {
+  ffmpeg.MockFfmpeg
+  exec func(args ...string) (string, error)
+}
+
+func (f *testExecFfmpeg) Exec(args ...string) (string, error) {
+  return f.exec(args...)
+}
+
+// ffprobe mock returning same data for any file
+type testDataFfprobe struct {
+  ffprobe.MockFfprobe
+  data *ffprobe.Data
+}
+
+func (f *testDataFfprobe) GetData(filePath string) (*ffprobe.Data, error) {
+  return f.data, nil
+}
+
+// MPEG1 Layer III stream: Info frame with LAME header, then audio frames
+func testMp3Stream(frames, delay, padding int) []byte {
+  b := make([]byte, 417)
+  copy(b, []byte{ 0xFF, 0xFB, 0x90, 0x00 })
+  copy(b[36:], "Info")
+  b[43], b[47] = 1, byte(frames)
+  copy(b[48:], "LAME3.100")
+  b[69], b[70], b[71] = byte(delay >> 4), byte(delay << 4) | byte(padding >> 8),
+    byte(padding)
+
+  for x := 0; x < frames; x++ {
+    f := make([]byte, 417)
+    copy(f, []byte{ 0xFF, 0xFB, 0x90, 0x00, byte(x) })
+    b = append(b, f...)
+  }
+  return b
+}
+
+func TestProcessGapless(t *testing.T) {
+  a, _ := createTestProcessFiles(t, "Music", []*TestProcessFiles{
+    { "Phish/1995/1995.12.31 Madison Square Garden/01 a.flac", &ffprobe.Tags{} },
+    { "Phish/1995/1995.12.31 Madison Square Garden/02 b.flac", &ffprobe.Tags{} },
+  })
+  dir := filepath.Dir(a.Config.Dir)
+  defer os.RemoveAll(dir)
+
+  // sources of 10000 samples each; encoded as 19 frames of 20000 samples
+  stream := testMp3Stream(19, 576, 1312)
+  samples := uint64(10000)
+  a.Ffmpeg = &testExecFfmpeg{ exec: func(args ...string) (string, error) {
+    if args[1] == "concat" {
+      return "", ioutil.WriteFile(args[len(args)-1], stream, 0644)
+    }
+    return "", nil
+  }}
+  probe := &testDataFfprobe{ data: &ffprobe.Data{ Streams: []*ffprobe.Stream{
+    { CodecType: "audio", SampleRate: "44100", Channels: 2,
+      TimeBase: "1/44100", DurationTs: samples },
+    }, Format: &ffprobe.Format{ Duration: 0.23, Tags: &ffprobe.Tags{} } } }
+  a.Ffprobe = probe
+
+  a.Config.Collection = true
+  a.Config.Force = true
+  a.Config.Write = true
+  a.Config.Gapless = true
+
+  err := a.Process()
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  files := fsutil.FilesAudio(a.Config.Dir)
+  if len(files) != 2 {
+    t.Fatalf("Expected 2 files, got %v", files)
+  }
+  for _, f := range files {
+    i, err := mp3.ReadFile(filepath.Join(a.Config.Dir, f))
+    if err != nil {
+      t.Fatal(err)
+    }
+    if filepath.Ext(f) != ".mp3" || i.Samples() != 10000 {
+      t.Errorf("Expected mp3 of 10000 samples, got %v %v", f, i.Samples())
+    }
+
+    tag, err := id3.ReadFile(filepath.Join(a.Config.Dir, f))
+    if err != nil || tag.UserText("iTunSMPB") != i.ITunSMPB() {
+      t.Errorf("Expected iTunSMPB tag, got %v", err)
+    }
+  }
+
+  // encoded samples differ from sources
+  for x := range files {
+    os.Remove(filepath.Join(a.Config.Dir, files[x]))
+    err = ioutil.WriteFile(filepath.Join(a.Config.Dir,
+      strings.TrimSuffix(files[x], ".mp3") + ".flac"), []byte{}, 0644)
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+  probe.data.Streams[0].DurationTs = 10001
+  err = a.Process()
+  if err == nil || !strings.Contains(err.Error(), "sources have 20002") {
+    t.Errorf("Expected error of sample count mismatch, got %v", err)
+  }
+}
+
+func TestVerifyFile(t *testing.T) {
+  // STREAMINFO: 44100Hz, 2 channels, 16 bits, 441000 samples, md5 0x01...
+  si := make([]byte, 34)
+  copy(si[10:], []byte{ 0x0A, 0xC4, 0x42, 0xF0, 0x00, 0x06, 0xBA, 0xA8, 0x01 })
+  flacData := append([]byte{ 'f', 'L', 'a', 'C', 0x80, 0, 0, 34 }, si...)
+
+  // total samples unknown (0)
+  unknown := append([]byte{}, flacData...)
+  copy(unknown[8+14:], []byte{ 0, 0, 0, 0 })
+
+  // 20 bits per sample
+  bits20 := append([]byte{}, flacData...)
+  copy(bits20[8+12:], []byte{ 0x43, 0x30 })
+
+  dir, _ := fsutil.CreateTestFiles(t, []*fsutil.TestFile{
+    { Name: "empty.mp3" },
+    { Name: "good.mp3", Contents: "{}" },
+    { Name: "good.flac", Contents: string(flacData) },
+    { Name: "unknown.flac", Contents: string(unknown) },
+    { Name: "20bit.flac", Contents: string(bits20) },
+  })
+  defer os.RemoveAll(dir)
+
+  tests := []struct {
+    file, out string
+    fail bool
+    errs, notes int
+  }{
+    { file: "empty.mp3", errs: 1 },
+    { file: "good.mp3", errs: 0 },
+    { file: "good.mp3", fail: true, errs: 1 },
+    { file: "good.mp3", out: "lavfi.astats.Overall.Peak_level=-inf\n", errs: 1 },
+    { file: "good.mp3", out: "lavfi.astats.Overall.Peak_level=-3.5\n", errs: 0 },
+    { file: "good.flac", out: "MD5=01000000000000000000000000000000\n", errs: 0 },
+    { file: "good.flac", out: "MD5=ffffffffffffffffffffffffffffffff\n", errs: 1 },
+    { file: "unknown.flac", out: "MD5=01000000000000000000000000000000\n", errs: 0 },
+    { file: "20bit.flac", out: "MD5=ffffffffffffffffffffffffffffffff\n", errs: 0,
+      notes: 1 },
+  }
+
+  for x := range tests {
+    f := &testExecFfmpeg{ exec: func(args ...string) (string, error) {
+      if tests[x].fail {
+        return "", fmt.Errorf("exit status 1: truncated")
+      }
+      return tests[x].out, nil
+    }}
+    a := &audioc{ Config: &Config{}, Ffmpeg: f, Ffprobe: &testDataFfprobe{
+      data: &ffprobe.Data{ Format: &ffprobe.Format{ Duration: 10 } } } }
+
+    errs, notes := a.verifyFile(filepath.Join(dir, tests[x].file))
+    if len(errs) != tests[x].errs {
+      t.Errorf("%v: Expected %v errors, got %v", tests[x].file, tests[x].errs,
+        errs)
+    }
+    if len(notes) != tests[x].notes {
+      t.Errorf("%v: Expected %v notes, got %v", tests[x].file, tests[x].notes,
+        notes)
+    }
+  }
+}
+
+func TestChecksumsST5(t *testing.T) {
+  // STREAMINFO: 44100Hz, 2 channels, 24 bits, 441000 samples
+  si := make([]byte, 34)
+  copy(si[10:], []byte{ 0x0A, 0xC4, 0x43, 0x70, 0x00, 0x06, 0xBA, 0xA8, 0x01 })
+  flacData := append([]byte{ 'f', 'L', 'a', 'C', 0x80, 0, 0, 34 }, si...)
+
+  dir, _ := fsutil.CreateTestFiles(t, []*fsutil.TestFile{
+    { Name: "Album/01 a.flac", Contents: string(flacData) },
+    { Name: "Album/old.st5", Contents: "" },
+  })
+  defer os.RemoveAll(dir)
+
+  codecs := []string{}
+  f := &testExecFfmpeg{ exec: func(args ...string) (string, error) {
+    codecs = append(codecs, args[7])
+    return "MD5=0123456789abcdef0123456789abcdef\n", nil
+  }}
+  a := &audioc{ Config: &Config{}, Ffmpeg: f }
+  albumDir := filepath.Join(dir, "Album")
+
+  err := a.writeChecksums(albumDir)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  // st5 regenerated at bit depth of source
+  if strings.Join(codecs, ",") != "pcm_s24le" {
+    t.Errorf("Expected %v, got %v", "pcm_s24le", codecs)
+  }
+  b, _ := ioutil.ReadFile(filepath.Join(albumDir, "Album.st5"))
+  e := "0123456789abcdef0123456789abcdef  [shntool]  01 a.flac\n"
+  if string(b) != e {
+    t.Errorf("Expected %q, got %q", e, string(b))
+  }
+}
+
+func TestChecksums(t *testing.T) {
+  dir, _ := fsutil.CreateTestFiles(t, []*fsutil.TestFile{
+    { Name: "Album/01 a.mp3", Contents: "" },
+    { Name: "Album/cd2/02 b.mp3", Contents: "abc" },
+    { Name: "Album/old.md5", Contents: "0 *x.mp3" },
+    { Name: "Album/old.st5", Contents: "" },
+  })
+  defer os.RemoveAll(dir)
+
+  a := &audioc{ Config: &Config{}, Ffmpeg: &ffmpeg.MockFfmpeg{} }
+  albumDir := filepath.Join(dir, "Album")
+
+  err := a.writeChecksums(albumDir)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if m := checksumManifests(albumDir); strings.Join(m, ",") != "Album.md5" {
+    t.Errorf("Expected %v, got %v", "Album.md5", m)
+  }
+
+  b, _ := ioutil.ReadFile(filepath.Join(albumDir, "Album.md5"))
+  e := "d41d8cd98f00b204e9800998ecf8427e *01 a.mp3\n" +
+    "900150983cd24fb0d6963f7d28e17f72 *cd2/02 b.mp3\n"
+  if string(b) != e {
+    t.Errorf("Expected %q, got %q", e, string(b))
+  }
+
+  err = a.validateChecksums(albumDir)
+  if err != nil {
+    t.Fatal(err)
+  }
+}
+
+func TestCompanions(t *testing.T) {
+  dir, _ := fsutil.CreateTestFiles(t, []*fsutil.TestFile{
+    { Name: "src/01 a.mp3", Contents: "a" },
+    { Name: "src/gd77.txt", Contents: "info" },
+    { Name: "src/gd77.md5", Contents: "same" },
+    { Name: "src/cover.jpg", Contents: "img" },
+    { Name: "src/clip.mkv", Contents: "video" },
+    { Name: "Show/01 a.mp3", Contents: "a" },
+    { Name: "Show/info.txt", Contents: "info" },
+    { Name: "Show/show.log", Contents: "log" },
+    { Name: "Show/other.md5", Contents: "same" },
+    { Name: "Show/back.jpg", Contents: "back" },
+    { Name: "Show/cover.jpg", Contents: "img" },
+    { Name: "Show/folder.jpg", Contents: "img" },
+    { Name: "Show/show.cue", Contents: "cue1" },
+    { Name: "Show/show2.cue", Contents: "cue2" },
+    { Name: "Show/CD1/notes.txt", Contents: "info" },
+  })
+  defer os.RemoveAll(dir)
+
+  src, dest := filepath.Join(dir, "src"), filepath.Join(dir, "Show")
+
+  // images are left for fsutil.MergeFolder
+  stash, err := stashCompanions(src, nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(stash)
+  if files := companionFiles(src); len(files) != 1 || files[0] != "cover.jpg" {
+    t.Errorf("Expected %v, got %v", []string{ "cover.jpg" }, files)
+  }
+
+  // only clip.mkv has content not already within dest
+  err = mergeCompanions(stash, dest)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if n := len(companionFiles(dest)); n != 10 {
+    t.Errorf("Expected %v companions, got %v", 10, n)
+  }
+
+  // nothing organized without --companions or --extras
+  a := &audioc{ Config: &Config{} }
+  err = a.organizeCompanions(dest)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if n := len(companionFiles(dest)); n != 10 {
+    t.Errorf("Expected %v companions, got %v", 10, n)
+  }
+
+  a.Config = &Config{ Companions: true, Extras: true }
+  err = a.organizeCompanions(dest)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  // disc folders are not organized; artwork stays with audio
+  results := []string{
+    "CD1/notes.txt", "back.jpg", "extras/Show.log", "extras/Show.txt",
+    "extras/clip.mkv", "extras/show.cue", "extras/show2.cue", "folder.jpg",
+    "other.md5",
+  }
+  files := companionFiles(dest)
+  if strings.Join(files, "\n") != filepath.FromSlash(strings.Join(results, "\n")) {
+    t.Errorf("Expected %v, got %v", results, files)
+  }
+}
+
+func TestCompanionKind(t *testing.T) {
+  tests := [][]string{
+    { "info.TXT", "text" },
+    { "show.ffp", "checksum" },
+    { "eac.log", "log" },
+    { "folder.jpg", "image" },
+    { "clip.mkv", "video" },
+    { "01 a.flac", "" },
+  }
+
+  for x := range tests {
+    r := companionKind(tests[x][0])
+    if r != tests[x][1] {
+      t.Errorf("Expected %v, got %v", tests[x][1], r)
+    }
+  }
+}
+
+func TestBundleDiscs(t *testing.T) {
+  a := &audioc{ Config: &Config{}, Files: []string{
+    "Album/CD1/01 a.mp3", "Album/CD1/02 b.mp3", "Album/CD1/04 d.mp3",
+    "Album/CD2/01 e.mp3", "Other/cd1/01 f.mp3",
+  }}
+
+  bundles := [][]int{}
+  err := a.bundleFiles(func(indexes []int) error {
+    bundles = append(bundles, indexes)
+    return nil
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if fmt.Sprint(bundles) != "[[0 1 2 3] [4]]" {
+    t.Fatalf("Expected %v, got %v", "[[0 1 2 3] [4]]", bundles)
+  }
+
+  a.DiscDirs = a.discDirs(bundles[0])
+  a.processTotals(bundles[0])
+
+  // highest track number when tracks are missing
+  i := metadata.New(a.Files[2]).Info
+  a.applyTotals(2, i)
+  if i.Disc != "1" || i.TrackTotal != "4" || i.DiscTotal != "2" {
+    t.Errorf("Expected 1 4 2, got %v %v %v", i.Disc, i.TrackTotal, i.DiscTotal)
+  }
+
+  i = metadata.New(a.Files[3]).Info
+  a.applyTotals(3, i)
+  if i.Disc != "2" || i.TrackTotal != "1" {
+    t.Errorf("Expected 2 1, got %v %v", i.Disc, i.TrackTotal)
+  }
+
+  if r := missingTracks([]int{ 1, 2, 4, 4, 7 }); strings.Join(r, ",") != "3,5,6" {
+    t.Errorf("Expected %v, got %v", "3,5,6", r)
+  }
+}
+
+func TestProcessDiscs(t *testing.T) {
+  tests := []struct {
+    flatten bool
+    results []string
+  }{{
+    flatten: false,
+    results: []string{
+      "Phish/2003/2003.07.17 Bonner Springs, KS/CD1/01-01 Chalk Dust Torture.mp3",
+      "Phish/2003/2003.07.17 Bonner Springs, KS/CD2/02-01 Axilla I.mp3",
+    },
+  },{
+    flatten: true,
+    results: []string{
+      "Phish/2003/2003.07.17 Bonner Springs, KS/01-01 Chalk Dust Torture.mp3",
+      "Phish/2003/2003.07.17 Bonner Springs, KS/02-01 Axilla I.mp3",
+    },
+  }}
+
+  for x := range tests {
+    a, _ := createTestProcessFiles(t, "Phish", []*TestProcessFiles{
+      { "2003/2003.07.17 Bonner Springs, KS/CD1/01 Chalk Dust Torture.flac",
+        &ffprobe.Tags{},
+      },{
+        "2003/2003.07.17 Bonner Springs, KS/CD2/01 Axilla I.flac",
+        &ffprobe.Tags{},
+      },
+    })
+    dir := filepath.Dir(a.Config.Dir)
+
+    a.Config.Artist = "Phish"
+    a.Config.Write = true
+    a.Config.Force = true
+    a.Config.Flatten = tests[x].flatten
+
+    err := a.Process()
+    if err != nil {
+      t.Errorf("Expected no error, got: %v", err.Error())
+    }
+
+    files := fsutil.FilesAudio(a.Config.Dir)
+    if strings.Join(files, "\n") != filepath.FromSlash(strings.Join(tests[x].results, "\n")) {
+      t.Errorf("Expected %v, got %v", tests[x].results, files)
+    }
+
+    os.RemoveAll(dir)
+  }
+}
+
+func TestFlattenDiscs(t *testing.T) {
+  dir, _ := fsutil.CreateTestFiles(t, []*fsutil.TestFile{
+    { Name: "Album/folder.jpg", Contents: "album" },
+    { Name: "Album/info.txt", Contents: "info" },
+    { Name: "Album/CD1/01 a.flac", Contents: "a" },
+    { Name: "Album/CD1/folder.jpg", Contents: "cd1" },
+    { Name: "Album/CD1/info.txt", Contents: "info" },
+    { Name: "Album/CD2/01 b.flac", Contents: "b" },
+    { Name: "Album/CD2/folder.jpg", Contents: "cd2" },
+    { Name: "Album/CD2/cd2.md5", Contents: "md5" },
+    { Name: "Album/CD2/.audiocignore", Contents: "*.wav\n" },
+    { Name: "Album/CD2/02 c.wav", Contents: "c" },
+  })
+  defer os.RemoveAll(dir)
+
+  a := &audioc{ Config: &Config{ Dir: dir },
+    DiscDirs: []string{ "Album/CD1", "Album/CD2" } }
+  err := a.flattenDiscs(filepath.Join(dir, "Album"))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  // per-disc artwork dropped, duplicate info.txt skipped; disc folder of
+  // ignored audio kept
+  results := []string{ "01 a.flac", "01 b.flac", "CD2/02 c.wav",
+    "CD2/cd2.md5", "CD2/folder.jpg", "cd2.md5", "folder.jpg", "info.txt" }
+  files := fsutil.FilesByExtension(filepath.Join(dir, "Album"),
+    []string{ "flac", "jpg", "md5", "txt", "wav" })
+  if strings.Join(files, "\n") != filepath.FromSlash(strings.Join(results, "\n")) {
+    t.Errorf("Expected %v, got %v", results, files)
+  }
+}
+
+func TestProcessMp3Tags(t *testing.T) {
+  dir, _ := fsutil.CreateTestFiles(t, []*fsutil.TestFile{
+    { Name: "Album/track.mp3", Contents: "audio" },
+    { Name: "Album/folder.jpg", Contents: "\x89PNG\r\n\x1a\npng" },
+  })
+  defer os.RemoveAll(dir)
+
+  a := &audioc{ Config: &Config{ Write: true }, Ffmpeg: &ffmpeg.MockFfmpeg{},
+    Image: filepath.Join(dir, "Album", "folder.jpg") }
+  i := &metadata.Info{ Artist: "Artist", Album: "Album", Disc: "1",
+    Track: "2", TrackTotal: "9", Title: "Title", Year: "1977", Month: "05",
+    Day: "08", Genre: "Rock", MBAlbumID: "abc", OriginalDate: "1970" }
+
+  file, err := a.processMp3(filepath.Join(dir, "Album", "track.mp3"), i,
+    i.ToFile(""))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  err = a.writeTags(file, i.ExtraTags())
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if filepath.Base(file) != i.ToFile("") + ".mp3" {
+    t.Errorf("Expected %v, got %v", i.ToFile("") + ".mp3", file)
+  }
+
+  tag, err := id3.ReadFile(file)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  tests := map[string]string{ "TPE1": "Artist", "TALB": "1977.05.08 Album",
+    "TPOS": "1", "TRCK": "2/9", "TIT2": "Title", "TDRC": "1977-05-08",
+    "TDOR": "1970", "TPE2": "Artist", "TCON": "Rock" }
+  for id, v := range tests {
+    if tag.Text(id) != v {
+      t.Errorf("Expected %v %q, got %q", id, v, tag.Text(id))
+    }
+  }
+
+  // original date only written when known
+  i.OriginalDate = ""
+  if d, ok := i.ExtraTags()["ORIGINALDATE"]; ok {
+    t.Errorf("Expected no ORIGINALDATE, got %q", d)
+  }
+
+  if v := tag.UserText("MusicBrainz Album Id"); v != "abc" {
+    t.Errorf("Expected abc, got %q", v)
+  }
+  // MIME type from image data
+  p := tag.FrontPicture()
+  if p == nil || p.MIME != "image/png" || !strings.HasSuffix(string(p.Data), "png") {
+    t.Errorf("Expected embedded PNG artwork, got %+v", p)
+  }
+  if m := pictureMIME([]byte("jpg")); m != "image/jpeg" {
+    t.Errorf("Expected image/jpeg, got %v", m)
+  }
+
+  b, _ := ioutil.ReadFile(file)
+  if !strings.HasSuffix(string(b), "audio") {
+    t.Errorf("Expected audio to follow tag")
+  }
+}
+
+func TestProcessArtists(t *testing.T) {
+  tests := []struct {
+    artists []string
+    config, albumArtist string
+    compilation bool
+  }{
+    { artists: []string{ "Phish", "Phish" } },
+    { artists: []string{ "Phish", "", "phish " } },
+    { artists: []string{ "Grateful Dead", "Grateful Dead", "GD & Branford" },
+      albumArtist: "Grateful Dead" },
+    { artists: []string{ "GD", "GD", "GD & Branford" }, config: "Grateful Dead",
+      albumArtist: "Grateful Dead" },
+    { artists: []string{ "Phish", "Ween" },
+      albumArtist: metadata.VariousArtists, compilation: true },
+    { artists: []string{ "Phish" }, config: "various artists",
+      albumArtist: metadata.VariousArtists, compilation: true },
+  }
+
+  for x := range tests {
+    files := []*TestProcessFiles{}
+    for y, artist := range tests[x].artists {
+      files = append(files, &TestProcessFiles{
+        fmt.Sprintf("Album/%02d a.mp3", y+1), &ffprobe.Tags{ Artist: artist } })
+    }
+
+    a, indexes := createTestProcessFiles(t, "Artist", files)
+    a.Config.Artist = tests[x].config
+    a.processArtists(indexes)
+    os.RemoveAll(filepath.Dir(a.Config.Dir))
+
+    if a.AlbumArtist != tests[x].albumArtist ||
+      a.Compilation != tests[x].compilation {
+      t.Errorf("%v: Expected %q %v, got %q %v", tests[x].artists,
+        tests[x].albumArtist, tests[x].compilation, a.AlbumArtist,
+        a.Compilation)
+    }
+  }
+}
+
+// MockFfprobe counting calls of GetData by file
+type countFfprobe struct {
+  ffprobe.MockFfprobe
+  mutex sync.Mutex
+  counts map[string]int
+}
+
+func (f *countFfprobe) GetData(filePath string) (*ffprobe.Data, error) {
+  f.mutex.Lock()
+  f.counts[filePath]++
+  f.mutex.Unlock()
+  return f.MockFfprobe.GetData(filePath)
+}
+
+func TestProbeThreaded(t *testing.T) {
+  a, indexes := createTestProcessFiles(t, "Artist", []*TestProcessFiles{
+    { "Album/01 a.mp3", &ffprobe.Tags{ Artist: "Phish" } },
+    { "Album/02 b.mp3", &ffprobe.Tags{ Artist: "Ween" } },
+    { "Album/03 c.mp3", &ffprobe.Tags{ Artist: "Phish" } },
+  })
+  defer os.RemoveAll(filepath.Dir(a.Config.Dir))
+
+  probe := &countFfprobe{ counts: map[string]int{} }
+  a.Ffprobe, a.Workers = probe, 2
+
+  // album artist & each file from one probe
+  a.probeThreaded(indexes)
+  a.processArtists(indexes)
+  for _, x := range indexes {
+    _, err := a.processFile(x)
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  if a.AlbumArtist != "Phish" {
+    t.Errorf("Expected %v, got %v", "Phish", a.AlbumArtist)
+  }
+  for _, x := range indexes {
+    fp := filepath.Join(a.Config.Dir, a.Files[x])
+    if probe.counts[fp] != 1 {
+      t.Errorf("Expected %v probed once, got %v", a.Files[x], probe.counts[fp])
+    }
+  }
+}
+
+func TestProcessCompilation(t *testing.T) {
+  a, _ := createTestProcessFiles(t, "Music", []*TestProcessFiles{
+    { "Phish/1995 Sampler/01 a.mp3", &ffprobe.Tags{ Artist: "Phish" } },
+    { "Phish/1995 Sampler/02 b.mp3", &ffprobe.Tags{ Artist: "Ween" } },
+  })
+  dir := filepath.Dir(a.Config.Dir)
+  defer os.RemoveAll(dir)
+
+  a.Config.Collection = true
+  a.Config.Write = true
+  a.Config.Force = true
+
+  err := a.Process()
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  e := []string{ "Various Artists/1995/1995 Sampler/01 a.mp3",
+    "Various Artists/1995/1995 Sampler/02 b.mp3" }
+  files := fsutil.FilesAudio(a.Config.Dir)
+  if strings.Join(files, ",") != strings.Join(e, ",") {
+    t.Fatalf("Expected %v, got %v", e, files)
+  }
+
+  tag, err := id3.ReadFile(filepath.Join(a.Config.Dir, e[1]))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if tag.Text("TPE1") != "Ween" || tag.Text("TPE2") != "Various Artists" ||
+    tag.Text("TCMP") != "1" {
+    t.Errorf("Unexpected tags %v %v %v", tag.Text("TPE1"), tag.Text("TPE2"),
+      tag.Text("TCMP"))
+  }
+}
+
+func TestProcessFilenames(t *testing.T) {
+  for _, mode := range []string{ "strict", "unicode", "ascii" } {
+    a, _ := createTestProcessFiles(t, "Music", []*TestProcessFiles{
+      { "Sigur Rós/1999 Ágætis byrjun/01 a.mp3",
+        &ffprobe.Tags{ Artist: "Sigur Rós", Title: "Svefn-g-englar" } },
+    })
+    dir := filepath.Dir(a.Config.Dir)
+    defer os.RemoveAll(dir)
+
+    a.Config.Collection = true
+    a.Config.Write = true
+    a.Config.Filenames = mode
+
+    err := a.Process()
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    e := map[string]string{
+      "strict": "Sigur Rs/1999/1999 gtis byrjun/01 Svefn-g-englar.mp3",
+      "unicode": "Sigur Rós/1999/1999 Ágætis byrjun/01 Svefn-g-englar.mp3",
+      "ascii": "Sigur Ros/1999/1999 Agaetis byrjun/01 Svefn-g-englar.mp3",
+    }[mode]
+    files := fsutil.FilesAudio(a.Config.Dir)
+    if len(files) != 1 || files[0] != e {
+      t.Fatalf("Expected %v, got %v", e, files)
+    }
+
+    // tags keep unicode regardless of filenames
+    tag, err := id3.ReadFile(filepath.Join(a.Config.Dir, e))
+    if err != nil {
+      t.Fatal(err)
+    }
+    if tag.Text("TPE1") != "Sigur Rós" ||
+      tag.Text("TALB") != "1999 Ágætis byrjun" {
+      t.Errorf("Expected unicode tags, got %v %v", tag.Text("TPE1"),
+        tag.Text("TALB"))
+    }
+  }
+}
+
+func TestProcessFilesystem(t *testing.T) {
+  a, _ := createTestProcessFiles(t, "Music", []*TestProcessFiles{
+    { "Phish/1995 Sampler/01 a.mp3",
+      &ffprobe.Tags{ Artist: "Phish", Title: "Why? Because" } },
+    { "Phish/1995 Sampler/02 b.mp3",
+      &ffprobe.Tags{ Artist: "Phish", Title: "CON" } },
+  })
+  dir := filepath.Dir(a.Config.Dir)
+  defer os.RemoveAll(dir)
+
+  a.Config.Collection = true
+  a.Config.Write = true
+  a.Config.Filesystem = "windows"
+
+  err := a.Process()
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  e := []string{ "Phish/1995/1995 Sampler/01 Why Because.mp3",
+    "Phish/1995/1995 Sampler/02 CON.mp3" }
+  files := fsutil.FilesAudio(a.Config.Dir)
+  if strings.Join(files, ",") != strings.Join(e, ",") {
+    t.Fatalf("Expected %v, got %v", e, files)
+  }
+
+  a.Config.Filesystem = "hfs"
+  if err = a.Process(); err == nil {
+    t.Errorf("Expected error of unknown filesystem profile")
+  }
+}
+
+func TestProcessSourceText(t *testing.T) {
+  a, _ := createTestProcessFiles(t, "Music", []*TestProcessFiles{
+    { "Phish/1995 Sampler/01 a.mp3",
+      &ffprobe.Tags{ Artist: "Phish", Title: "Wilson" } },
+    { "Phish/1995.12.31 Madison Square Garden/01 a.mp3",
+      &ffprobe.Tags{ Artist: "Phish", Title: "Tweezer" } },
+  })
+  dir := filepath.Dir(a.Config.Dir)
+  defer os.RemoveAll(dir)
+
+  // studio album notes mentioning a source are not trusted
+  err := ioutil.WriteFile(filepath.Join(a.Config.Dir, "Phish/1995 Sampler",
+    "info.nfo"), []byte("Single first aired on FM radio\n"), 0644)
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = ioutil.WriteFile(filepath.Join(a.Config.Dir,
+    "Phish/1995.12.31 Madison Square Garden", "info.txt"),
+    []byte("Phish\nSource: SBD > DAT\n"), 0644)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  a.Config.Collection = true
+  a.Config.Write = true
+
+  err = a.Process()
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  e := []string{ "Phish/1995/1995 Sampler/01 Wilson.mp3",
+    "Phish/1995/1995.12.31 Madison Square Garden [SBD]/01 Tweezer.mp3" }
+  files := fsutil.FilesAudio(a.Config.Dir)
+  if strings.Join(files, ",") != strings.Join(e, ",") {
+    t.Fatalf("Expected %v, got %v", e, files)
+  }
+}
+
+func TestProcessInclude(t *testing.T) {
+  a, _ := createTestProcessFiles(t, "Music", []*TestProcessFiles{
+    { "Phish/1995 Sampler/01 a.mp3", &ffprobe.Tags{ Title: "a" } },
+    { "Phish/1997 Sampler/01 b.mp3", &ffprobe.Tags{ Title: "b" } },
+    { "Ween/1997 Sampler/01 c.mp3", &ffprobe.Tags{ Title: "c" } },
+    { "Ween/1997 Sampler/02 d.mp3", &ffprobe.Tags{ Title: "d" } },
+  })
+  dir := filepath.Dir(a.Config.Dir)
+  defer os.RemoveAll(dir)
+
+  // artwork within 1997 Phish album folder
+  err := ioutil.WriteFile(filepath.Join(a.Config.Dir,
+    "Phish/1997 Sampler/folder.jpg"), []byte{}, 0644)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  a.Config.Collection = true
+  a.Config.Write = true
+  a.Config.Include = "artist=phish"
+  a.Config.Exclude = "artwork=yes"
+
+  err = a.Process()
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  e := []string{ "Phish/1995/1995 Sampler/01 a.mp3",
+    "Phish/1997 Sampler/01 b.mp3", "Ween/1997 Sampler/01 c.mp3",
+    "Ween/1997 Sampler/02 d.mp3" }
+  files := fsutil.FilesAudio(a.Config.Dir)
+  if strings.Join(files, ",") != strings.Join(e, ",") {
+    t.Fatalf("Expected %v, got %v", e, files)
+  }
+
+  // album of any matching file processed whole
+  a.Config.Include = "path=Ween/**/02*"
+  a.Config.Exclude = ""
+  err = a.Process()
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  e = []string{ "Phish/1995/1995 Sampler/01 a.mp3",
+    "Phish/1997 Sampler/01 b.mp3", "Ween/1997/1997 Sampler/01 c.mp3",
+    "Ween/1997/1997 Sampler/02 d.mp3" }
+  files = fsutil.FilesAudio(a.Config.Dir)
+  if strings.Join(files, ",") != strings.Join(e, ",") {
+    t.Fatalf("Expected %v, got %v", e, files)
+  }
+
+  a.Config.Include = "year 1995"
+  if err = a.Process(); err == nil {
+    t.Errorf("Expected error of invalid condition")
+  }
+}
+
+func TestProcessMarkers(t *testing.T) {
+  a, _ := createTestProcessFiles(t, "Music", []*TestProcessFiles{
+    { "Deaner/1997 Sampler/01 a.mp3", &ffprobe.Tags{ Title: "a" } },
+    { "Phish/1994 Sampler/01 b.mp3", &ffprobe.Tags{ Title: "b" } },
+    { "Phish/1995 Sampler/01 c.flac", &ffprobe.Tags{ Title: "c" } },
+    { "Phish/Unsorted/01 d.mp3", &ffprobe.Tags{ Title: "d" } },
+    { "Phish/1996 Sampler/01 e.wav", &ffprobe.Tags{ Title: "e" } },
+  })
+  dir := filepath.Dir(a.Config.Dir)
+  defer os.RemoveAll(dir)
+
+  files := map[string]string{
+    ".audiocignore": "Unsorted/\n*.wav\n",
+    "Deaner/.audioc": "# folder named after alias\nartist = Ween\n",
+    "Phish/1994 Sampler/.audioc": "skip\n",
+    "Phish/1995 Sampler/.audioc": "keep-flac\n",
+  }
+  for f, c := range files {
+    err := ioutil.WriteFile(filepath.Join(a.Config.Dir, f), []byte(c), 0644)
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  a.Config.Collection = true
+  a.Config.Write = true
+
+  err := a.Process()
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  e := []string{ "Phish/1994 Sampler/01 b.mp3",
+    "Phish/1995/1995 Sampler/01 c.flac", "Phish/1996 Sampler/01 e.wav",
+    "Phish/Unsorted/01 d.mp3", "Ween/1997/1997 Sampler/01 a.mp3" }
+  r := fsutil.FilesAudio(a.Config.Dir)
+  if strings.Join(r, ",") != strings.Join(e, ",") {
+    t.Fatalf("Expected %v, got %v", e, r)
+  }
+
+  // emptied folder kept along with its marker
+  if _, err = os.Stat(filepath.Join(a.Config.Dir, "Deaner/.audioc")); err != nil {
+    t.Errorf("Expected marker of emptied folder kept")
+  }
+
+  err = ioutil.WriteFile(filepath.Join(a.Config.Dir, "Phish/.audioc"),
+    []byte("keep-mp3\n"), 0644)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err = a.Process(); err == nil {
+    t.Errorf("Expected error of invalid marker")
+  }
+}
+
+func TestProcessMergeMarkers(t *testing.T) {
+  a, _ := createTestProcessFiles(t, "Music", []*TestProcessFiles{
+    { "Phish/1995/1995 Sampler/01 a.mp3", &ffprobe.Tags{ Title: "a" } },
+    { "Phish/1995 Sampler/02 b.mp3", &ffprobe.Tags{ Title: "b" } },
+    { "Phish/1995 Sampler/CD1/notes.mp3", &ffprobe.Tags{ Title: "c" } },
+  })
+  dir := filepath.Dir(a.Config.Dir)
+  defer os.RemoveAll(dir)
+
+  files := map[string]string{
+    "Phish/1995 Sampler/.audioc": "keep-flac\n",
+    "Phish/1995 Sampler/.audiocignore": "CD1/\n",
+  }
+  for f, c := range files {
+    err := ioutil.WriteFile(filepath.Join(a.Config.Dir, f), []byte(c), 0644)
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  a.Config.Collection = true
+  a.Config.Write = true
+
+  // markers & ignored files carried into existing album folder
+  err := a.Process()
+  if err != nil {
+    t.Fatal(err)
+  }
+  e := "Phish/1995/1995 Sampler/01 a.mp3,Phish/1995/1995 Sampler/02 b.mp3," +
+    "Phish/1995/1995 Sampler/CD1/notes.mp3"
+  if r := strings.Join(fsutil.FilesAudio(a.Config.Dir), ","); r != filepath.FromSlash(e) {
+    t.Errorf("Expected %v, got %v", e, r)
+  }
+  for f, c := range files {
+    f = filepath.Join(a.Config.Dir, "Phish/1995/1995 Sampler", filepath.Base(f))
+    if b, _ := ioutil.ReadFile(f); string(b) != c {
+      t.Errorf("Expected %v of %q, got %q", f, c, b)
+    }
+  }
+
+  // differing marker within existing album folder is never overwritten
+  os.MkdirAll(filepath.Join(a.Config.Dir, "Phish/1995 Sampler"), 0777)
+  ioutil.WriteFile(filepath.Join(a.Config.Dir, "Phish/1995 Sampler/03 d.mp3"),
+    []byte("{}"), 0644)
+  ioutil.WriteFile(filepath.Join(a.Config.Dir, "Phish/1995 Sampler/.audioc"),
+    []byte("artist = Phish\n"), 0644)
+  if err = a.Process(); err == nil {
+    t.Errorf("Expected error of differing marker")
+  }
+  if _, err = os.Stat(filepath.Join(a.Config.Dir,
+    "Phish/1995 Sampler/03 d.mp3")); err != nil {
+    t.Errorf("Expected folder not merged")
+  }
+}
+
+func TestSync(t *testing.T) {
+  a, _ := createTestProcessFiles(t, "Music", []*TestProcessFiles{
+    { "Phish/1994/1994.10.31 Glens Falls, NY/01 a.flac", &ffprobe.Tags{} },
+    { "Phish/1997/1997.11.22 Hampton, VA/01 b.flac",
+      &ffprobe.Tags{ Artist: "Phish", Title: "b" } },
+    { "Phish/1997/1997.11.22 Hampton, VA/02 c.mp3",
+      &ffprobe.Tags{ Artist: "Phish", Title: "c" } },
+    { "Ween/1997/1997 The Mollusk/01 d.mp3", &ffprobe.Tags{} },
+  })
+  dir := filepath.Dir(a.Config.Dir)
+  defer os.RemoveAll(dir)
+
+  a.Config.To = filepath.Join(dir, "Device")
+  a.Config.Select = "artist=Phish,year>=1995"
+  a.Config.Bitrate = "V0"
+  a.Config.Write = true
+
+  e := []string{ "Phish/1997/1997.11.22 Hampton, VA/01 b.mp3",
+    "Phish/1997/1997.11.22 Hampton, VA/02 c.mp3" }
+
+  // manifest records files synced before failure
+  blocked := filepath.Join(a.Config.To, "Phish/1997/1997.11.22 Hampton, VA",
+    "02 c.audioc-tmp.mp3")
+  os.MkdirAll(filepath.Join(blocked, "x"), 0777)
+  if err := a.Sync(); err == nil {
+    t.Errorf("Expected error of blocked file")
+  }
+  os.RemoveAll(blocked)
+  m, _ := readSyncManifest(a.Config.To)
+  if m[e[0]] == nil || m[e[1]] != nil {
+    t.Errorf("Expected manifest of %v only, got %v", e[0], m)
+  }
+
+  err := a.Sync()
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  files := fsutil.FilesAudio(a.Config.To)
+  if strings.Join(files, ",") != strings.Join(e, ",") {
+    t.Fatalf("Expected %v, got %v", e, files)
+  }
+
+  // converted from FLAC, mp3 copied
+  b, _ := ioutil.ReadFile(filepath.Join(a.Config.To, e[0]))
+  if !strings.Contains(string(b), `"Quality":"V0"`) {
+    t.Errorf("Expected conversion at V0, got %s", b)
+  }
+  tag, err := id3.ReadFile(filepath.Join(a.Config.To, e[1]))
+  if err != nil || tag.Text("TPE2") != "Phish" {
+    t.Errorf("Expected album artist tag, got %v", err)
+  }
+
+  // unchanged files are skipped
+  os.Remove(filepath.Join(a.Config.To, e[1]))
+  ioutil.WriteFile(filepath.Join(a.Config.To, e[0]), []byte("kept"), 0644)
+  err = a.Sync()
+  if err != nil {
+    t.Fatal(err)
+  }
+  b, _ = ioutil.ReadFile(filepath.Join(a.Config.To, e[0]))
+  if string(b) != "kept" {
+    t.Errorf("Expected unchanged file skipped")
+  }
+  if _, err = os.Stat(filepath.Join(a.Config.To, e[1])); err != nil {
+    t.Errorf("Expected missing file synced again")
+  }
+
+  // conversions synced again when --bitrate changes; mp3 copies are not
+  ioutil.WriteFile(filepath.Join(a.Config.To, e[1]), []byte("kept"), 0644)
+  a.Config.Bitrate = "320"
+  err = a.Sync()
+  if err != nil {
+    t.Fatal(err)
+  }
+  b, _ = ioutil.ReadFile(filepath.Join(a.Config.To, e[0]))
+  if !strings.Contains(string(b), `"Quality":"320"`) {
+    t.Errorf("Expected conversion at 320, got %s", b)
+  }
+  b, _ = ioutil.ReadFile(filepath.Join(a.Config.To, e[1]))
+  if string(b) != "kept" {
+    t.Errorf("Expected copied mp3 skipped")
+  }
+
+  // deselected files & emptied folders are removed, untracked files kept
+  ioutil.WriteFile(filepath.Join(a.Config.To, "notes.txt"), []byte{}, 0644)
+  a.Config.Select = "artist=Ween"
+  a.Config.Format = "flac"
+  err = a.Sync()
+  if err != nil {
+    t.Fatal(err)
+  }
+  e = []string{ "Ween/1997/1997 The Mollusk/01 d.mp3" }
+  files = fsutil.FilesAudio(a.Config.To)
+  if strings.Join(files, ",") != strings.Join(e, ",") {
+    t.Fatalf("Expected %v, got %v", e, files)
+  }
+  if _, err = os.Stat(filepath.Join(a.Config.To, "Phish")); err == nil {
+    t.Errorf("Expected empty artist folder removed")
+  }
+  if _, err = os.Stat(filepath.Join(a.Config.To, "notes.txt")); err != nil {
+    t.Errorf("Expected untracked file kept")
+  }
+
+  a.Config.Format = "wav"
+  if err = a.Sync(); err == nil {
+    t.Errorf("Expected error of invalid format")
+  }
+}
+
+func TestSyncBitrate(t *testing.T) {
+  a, _ := createTestProcessFiles(t, "Music", []*TestProcessFiles{
+    { "Phish/1997/1997.11.22 Hampton, VA/01 b.flac", &ffprobe.Tags{} },
+  })
+  dir := filepath.Dir(a.Config.Dir)
+  defer os.RemoveAll(dir)
+
+  bitrates := []string{}
+  a.Ffmpeg = &testExecFfmpeg{ exec: func(args ...string) (string, error) {
+    for x := range args {
+      if args[x] == "-b:a" {
+        bitrates = append(bitrates, args[x+1])
+      }
+    }
+    return "", ioutil.WriteFile(args[len(args)-1], []byte("opus"), 0644)
+  }}
+
+  a.Config.To = filepath.Join(dir, "Device")
+  a.Config.Format = "opus"
+  a.Config.Bitrate = "V0"
+  a.Config.Write = true
+
+  // opus synced again when --bitrate changes
+  for _, br := range []string{ "V0", "V0", "320" } {
+    a.Config.Bitrate = br
+    err := a.Sync()
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+  if strings.Join(bitrates, ",") != "128k,320k" {
+    t.Errorf("Expected 128k,320k, got %v", bitrates)
+  }
+
+  m, _ := readSyncManifest(a.Config.To)
+  e := m["Phish/1997/1997.11.22 Hampton, VA/01 b.opus"]
+  if e == nil || e.Bitrate != "320k" {
+    t.Errorf("Expected manifest bitrate 320k, got %+v", e)
+  }
+}
+
+func TestSyncPath(t *testing.T) {
+  dir, _ := fsutil.CreateTestFiles(t, []*fsutil.TestFile{
+    { Name: "phish/notes.txt", Contents: "" },
+  })
+  defer os.RemoveAll(dir)
+
+  a := &audioc{ Config: &Config{}, Profile: fsprofile.Fat32 }
+  a.Paths = a.Profile.NewPaths(dir)
+
+  // device folder case kept; names differing only by case never collide
+  tests := map[string]string{
+    "Phish/1997/Hampton, VA/01 a.flac": "phish/1997/Hampton, VA/01 a.mp3",
+    "Phish/1997/Hampton, VA/01 A.mp3": "phish/1997/Hampton, VA/01 A (2).mp3",
+  }
+  for _, f := range []string{ "Phish/1997/Hampton, VA/01 a.flac",
+    "Phish/1997/Hampton, VA/01 A.mp3" } {
+    if p := a.syncPath(f, ".mp3"); p != filepath.FromSlash(tests[f]) {
+      t.Errorf("Expected %v, got %v", tests[f], p)
+    }
+  }
+}
+
+func TestMapTags(t *testing.T) {
+  rules := tagmap.NewRules()
+  rules.Drop["LYRICS"] = true
+  rules.Rename["ARTIST SORT"] = "ARTISTSORT"
+  rules.Set["phish"] = map[string]string{ "GENRE": "Jam" }
+
+  a := &audioc{ Config: &Config{}, TagRules: rules }
+  i := &metadata.Info{ Artist: "Phish", Comment: "SBD" }
+  source := map[string]string{ "TPE1": "Phish", "TCOM": "Anastasio",
+    "USLT": "words", "ARTIST SORT": "Phish", "COMM": "SBD" }
+
+  tests := []struct {
+    inPlace bool
+    tags map[string]string
+  }{
+    { inPlace: false, tags: map[string]string{ "ALBUMARTIST": "Phish",
+      "COMPOSER": "Anastasio", "LYRICS": "", "ARTIST SORT": "",
+      "ARTISTSORT": "Phish", "COMMENT": "SBD", "GENRE": "Jam" } },
+    { inPlace: true, tags: map[string]string{ "ALBUMARTIST": "Phish",
+      "LYRICS": "", "ARTIST SORT": "", "ARTISTSORT": "Phish", "GENRE": "Jam" } },
+  }
+
+  for _, tt := range tests {
+    tags := a.mapTags(source, i, tt.inPlace)
+    if len(tags) != len(tt.tags) {
+      t.Errorf("Expected %v, got %v", tt.tags, tags)
+      continue
+    }
+    for k, v := range tt.tags {
+      if tags[k] != v {
+        t.Errorf("%v: Expected %q, got %q", k, v, tags[k])
+      }
+    }
+  }
+  // aliases compared in sorted order: "GENRE" (not "TCON") is existing genre
+  source = map[string]string{ "TPE1": "Phish", "TCON": "Jam", "GENRE": "Rock" }
+  for x := 0; x < 20; x++ {
+    if g := a.mapTags(source, i, true)["GENRE"]; g != "Jam" {
+      t.Fatalf("Expected %q, got %q", "Jam", g)
+    }
+  }
+}
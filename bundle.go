@@ -25,8 +25,31 @@ func (a *audioc) processBundle(indexes []int) error {
     return nil
   }
 
+  // sibling disc folders (ie CD1, CD2) are processed as one album
+  a.DiscDirs = a.discDirs(indexes)
+  if len(a.DiscDirs) > 0 {
+    fullDir = filepath.Dir(fullDir)
+  }
+
   fmt.Printf("\nProcessing: %v ...\n", fullDir)
 
+  // track & disc totals; warns of gaps in track numbering
+  a.processTotals(indexes)
+
+  // probe files once, before album artist & lookup need their tags
+  a.probeThreaded(indexes)
+
+  // album artist when track artists differ (ie compilation)
+  a.processArtists(indexes)
+
+  // validate existing checksum manifests (if --checksums)
+  if a.Config.Checksums {
+    err = a.validateChecksums(fullDir)
+    if err != nil {
+      return err
+    }
+  }
+
   if a.Config.Write {
     // create new random workdir within current path
     a.Workdir, err = ioutil.TempDir(fullDir, "")
@@ -35,19 +58,41 @@ func (a *audioc) processBundle(indexes []int) error {
     }
   }
 
-  // process artwork once per folder
-  err = a.processArtwork(a.Files[indexes[0]])
+  // recording source from info text files within folder
+  a.SourceInfo = sourceFromTextFiles(fullDir)
+
+  // match studio albums against release lookup (if provided)
+  err = a.processLookup(indexes)
+  if err != nil {
+    return err
+  }
+
+  // process artwork once per folder (after lookup to query covers by id)
+  err = a.processArtwork(indexes[0])
+  if err != nil {
+    return err
+  }
+
+  // encode live performance as one stream (if --gapless)
+  err = a.processGapless(indexes)
   if err != nil {
     return err
   }
 
   // process folder via threads returning the resulting metadata slice
   // a.processThreaded (thread.go) calls a.processFile(file.go) for each index
+  a.Gains = []*trackGain{}
   mdSlice, err := a.processThreaded(indexes)
   if err != nil {
     return err
   }
 
+  // album gain requires all tracks, so written after all workers finish
+  err = a.processReplayGain(len(indexes))
+  if err != nil {
+    return err
+  }
+
   if a.Config.Write {
     // explicitly remove workdir (before folder is possibly renamed)
     os.RemoveAll(a.Workdir)
@@ -56,18 +101,84 @@ func (a *audioc) processBundle(indexes []int) error {
     // assuming all belong to same resulting directory
     fullResultD := filepath.Dir(filepath.Join(a.Config.Dir, mdSlice[0].Resultpath))
 
+    if len(a.DiscDirs) > 0 {
+      // album folder is parent of disc folder
+      if len(metadata.DiscFolder(filepath.Base(fullResultD))) > 0 {
+        fullResultD = filepath.Dir(fullResultD)
+      }
+
+      // move disc folder contents into album folder (if --flatten)
+      if a.Config.Flatten {
+        err = a.flattenDiscs(fullDir)
+        if err != nil {
+          return err
+        }
+      }
+    }
+
     // if not same dir, rename directory to target dir
     if fullDir != fullResultD {
-      _, err = fsutil.MergeFolder(fullDir, fullResultD, mergeFolderFunc)
+      // set companion, marker & ignored files aside when target dir exists,
+      // as MergeFolder discards them, merges ignored audio or diverts audio
+      // into "<album> (1)"
+      var stash string
+      if _, err := os.Stat(fullResultD); err == nil {
+        err = markersConflict(fullDir, fullResultD)
+        if err != nil {
+          return err
+        }
+
+        ignored, err := a.ignoredFiles(fullDir)
+        if err != nil {
+          return err
+        }
+        stash, err = stashCompanions(fullDir, ignored)
+        if len(stash) > 0 {
+          defer os.RemoveAll(stash)
+        }
+        if err != nil {
+          return err
+        }
+      }
+
+      fullResultD, err = fsutil.MergeFolder(fullDir, fullResultD, mergeFolderFunc)
+      if err != nil {
+        return err
+      }
+
+      // merge companion & marker files into resulting dir
+      if len(stash) > 0 {
+        err = mergeCompanions(stash, fullResultD)
+        if err != nil {
+          return err
+        }
+        err = mergeMarkers(stash, fullResultD)
+        if err != nil {
+          return err
+        }
+        os.RemoveAll(stash)
+      }
+    }
+
+    // dedupe, rename & move companion files (ie .txt, .cue, .log)
+    err = a.organizeCompanions(fullResultD)
+    if err != nil {
+      return err
+    }
+
+    // regenerate checksum manifests for resulting filenames
+    if a.Config.Checksums {
+      err = a.writeChecksums(fullResultD)
       if err != nil {
         return err
       }
     }
 
-    // remove parent folder if no longer contains audio files
+    // remove parent folder if no longer contains audio files (or markers)
     parentDir := filepath.Dir(fullDir)
     if info, err := os.Stat(parentDir); err == nil && info.IsDir() {
-      if len(fsutil.FilesAudio(parentDir)) == 0 {
+      if len(fsutil.FilesAudio(parentDir)) == 0 &&
+        len(markerFiles(parentDir)) == 0 {
         // is a directory (not symlink) and contains no audio files
         err = os.RemoveAll(parentDir)
         if err != nil {
@@ -83,6 +194,11 @@ func (a *audioc) processBundle(indexes []int) error {
 // helper to determine if bundle should be skipped by analyzing the
 // first audio files album folder
 func (a *audioc) skipFolder(path string) bool {
+  // folder marked skip (.audioc)
+  if a.marker(path).Skip {
+    return true
+  }
+
   pa := strings.Split(path, fsutil.PathSep)
 
   // determine which folder in path is the album name
@@ -101,6 +217,11 @@ func (a *audioc) skipFolder(path string) bool {
     if len(pa) > 1 {
       alb = pa[len(pa)-2]
     }
+
+    // album is parent of disc folder (ie Album/CD1)
+    if len(pa) > 2 && len(metadata.DiscFolder(alb)) > 0 {
+      alb = pa[len(pa)-3]
+    }
   }
 
   // true if album folder matches metadata.ToAlbum
@@ -113,7 +234,7 @@ func (a *audioc) skipFolder(path string) bool {
     } else {
       // derive metadata from album folder and see if it matches
       m := metadata.New(alb)
-      if m.Info.ToAlbum() == alb {
+      if a.folderName(m.Info.ToAlbum()) == alb {
         return true
       }
     }
@@ -123,25 +244,89 @@ func (a *audioc) skipFolder(path string) bool {
 }
 
 // process album art once per folder of files
-func (a *audioc) processArtwork(file string) error {
+func (a *audioc) processArtwork(index int) error {
+  file := a.Files[index]
   art := &albumart.AlbumArt{ Ffmpeg: a.Ffmpeg, Ffprobe: a.Ffprobe,
     ImgDecode: image.DecodeConfig, WithParentDir: true,
-    Fullpath: filepath.Join(a.Config.Dir, file) }
+    Fullpath: filepath.Join(a.Config.Dir, file), Covers: a.Covers,
+    Options: a.ArtOptions }
+
+  // FLAC kept as is (folder ends with " - FLAC" or marked keep-flac)
+  if a.keepFlac(file) {
+    art.Options = a.ArtOptionsFlac
+  }
+
+  // query cover provider by matched release or artist & album
+  if a.Covers != nil {
+    i := a.InfoFromConfig(index)
+    art.Query = &albumart.CoverQuery{ Artist: i.ToArtist(),
+      Album: metadata.New(file).Info.Album }
+    if len(i.Album) > 0 {
+      art.Query.Album = metadata.New(i.Album).Info.Album
+    }
+    if a.Release != nil {
+      art.Query.MBID = a.Release.ID
+    }
+  }
+
+  // placeholder cover for live performances without artwork
+  if a.Placeholder != nil {
+    i := metadata.New(file).Info
+    if i.IsLive() {
+      art.Placeholder = a.Placeholder
+      art.PlaceholderText = &albumart.PlaceholderText{
+        Artist: a.InfoFromConfig(index).ToArtist(), Year: i.Year, Month: i.Month,
+        Day: i.Day, Venue: i.Album }
+    }
+  }
 
   var err error
-  a.Image = ""
+  a.Image, a.Pictures = "", []*albumart.Image{}
 
   if a.Config.Write {
     a.Image, err = albumart.Process(art)
+    if err != nil {
+      return err
+    }
+
+    // typed artwork (ie back, disc) kept alongside front cover
+    a.Pictures = albumart.Classify(filepath.Dir(art.Fullpath),
+      image.DecodeConfig)
   }
 
   return err
 }
 
+// source & archive ID from .txt or .nfo files directly within dir
+func sourceFromTextFiles(dir string) *metadata.Info {
+  i := &metadata.Info{}
+  for _, f := range fsutil.FilesByExtension(dir, []string{ "nfo", "txt" }) {
+    if strings.Contains(f, fsutil.PathSep) {
+      continue
+    }
+
+    b, err := ioutil.ReadFile(filepath.Join(dir, f))
+    if err != nil {
+      continue
+    }
+
+    t := metadata.SourceFromText(string(b))
+    if len(i.Source) == 0 {
+      i.Source = t.Source
+    }
+    if len(i.SourceID) == 0 {
+      i.SourceID = t.SourceID
+    }
+  }
+  return i
+}
+
 // passed to fsutil.MergeFolder, this only merges files into the same folder
 // if the disc and track number don't already exist in a current file, else it
 // creates an equivalent folder with (1) appended to end, copying conflicting
 // files to this location. {Info.title} is currently not used, only disc/track.
+// only audio files are indexed; companion files are set aside beforehand by
+// stashCompanions & merged afterward by mergeCompanions (companion.go)
 func mergeFolderFunc(f string) (int, string) {
   // use metadata to obtain info from filename
   m := metadata.New(f)
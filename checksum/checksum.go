@@ -0,0 +1,152 @@
+package checksum
+
+import (
+  "io"
+  "os"
+  "fmt"
+  "bufio"
+  "errors"
+  "regexp"
+  "strings"
+  "crypto/md5"
+  "encoding/hex"
+  "path/filepath"
+
+  "github.com/jamlib/audioc/flac"
+)
+
+// manifest kinds by file extension
+const (
+  // md5 of entire file
+  MD5 = "md5"
+  // md5 of unencoded audio stored within FLAC STREAMINFO
+  FFP = "ffp"
+  // md5 of decoded audio (shntool)
+  ST5 = "st5"
+)
+
+// sorted, for use with fsutil.FilesByExtension
+var Exts = []string{ FFP, MD5, ST5 }
+
+type Entry struct {
+  Name, Hash string
+}
+
+type Manifest struct {
+  Kind string
+  Entries []*Entry
+}
+
+// read manifest, kind determined by file extension
+func Read(file string) (*Manifest, error) {
+  f, err := os.Open(file)
+  if err != nil {
+    return &Manifest{}, err
+  }
+  defer f.Close()
+
+  return Parse(strings.ToLower(strings.TrimPrefix(filepath.Ext(file), ".")), f)
+}
+
+var lineRegexps = map[string]string{
+  // pattern: 'hash *name', 'hash  name'
+  MD5: `^([0-9A-Fa-f]{32})\s+\*?(.+)$`,
+  // pattern: 'name:hash'
+  FFP: `^(.+):([0-9A-Fa-f]{32})$`,
+  // pattern: 'hash  [shntool]  name'
+  ST5: `^([0-9A-Fa-f]{32})\s+(?:\[shntool\]\s+)?(.+)$`,
+}
+
+func Parse(kind string, r io.Reader) (*Manifest, error) {
+  m := &Manifest{ Kind: kind }
+
+  re, ok := lineRegexps[kind]
+  if !ok {
+    return m, fmt.Errorf("Unknown checksum manifest: %s", kind)
+  }
+
+  s := bufio.NewScanner(r)
+  for s.Scan() {
+    line := strings.TrimSpace(strings.TrimPrefix(s.Text(), "\ufeff"))
+    if len(line) == 0 || strings.HasPrefix(line, ";") ||
+      strings.HasPrefix(line, "#") {
+      continue
+    }
+
+    match := regexp.MustCompile(re).FindStringSubmatch(line)
+    if len(match) < 3 {
+      continue
+    }
+
+    e := &Entry{ Name: match[2], Hash: match[1] }
+    if kind == FFP {
+      e.Name, e.Hash = match[1], match[2]
+    }
+
+    // names may use windows path separators
+    e.Name = filepath.FromSlash(strings.Replace(e.Name, "\\", "/", -1))
+    e.Hash = strings.ToLower(e.Hash)
+    m.Entries = append(m.Entries, e)
+  }
+
+  return m, s.Err()
+}
+
+func (m *Manifest) Write(w io.Writer) error {
+  for _, e := range m.Entries {
+    var err error
+    switch m.Kind {
+    case FFP:
+      _, err = fmt.Fprintf(w, "%s:%s\n", filepath.ToSlash(e.Name), e.Hash)
+    case ST5:
+      _, err = fmt.Fprintf(w, "%s  [shntool]  %s\n", e.Hash, filepath.ToSlash(e.Name))
+    default:
+      _, err = fmt.Fprintf(w, "%s *%s\n", e.Hash, filepath.ToSlash(e.Name))
+    }
+    if err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func (m *Manifest) WriteFile(file string) error {
+  f, err := os.Create(file)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+
+  return m.Write(f)
+}
+
+// md5 of entire file
+func FileMD5(file string) (string, error) {
+  f, err := os.Open(file)
+  if err != nil {
+    return "", err
+  }
+  defer f.Close()
+
+  h := md5.New()
+  if _, err = io.Copy(h, f); err != nil {
+    return "", err
+  }
+  return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// md5 of unencoded audio stored within FLAC STREAMINFO
+func FlacMD5(file string) (string, error) {
+  blocks, err := flac.ReadFile(file)
+  if err != nil {
+    return "", err
+  }
+  i, err := flac.ReadInfo(blocks)
+  if err != nil {
+    return "", err
+  }
+  if len(i.MD5) == 0 {
+    return "", errors.New("FLAC MD5 not set")
+  }
+  return i.MD5, nil
+}
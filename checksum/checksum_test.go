@@ -0,0 +1,101 @@
+package checksum
+
+import (
+  "os"
+  "bytes"
+  "strings"
+  "testing"
+  "path/filepath"
+
+  "github.com/jamlib/libaudio/fsutil"
+)
+
+func TestParse(t *testing.T) {
+  tests := []struct {
+    kind, input string
+    entries []Entry
+  }{
+    { kind: MD5,
+      input: "; comment\nD41D8CD98F00B204E9800998ECF8427E *cd1\\01 a.flac\n" +
+        "0123456789abcdef0123456789abcdef  02 b.flac\nnot a line\n",
+      entries: []Entry{
+        { Name: filepath.FromSlash("cd1/01 a.flac"),
+          Hash: "d41d8cd98f00b204e9800998ecf8427e" },
+        { Name: "02 b.flac", Hash: "0123456789abcdef0123456789abcdef" },
+      },
+    },{
+      kind: FFP,
+      input: "gd77-05-08d1t01.flac:0123456789ABCDEF0123456789ABCDEF\r\n",
+      entries: []Entry{
+        { Name: "gd77-05-08d1t01.flac", Hash: "0123456789abcdef0123456789abcdef" },
+      },
+    },{
+      kind: ST5,
+      input: "0123456789abcdef0123456789abcdef  [shntool]  d1t01.shn\n",
+      entries: []Entry{
+        { Name: "d1t01.shn", Hash: "0123456789abcdef0123456789abcdef" },
+      },
+    },
+  }
+
+  for x := range tests {
+    m, err := Parse(tests[x].kind, strings.NewReader(tests[x].input))
+    if err != nil {
+      t.Fatal(err)
+    }
+    if len(m.Entries) != len(tests[x].entries) {
+      t.Fatalf("Expected %v entries, got %v", len(tests[x].entries), len(m.Entries))
+    }
+    for y := range m.Entries {
+      if *m.Entries[y] != tests[x].entries[y] {
+        t.Errorf("Expected %v, got %v", tests[x].entries[y], *m.Entries[y])
+      }
+    }
+  }
+
+  if _, err := Parse("sfv", strings.NewReader("")); err == nil {
+    t.Errorf("Expected error, got none.")
+  }
+}
+
+func TestWrite(t *testing.T) {
+  tests := []struct {
+    kind, result string
+  }{
+    { kind: MD5, result: "abc *cd1/01 a.flac\n" },
+    { kind: FFP, result: "cd1/01 a.flac:abc\n" },
+    { kind: ST5, result: "abc  [shntool]  cd1/01 a.flac\n" },
+  }
+
+  for x := range tests {
+    m := &Manifest{ Kind: tests[x].kind, Entries: []*Entry{
+      { Name: filepath.FromSlash("cd1/01 a.flac"), Hash: "abc" } } }
+
+    var b bytes.Buffer
+    if err := m.Write(&b); err != nil {
+      t.Fatal(err)
+    }
+    if b.String() != tests[x].result {
+      t.Errorf("Expected %q, got %q", tests[x].result, b.String())
+    }
+  }
+}
+
+func TestFileMD5(t *testing.T) {
+  dir, paths := fsutil.CreateTestFiles(t, []*fsutil.TestFile{
+    { Name: "empty.flac" },
+  })
+  defer os.RemoveAll(dir)
+
+  h, err := FileMD5(paths[0])
+  if err != nil {
+    t.Fatal(err)
+  }
+  if h != "d41d8cd98f00b204e9800998ecf8427e" {
+    t.Errorf("Expected %v, got %v", "d41d8cd98f00b204e9800998ecf8427e", h)
+  }
+
+  if _, err := FlacMD5(paths[0]); err == nil {
+    t.Errorf("Expected error, got none.")
+  }
+}
@@ -0,0 +1,139 @@
+package audioc
+
+import (
+  "os"
+  "fmt"
+  "regexp"
+  "strings"
+  "path/filepath"
+
+  "github.com/jamlib/libaudio/fsutil"
+  "github.com/jamlib/audioc/checksum"
+)
+
+// checksum manifests directly within dir
+func checksumManifests(dir string) []string {
+  files := []string{}
+  for _, f := range fsutil.FilesByExtension(dir, checksum.Exts) {
+    if !strings.Contains(f, fsutil.PathSep) {
+      files = append(files, f)
+    }
+  }
+  return files
+}
+
+// validate existing checksum manifests within dir, printing results
+func (a *audioc) validateChecksums(dir string) error {
+  for _, f := range checksumManifests(dir) {
+    m, err := checksum.Read(filepath.Join(dir, f))
+    if err != nil {
+      fmt.Printf("  * checksums %v: %v\n", f, err)
+      continue
+    }
+
+    ok, failed, missing := 0, []string{}, []string{}
+    for _, e := range m.Entries {
+      p := filepath.Join(dir, e.Name)
+      if _, err := os.Stat(p); err != nil {
+        missing = append(missing, e.Name)
+        continue
+      }
+
+      h, err := a.checksum(m.Kind, p)
+      if err != nil || h != e.Hash {
+        failed = append(failed, e.Name)
+        continue
+      }
+      ok++
+    }
+
+    fmt.Printf("  * checksums %v: %d ok, %d failed, %d missing\n", f, ok,
+      len(failed), len(missing))
+    for _, n := range failed {
+      fmt.Printf("    failed: %v\n", n)
+    }
+    for _, n := range missing {
+      fmt.Printf("    missing: %v\n", n)
+    }
+  }
+
+  return nil
+}
+
+// replace checksum manifests within dir with md5 of all audio files & ffp of
+// FLAC files (& st5 of FLAC files, if one existed), named after dir
+func (a *audioc) writeChecksums(dir string) error {
+  st5 := &checksum.Manifest{ Kind: checksum.ST5 }
+  hasST5 := false
+  for _, f := range checksumManifests(dir) {
+    if strings.ToLower(filepath.Ext(f)) == "." + checksum.ST5 {
+      hasST5 = true
+    }
+    err := os.Remove(filepath.Join(dir, f))
+    if err != nil {
+      return err
+    }
+  }
+
+  md5 := &checksum.Manifest{ Kind: checksum.MD5 }
+  ffp := &checksum.Manifest{ Kind: checksum.FFP }
+
+  for _, f := range fsutil.FilesAudio(dir) {
+    p := filepath.Join(dir, f)
+
+    h, err := checksum.FileMD5(p)
+    if err != nil {
+      return err
+    }
+    md5.Entries = append(md5.Entries, &checksum.Entry{ Name: f, Hash: h })
+
+    if strings.ToLower(filepath.Ext(f)) == ".flac" {
+      h, err = checksum.FlacMD5(p)
+      if err == nil {
+        ffp.Entries = append(ffp.Entries, &checksum.Entry{ Name: f, Hash: h })
+      }
+
+      if hasST5 {
+        h, err = a.checksum(checksum.ST5, p)
+        if err != nil {
+          return err
+        }
+        st5.Entries = append(st5.Entries, &checksum.Entry{ Name: f, Hash: h })
+      }
+    }
+  }
+
+  base := filepath.Join(dir, filepath.Base(dir))
+  for _, m := range []*checksum.Manifest{ md5, ffp, st5 } {
+    if len(m.Entries) == 0 {
+      continue
+    }
+    err := m.WriteFile(base + "." + m.Kind)
+    if err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
+
+// checksum of file by manifest kind
+func (a *audioc) checksum(kind, file string) (string, error) {
+  switch kind {
+  case checksum.FFP:
+    return checksum.FlacMD5(file)
+  case checksum.ST5:
+    // md5 of decoded audio at bit depth of source (as shntool)
+    out, err := a.Ffmpeg.Exec([]string{ "-v", "error", "-i", file, "-map",
+      "0:a", "-c:a", pcmCodec(sourceBits(file)), "-f", "md5", "-" }...)
+    if err != nil {
+      return "", err
+    }
+    m := regexp.MustCompile(`MD5=([0-9a-f]{32})`).FindStringSubmatch(out)
+    if len(m) < 2 {
+      return "", fmt.Errorf("Audio MD5 not found: %s", file)
+    }
+    return m[1], nil
+  }
+  return checksum.FileMD5(file)
+}
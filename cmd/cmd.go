@@ -28,7 +28,18 @@ func main() {
   // audioc.New & a.Process found within ../audioc.go
   a := audioc.New(c, ffm, ffp)
 
-  err = a.Process()
+  switch c.Command {
+  case "dupes":
+    err = a.Dupes()
+  case "fingerprint":
+    err = a.Fingerprints()
+  case "sync":
+    err = a.Sync()
+  case "verify":
+    err = a.Verify()
+  default:
+    err = a.Process()
+  }
   if err != nil {
     log.Fatal(err)
   }
@@ -23,8 +23,22 @@ const printUsage = `
 audioc v%s
 %s
 
-Usage: audioc [MODE] [OPTIONS] PATH
+Usage: audioc [COMMAND] [MODE] [OPTIONS] PATH
 %s
+COMMAND (optional):
+  dupes
+    report albums held more than once and which copy to keep
+
+  fingerprint --fingerprint "FILE"
+    build fingerprint database from organized collection, print duplicates
+
+  sync --to "DEVICE" [--format "FORMAT"] [--select "CONDITIONS"]
+    mirror library (PATH or --from "LIBRARY") to device, copying only new or
+    changed files & removing files no longer selected
+
+  verify
+    fully decode each audio file, reporting damaged or silent files
+
 MODE (specify only one):
   --artist "ARTIST" --album "ALBUM"
     treat as specific album belonging to specific artist
@@ -36,18 +50,116 @@ MODE (specify only one):
     treat as collection of artists
 
 OPTIONS:
+  --artwork "OPTIONS"
+    artwork size, quality & format, ie "size=300,quality=85,baseline,no-orig"
+
+  --artwork-flac "OPTIONS"
+    artwork options for FLAC folders (default --artwork)
+
   --bitrate "BITRATE"
     V0 (default)
       convert to variable 256kbps mp3
     320
       convert to constant 320kbps mp3
 
+  --checksums
+    validate checksum manifests, then regenerate for resulting files
+
+  --companions
+    remove duplicate companion files (ie .txt, .cue, .log) & rename lone ones
+    after album
+
+  --covers "DIR OR URL"
+    fetch missing artwork from folder of covers or Cover Art Archive service
+
+  --covers-cache "DIR"
+    cache fetched covers within folder
+
+  --exclude "CONDITIONS"
+    skip albums whose files all match, ie "artwork=yes" (fields as --include)
+
+  --extras
+    move text, log, cue & video files into extras/ subfolder
+
+  --filenames "MODE"
+    strict (default)
+      only A-Za-z0-9 & a few punctuation marks
+    unicode
+      keep unicode, removing only characters illegal within filenames
+    ascii
+      transliterate unicode to ASCII (ie "ó" to "o"), then as strict
+
+  --filesystem "PROFILE"
+    posix (default)
+      Linux, macOS & other posix filesystems
+    windows
+      NTFS & SMB shares: no <>:"/\|?*, trailing dots, CON, AUX, etc
+    fat32
+      FAT32 & exFAT (ie portable players), as windows
+
+  --fingerprint "FILE OR URL"
+    identify untitled tracks with fingerprint database or lookup service
+
+  --fingerprint-key "KEY"
+    client key for fingerprint lookup service
+
   --fix
     fixes incorrect track length, ie 1035:36:51
 
+  --flatten
+    move disc folders (ie CD1, CD2) of multi-disc albums into album folder
+
   --force
     processes all files, even if path info matches tag info
 
+  --format "FORMAT"
+    sync format: mp3 (default), opus or aac (per --bitrate), or flac
+
+  --gapless
+    encode live performances as one stream split at exact track boundaries
+
+  --include "CONDITIONS"
+    process only albums with matching files, ie "artist=Phish,year>=1990"
+
+  --lookup "FILE OR URL"
+    match studio albums against MusicBrainz JSON dump or web service
+
+  --lookup-threshold "SCORE"
+    minimum match score from 0 to 1 (default 0.9)
+
+  --placeholder
+    render cover for live performances without artwork
+
+  --placeholder-colors "FILE"
+    per artist colors, one per line: Artist Name = #background, #foreground
+
+  --placeholder-template "TEMPLATE"
+    placeholder lines separated by | (default "{artist}|{date}|{venue}")
+
+  --prefer-format "FORMATS"
+    dupes format preference (default "FLAC,V0,320")
+
+  --prefer-source "SOURCES"
+    dupes source preference (default "SBD,MATRIX,FM,AUD")
+
+  --replaygain
+    analyze loudness, writing track & album ReplayGain tags
+
+  --select "CONDITIONS"
+    sync only matching files, ie "artist=Phish,year>=1995" (= != < <= > >=)
+
+  --tag-rules "FILE"
+    source tags kept, dropped, renamed or set per artist, one rule per line
+
+  --title-case
+    title case track titles, keeping small words & acronyms
+
+  --titles "FILE"
+    per artist song title corrections, one per line: Artist: wrong = Right
+
+  --verify
+    verify each source before converting, keeping sources that fail
+
   --write
     write changes to disk
 
@@ -56,21 +168,70 @@ Debug:
     print program version, then exit
 `
 
+// commands other than processing PATH
+var commands = []string{ "dupes", "fingerprint", "sync", "verify" }
+
 func configFromFlags() (*audioc.Config, bool) {
   c := audioc.Config{}
   flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 
+  // command must be first argument
+  args := os.Args[1:]
+  if len(args) > 0 {
+    for x := range commands {
+      if args[0] == commands[x] {
+        c.Command = commands[x]
+        args = args[1:]
+        break
+      }
+    }
+  }
+
   // set mode
   flags.StringVar(&c.Album, "album", "", "")
   flags.StringVar(&c.Artist, "artist", "", "")
   flags.BoolVar(&c.Collection, "collection", false, "")
 
   // set options
+  flags.StringVar(&c.Artwork, "artwork", "", "")
+  flags.StringVar(&c.ArtworkFlac, "artwork-flac", "", "")
   flags.StringVar(&c.Bitrate, "bitrate", "V0", "")
+  flags.BoolVar(&c.Checksums, "checksums", false, "")
+  flags.StringVar(&c.Covers, "covers", "", "")
+  flags.StringVar(&c.CoversCache, "covers-cache", "", "")
+  flags.StringVar(&c.Exclude, "exclude", "", "")
+  flags.BoolVar(&c.Companions, "companions", false, "")
+  flags.BoolVar(&c.Extras, "extras", false, "")
+  flags.StringVar(&c.Filenames, "filenames", "strict", "")
+  flags.StringVar(&c.Filesystem, "filesystem", "posix", "")
+  flags.StringVar(&c.Fingerprint, "fingerprint", "", "")
+  flags.StringVar(&c.FingerprintKey, "fingerprint-key", "", "")
   flags.BoolVar(&c.Fix, "fix", false, "")
+  flags.BoolVar(&c.Flatten, "flatten", false, "")
   flags.BoolVar(&c.Force, "force", false, "")
+  flags.StringVar(&c.Format, "format", "mp3", "")
+  flags.BoolVar(&c.Gapless, "gapless", false, "")
+  flags.StringVar(&c.Include, "include", "", "")
+  flags.StringVar(&c.Lookup, "lookup", "", "")
+  flags.BoolVar(&c.Placeholder, "placeholder", false, "")
+  flags.StringVar(&c.PlaceholderColors, "placeholder-colors", "", "")
+  flags.StringVar(&c.PlaceholderTemplate, "placeholder-template", "", "")
+  flags.StringVar(&c.PreferFormat, "prefer-format", "FLAC,V0,320", "")
+  flags.StringVar(&c.PreferSource, "prefer-source", "SBD,MATRIX,FM,AUD", "")
+  flags.Float64Var(&c.LookupThreshold, "lookup-threshold", 0.9, "")
+  flags.BoolVar(&c.ReplayGain, "replaygain", false, "")
+  flags.StringVar(&c.Select, "select", "", "")
+  flags.StringVar(&c.TagRules, "tag-rules", "", "")
+  flags.BoolVar(&c.TitleCase, "title-case", false, "")
+  flags.StringVar(&c.To, "to", "", "")
+  flags.StringVar(&c.Titles, "titles", "", "")
+  flags.BoolVar(&c.Verify, "verify", false, "")
   flags.BoolVar(&c.Write, "write", false, "")
 
+  // sync library (alternative to PATH)
+  var from string
+  flags.StringVar(&from, "from", "", "")
+
   // set debug options
   var printVersion bool
   flags.BoolVar(&printVersion, "version", false, "")
@@ -82,7 +243,7 @@ func configFromFlags() (*audioc.Config, bool) {
   }
 
   // process flags
-  flags.Parse(os.Args[1:])
+  flags.Parse(args)
   a := flags.Args()
 
   // --version
@@ -91,17 +252,41 @@ func configFromFlags() (*audioc.Config, bool) {
     return &c, false
   }
 
+  // sync library may be given as --from instead of PATH
+  if c.Command == "sync" && len(a) == 0 && len(from) > 0 {
+    a = []string{ from }
+  }
+
   // show --help unless args
   if len(a) != 1 {
     flags.Usage()
     return &c, false
   }
 
-  // must specify proper MODE
-  if !c.Collection && c.Artist == "" {
-    fmt.Printf("\nError: Must provide a valid MODE\n")
-    flags.Usage()
-    return &c, false
+  switch c.Command {
+  case "fingerprint":
+    // must specify database file
+    if c.Fingerprint == "" {
+      fmt.Printf("\nError: Must provide --fingerprint database file\n")
+      flags.Usage()
+      return &c, false
+    }
+  case "sync":
+    // must specify device folder
+    if c.To == "" {
+      fmt.Printf("\nError: Must provide --to device folder\n")
+      flags.Usage()
+      return &c, false
+    }
+  case "verify":
+    // MODE not required
+  default:
+    // must specify proper MODE
+    if !c.Collection && c.Artist == "" {
+      fmt.Printf("\nError: Must provide a valid MODE\n")
+      flags.Usage()
+      return &c, false
+    }
   }
 
   // default to V0 unless 320 specified
@@ -109,6 +294,11 @@ func configFromFlags() (*audioc.Config, bool) {
     c.Bitrate = "V0"
   }
 
+  // default to strict unless unicode or ascii specified
+  if c.Filenames != "unicode" && c.Filenames != "ascii" {
+    c.Filenames = "strict"
+  }
+
   c.Dir = filepath.Clean(a[0])
   return &c, true
 }
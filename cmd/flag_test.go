@@ -49,3 +49,39 @@ func TestProcessFlagsCollection(t *testing.T) {
     t.Errorf("Expected %v, got %v", true, cont)
   }
 }
+
+func TestProcessFlagsFingerprint(t *testing.T) {
+  os.Args = []string{"audioc", "fingerprint", "."}
+
+  if _, cont := configFromFlags(); cont == true {
+    t.Errorf("Expected %v, got %v", false, cont)
+  }
+
+  os.Args = []string{"audioc", "fingerprint", "--fingerprint", "fp.json", "."}
+
+  c, cont := configFromFlags()
+  if cont == false {
+    t.Errorf("Expected %v, got %v", true, cont)
+  }
+  if c.Command != "fingerprint" {
+    t.Errorf("Expected %v, got %v", "fingerprint", c.Command)
+  }
+}
+
+func TestProcessFlagsSync(t *testing.T) {
+  os.Args = []string{"audioc", "sync", "--from", "music"}
+  if _, cont := configFromFlags(); cont == true {
+    t.Errorf("Expected %v, got %v", false, cont)
+  }
+
+  os.Args = []string{"audioc", "sync", "--from", "music", "--to", "device",
+    "--format", "opus", "--select", "artist=Phish,year>=1995"}
+  c, cont := configFromFlags()
+  if cont == false {
+    t.Errorf("Expected %v, got %v", true, cont)
+  }
+  if c.Command != "sync" || c.Dir != "music" || c.To != "device" ||
+    c.Format != "opus" || c.Select != "artist=Phish,year>=1995" {
+    t.Errorf("Unexpected sync config %v", c)
+  }
+}
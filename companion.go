@@ -0,0 +1,266 @@
+package audioc
+
+import (
+  "os"
+  "fmt"
+  "sort"
+  "regexp"
+  "io/ioutil"
+  "strings"
+  "path/filepath"
+
+  "github.com/jamlib/libaudio/fsutil"
+  "github.com/jamlib/audioc/checksum"
+)
+
+// non-audio files kept alongside audio, by kind
+var companionExts = map[string][]string{
+  "checksum": { "ffp", "md5", "sfv", "st5" },
+  "cue": { "cue" },
+  "image": { "gif", "jpeg", "jpg", "png" },
+  "log": { "log" },
+  "text": { "nfo", "rtf", "txt" },
+  "video": { "avi", "m4v", "mkv", "mov", "mpg", "vob" },
+}
+
+// kinds renamed after album when only one exists (ie "gd77-05-08.txt")
+var companionRenameKinds = []string{ "cue", "log", "text" }
+
+// kinds moved into extras/ (if --extras)
+var companionExtrasKinds = []string{ "cue", "log", "text", "video" }
+
+// returns kind of companion file or empty string if not a companion
+func companionKind(file string) string {
+  ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(file), "."))
+  for k, exts := range companionExts {
+    for x := range exts {
+      if exts[x] == ext {
+        return k
+      }
+    }
+  }
+  return ""
+}
+
+// sorted nested companion files within dir, relative to dir
+func companionFiles(dir string) []string {
+  exts := []string{}
+  for _, e := range companionExts {
+    exts = append(exts, e...)
+  }
+  sort.Strings(exts)
+  return fsutil.FilesByExtension(dir, exts)
+}
+
+// move companion files (except images, merged by fsutil.MergeFolder), marker
+// files & ignored audio files (relative to src) from src into a temporary
+// folder beside it before merging audio, since src is either removed once
+// only non-audio files remain or renamed to "<album> (1)". the stash is
+// merged (mergeCompanions & mergeMarkers) into the folder MergeFolder returns
+func stashCompanions(src string, ignored []string) (string, error) {
+  stash, err := ioutil.TempDir(filepath.Dir(src), ".audioc-")
+  if err != nil {
+    return "", err
+  }
+
+  files := append(companionFiles(src), markerFiles(src)...)
+  for _, f := range append(files, ignored...) {
+    if companionKind(f) == "image" {
+      continue
+    }
+
+    target := filepath.Join(stash, f)
+    err = os.MkdirAll(filepath.Dir(target), 0777)
+    if err != nil {
+      return stash, err
+    }
+    err = os.Rename(filepath.Join(src, f), target)
+    if err != nil {
+      return stash, err
+    }
+  }
+
+  return stash, nil
+}
+
+// copy companion files (except images) from src to dest; files with same
+// content as one in dest (other than within src, ie disc folders) are skipped
+func mergeCompanions(src, dest string) error {
+  existing := []string{}
+  rel, _ := filepath.Rel(dest, src)
+  for _, f := range companionFiles(dest) {
+    if !strings.HasPrefix(f, rel + fsutil.PathSep) {
+      existing = append(existing, f)
+    }
+  }
+
+  hashes, err := companionHashes(dest, existing, false)
+  if err != nil {
+    return err
+  }
+
+  for _, f := range companionFiles(src) {
+    if companionKind(f) == "image" {
+      continue
+    }
+
+    h, err := checksum.FileMD5(filepath.Join(src, f))
+    if err != nil {
+      return err
+    }
+    if _, found := hashes[h]; found {
+      continue
+    }
+
+    target := uniquePath(filepath.Join(dest, f))
+    err = os.MkdirAll(filepath.Dir(target), 0777)
+    if err != nil {
+      return err
+    }
+    err = fsutil.CopyFile(filepath.Join(src, f), target)
+    if err != nil {
+      return err
+    }
+    hashes[h] = target
+  }
+
+  return nil
+}
+
+// map of content hash to companion file of files (relative to dir); if
+// remove, duplicates are deleted
+func companionHashes(dir string, files []string,
+  remove bool) (map[string]string, error) {
+
+  hashes := map[string]string{}
+
+  for _, f := range files {
+    p := filepath.Join(dir, f)
+    h, err := checksum.FileMD5(p)
+    if err != nil {
+      return hashes, err
+    }
+
+    if prev, found := hashes[h]; found {
+      if !remove {
+        continue
+      }
+
+      // keep folder artwork over its duplicate
+      if folderImage(f) {
+        p, hashes[h] = prev, p
+      }
+
+      fmt.Printf("  * remove duplicate: %v\n", p)
+      err = os.Remove(p)
+      if err != nil {
+        return hashes, err
+      }
+      continue
+    }
+    hashes[h] = p
+  }
+
+  return hashes, nil
+}
+
+// within top-level of album folder only: remove duplicate companion files &
+// rename text, log & cue files after album (if --companions), then move text,
+// log, cue & video files into extras/ (if --extras)
+func (a *audioc) organizeCompanions(dir string) error {
+  if !a.Config.Companions && !a.Config.Extras {
+    return nil
+  }
+
+  // top-level companions; disc folders & extras/ are left as is
+  top := []string{}
+  for _, f := range companionFiles(dir) {
+    if !strings.Contains(f, fsutil.PathSep) {
+      top = append(top, f)
+    }
+  }
+
+  if a.Config.Companions {
+    hashes, err := companionHashes(dir, top, true)
+    if err != nil {
+      return err
+    }
+
+    // only those kept
+    top = []string{}
+    for _, p := range hashes {
+      top = append(top, filepath.Base(p))
+    }
+    sort.Strings(top)
+  }
+
+  // by kind
+  kinds := map[string][]string{}
+  for _, f := range top {
+    k := companionKind(f)
+    kinds[k] = append(kinds[k], f)
+  }
+
+  if a.Config.Companions {
+    album := filepath.Base(dir)
+    for _, k := range companionRenameKinds {
+      if len(kinds[k]) != 1 {
+        continue
+      }
+
+      f := kinds[k][0]
+      name := album + strings.ToLower(filepath.Ext(f))
+      if f == name {
+        continue
+      }
+
+      target := uniquePath(filepath.Join(dir, name))
+      err := os.Rename(filepath.Join(dir, f), target)
+      if err != nil {
+        return err
+      }
+      kinds[k][0] = filepath.Base(target)
+    }
+  }
+
+  if !a.Config.Extras {
+    return nil
+  }
+
+  // artwork & checksum manifests remain with audio
+  for _, k := range companionExtrasKinds {
+    for _, f := range kinds[k] {
+      target := uniquePath(filepath.Join(dir, "extras", f))
+      err := os.MkdirAll(filepath.Dir(target), 0777)
+      if err != nil {
+        return err
+      }
+      err = os.Rename(filepath.Join(dir, f), target)
+      if err != nil {
+        return err
+      }
+    }
+  }
+
+  return nil
+}
+
+// folder.jpg & folder-orig.jpg created by albumart
+func folderImage(f string) bool {
+  return regexp.MustCompile(`^(?i)folder(-orig)?\.jpg$`).MatchString(filepath.Base(f))
+}
+
+// if path exists, append (x) to file name, increment until not found
+func uniquePath(p string) string {
+  if _, err := os.Stat(p); err != nil {
+    return p
+  }
+
+  ext := filepath.Ext(p)
+  for x := 1; ; x++ {
+    n := fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(p, ext), x, ext)
+    if _, err := os.Stat(n); err != nil {
+      return n
+    }
+  }
+}
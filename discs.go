@@ -0,0 +1,221 @@
+package audioc
+
+import (
+  "os"
+  "fmt"
+  "sort"
+  "strings"
+  "strconv"
+  "path/filepath"
+
+  "github.com/jamlib/libaudio/fsutil"
+  "github.com/jamlib/audioc/metadata"
+)
+
+// group files by parent directory, combining sibling disc folders
+// (ie Album/CD1, Album/CD2) into a single bundle; calls f for each bundle
+func (a *audioc) bundleFiles(f func(indexes []int) error) error {
+  bundles := [][]int{}
+  err := fsutil.BundleFiles(a.Config.Dir, a.Files, func(indexes []int) error {
+    if len(indexes) > 0 {
+      bundles = append(bundles, append([]int{}, indexes...))
+    }
+    return nil
+  })
+  if err != nil {
+    return err
+  }
+
+  for x := 0; x < len(bundles); {
+    group := bundles[x]
+    y := x+1
+
+    parent, isDisc := a.discParent(bundles[x][0])
+    if isDisc {
+      for ; y < len(bundles); y++ {
+        p, d := a.discParent(bundles[y][0])
+        if !d || p != parent {
+          break
+        }
+        group = append(group, bundles[y]...)
+      }
+    }
+
+    err = f(group)
+    if err != nil {
+      return err
+    }
+    x = y
+  }
+
+  return nil
+}
+
+// album folder containing file & whether file is within a disc folder
+func (a *audioc) discParent(index int) (string, bool) {
+  dir := filepath.Dir(a.Files[index])
+  if dir == "." || len(metadata.DiscFolder(filepath.Base(dir))) == 0 {
+    return dir, false
+  }
+  return filepath.Dir(dir), true
+}
+
+// distinct disc folders within bundle; empty unless multiple disc folders
+func (a *audioc) discDirs(indexes []int) []string {
+  dirs := []string{}
+  for _, x := range indexes {
+    d := filepath.Dir(a.Files[x])
+    if len(dirs) == 0 || dirs[len(dirs)-1] != d {
+      dirs = append(dirs, d)
+    }
+  }
+
+  if len(dirs) < 2 {
+    return []string{}
+  }
+  return dirs
+}
+
+// disc number from info, else from disc folder (if multiple discs)
+func (a *audioc) fileDisc(index int, i *metadata.Info) string {
+  d := strings.TrimLeft(i.Disc, "0")
+  if len(d) == 0 && len(a.DiscDirs) > 0 {
+    d = metadata.DiscFolder(filepath.Base(filepath.Dir(a.Files[index])))
+  }
+  return d
+}
+
+// determine track total per disc & total discs from filenames; prints a
+// warning when track numbering contains gaps
+func (a *audioc) processTotals(indexes []int) {
+  discs := map[string][]int{}
+  discOf := map[int]string{}
+
+  for _, x := range indexes {
+    i := metadata.New(a.Files[x]).Info
+    d := a.fileDisc(x, i)
+    t, _ := strconv.Atoi(i.Track)
+
+    discs[d] = append(discs[d], t)
+    discOf[x] = d
+  }
+
+  // larger of files found & highest track number (tracks may be missing)
+  totals := map[string]int{}
+  for d, tracks := range discs {
+    totals[d] = len(tracks)
+    for _, t := range tracks {
+      if t > totals[d] {
+        totals[d] = t
+      }
+    }
+  }
+
+  a.TrackTotals = map[int]string{}
+  for x, d := range discOf {
+    a.TrackTotals[x] = strconv.Itoa(totals[d])
+  }
+
+  a.DiscTotal = ""
+  if len(discs) > 1 {
+    a.DiscTotal = strconv.Itoa(len(discs))
+  }
+
+  keys := []string{}
+  for d := range discs {
+    keys = append(keys, d)
+  }
+  sort.Strings(keys)
+
+  for _, d := range keys {
+    if missing := missingTracks(discs[d]); len(missing) > 0 {
+      fmt.Printf("  * missing tracks %v", strings.Join(missing, ", "))
+      if len(d) > 0 {
+        fmt.Printf(" on disc %v", d)
+      }
+      fmt.Printf("\n")
+    }
+  }
+}
+
+// track numbers absent between 1 & highest track number
+func missingTracks(tracks []int) []string {
+  t := append([]int{}, tracks...)
+  sort.Ints(t)
+
+  missing := []string{}
+  n := 1
+  for _, v := range t {
+    if v < n {
+      continue
+    }
+    for ; n < v; n++ {
+      missing = append(missing, strconv.Itoa(n))
+    }
+    n++
+  }
+  return missing
+}
+
+// apply disc from disc folder & bundle totals to info; returns true if
+// info was changed
+func (a *audioc) applyTotals(index int, i *metadata.Info) bool {
+  before := *i
+
+  if len(i.Disc) == 0 {
+    i.Disc = a.fileDisc(index, i)
+  }
+
+  if t, ok := a.TrackTotals[index]; ok {
+    i.TrackTotal = t
+  }
+  if len(a.DiscTotal) > 0 && len(i.Disc) > 0 {
+    i.DiscTotal = a.DiscTotal
+  }
+
+  return *i != before
+}
+
+// move audio from each disc folder into album folder (conflicting names are
+// made unique) & merge its companion files; per-disc artwork is dropped in
+// favor of the album folder's. disc folders holding ignored audio or marker
+// files are kept
+func (a *audioc) flattenDiscs(albumDir string) error {
+  for _, d := range a.DiscDirs {
+    discDir := filepath.Join(a.Config.Dir, d)
+
+    ignored, err := a.ignoredFiles(discDir)
+    if err != nil {
+      return err
+    }
+    skip := map[string]bool{}
+    for _, f := range ignored {
+      skip[f] = true
+    }
+
+    for _, f := range fsutil.FilesAudio(discDir) {
+      if skip[f] {
+        continue
+      }
+      err = os.Rename(filepath.Join(discDir, f),
+        uniquePath(filepath.Join(albumDir, filepath.Base(f))))
+      if err != nil {
+        return err
+      }
+    }
+
+    err = mergeCompanions(discDir, albumDir)
+    if err != nil {
+      return err
+    }
+
+    if len(ignored) > 0 || len(markerFiles(discDir)) > 0 {
+      continue
+    }
+    err = os.RemoveAll(discDir)
+    if err != nil {
+      return err
+    }
+  }
+  return nil
+}
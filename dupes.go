@@ -0,0 +1,215 @@
+package audioc
+
+import (
+  "os"
+  "fmt"
+  "sort"
+  "regexp"
+  "strings"
+  "path/filepath"
+
+  "github.com/jamlib/audioc/metadata"
+)
+
+// default preferences, highest first
+const (
+  defaultPreferFormat = "FLAC,V0,320"
+  defaultPreferSource = "SBD,MATRIX,FM,AUD"
+)
+
+type album struct {
+  Dir, Key string
+  Info *metadata.Info
+  Format, Source string
+  Tracks int
+  Duration float64
+}
+
+// report albums held more than once, grouped by artist and date (shows) or
+// normalized title (albums), ranked by format & source preference
+func (a *audioc) Dupes() error {
+  // ensure path is is valid directory
+  fi, err := os.Stat(a.Config.Dir)
+  if err != nil || !fi.IsDir() {
+    return fmt.Errorf("Invalid directory: %s", a.Config.Dir)
+  }
+
+  a.Files, err = a.audioFiles()
+  if err != nil {
+    return err
+  }
+
+  albums := []*album{}
+  // sibling disc folders (ie CD1, CD2) are one album
+  err = a.bundleFiles(func(indexes []int) error {
+    al, err := a.albumFromBundle(indexes)
+    if err != nil {
+      return err
+    }
+    if len(al.Key) > 0 {
+      albums = append(albums, al)
+    }
+    return nil
+  })
+  if err != nil {
+    return err
+  }
+
+  for _, g := range a.rankDupes(albums) {
+    fmt.Printf("\nDuplicate: %s %s\n", g[0].Info.Artist, g[0].Info.ToAlbum())
+    for x := range g {
+      label := "dupe"
+      if x == 0 {
+        label = "keep"
+      }
+      fmt.Printf("  %s: %s (%s, %s, %d tracks, %s)\n", label, g[x].Dir,
+        g[x].Format, g[x].Source, g[x].Tracks, formatDuration(g[x].Duration))
+    }
+  }
+
+  fmt.Printf("\naudioc finished.\n")
+  return nil
+}
+
+// build album from bundle of files within same folder
+func (a *audioc) albumFromBundle(indexes []int) (*album, error) {
+  dir, _ := a.discParent(indexes[0])
+  al := &album{ Dir: dir, Tracks: len(indexes) }
+
+  al.Info = metadata.New(a.Files[indexes[0]]).Info
+  al.Info.Artist = a.InfoFromConfig(indexes[0]).Artist
+  al.Source = al.Info.Source
+  if len(al.Source) == 0 {
+    al.Source = "unknown"
+  }
+
+  for x, index := range indexes {
+    d, err := a.Ffprobe.GetData(filepath.Join(a.Config.Dir, a.Files[index]))
+    if err != nil {
+      return al, err
+    }
+
+    if len(al.Info.Artist) == 0 && d.Format.Tags != nil {
+      al.Info.Artist = d.Format.Tags.Artist
+    }
+    al.Duration += d.Format.Duration
+
+    // mixed formats rank as other
+    f := audioFormat(a.Files[index], d.Format.BitRate)
+    if x == 0 {
+      al.Format = f
+    } else if f != al.Format {
+      al.Format = "other"
+    }
+  }
+
+  if len(al.Info.Artist) == 0 {
+    return al, nil
+  }
+
+  // shows are keyed by date, albums by normalized title
+  if al.Info.IsLive() {
+    al.Key = strings.Join([]string{ al.Info.Year, al.Info.Month,
+      al.Info.Day }, ".")
+  } else {
+    al.Key = normalizeTitle(al.Info.Album)
+  }
+  if len(al.Key) > 0 {
+    al.Key = strings.ToLower(al.Info.Artist) + "|" + al.Key
+  }
+
+  return al, nil
+}
+
+// group albums by key, sort each by preference; only groups of 2 or more
+func (a *audioc) rankDupes(albums []*album) [][]*album {
+  groups := map[string][]*album{}
+  keys := []string{}
+  for _, al := range albums {
+    if _, ok := groups[al.Key]; !ok {
+      keys = append(keys, al.Key)
+    }
+    groups[al.Key] = append(groups[al.Key], al)
+  }
+
+  formats := preferList(a.Config.PreferFormat, defaultPreferFormat)
+  sources := preferList(a.Config.PreferSource, defaultPreferSource)
+
+  dupes := [][]*album{}
+  for _, k := range keys {
+    g := groups[k]
+    if len(g) < 2 {
+      continue
+    }
+
+    sort.SliceStable(g, func(i, j int) bool {
+      fi, fj := preferRank(formats, g[i].Format), preferRank(formats, g[j].Format)
+      if fi != fj {
+        return fi < fj
+      }
+      si, sj := preferRank(sources, g[i].Source), preferRank(sources, g[j].Source)
+      if si != sj {
+        return si < sj
+      }
+      if g[i].Tracks != g[j].Tracks {
+        return g[i].Tracks > g[j].Tracks
+      }
+      return g[i].Duration > g[j].Duration
+    })
+
+    dupes = append(dupes, g)
+  }
+
+  return dupes
+}
+
+// split comma separated preference, uppercased
+func preferList(s, def string) []string {
+  if len(s) == 0 {
+    s = def
+  }
+  l := strings.Split(strings.ToUpper(s), ",")
+  for x := range l {
+    l[x] = strings.TrimSpace(l[x])
+  }
+  return l
+}
+
+// position within preference list; not found ranks last
+func preferRank(l []string, s string) int {
+  for x := range l {
+    if l[x] == strings.ToUpper(s) {
+      return x
+    }
+  }
+  return len(l)
+}
+
+// classify audio as FLAC, V0, 320 or other by extension & bitrate
+func audioFormat(file, bitrate string) string {
+  switch strings.ToLower(filepath.Ext(file)) {
+  case ".flac":
+    return "FLAC"
+  case ".mp3":
+    var b int
+    fmt.Sscanf(bitrate, "%d", &b)
+    switch {
+    case b >= 319000 && b <= 321000:
+      return "320"
+    case b >= 220000 && b < 319000:
+      return "V0"
+    }
+  }
+  return "other"
+}
+
+// lowercase letters & numbers only
+func normalizeTitle(s string) string {
+  return regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(strings.ToLower(s), "")
+}
+
+// seconds as h:mm:ss
+func formatDuration(d float64) string {
+  s := int(d)
+  return fmt.Sprintf("%d:%02d:%02d", s/3600, (s/60)%60, s%60)
+}
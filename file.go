@@ -4,12 +4,17 @@ import (
   "os"
   "fmt"
   "regexp"
+  "os/exec"
   "strings"
+  "net/http"
+  "io/ioutil"
   "path/filepath"
 
   "github.com/jamlib/libaudio/ffmpeg"
   "github.com/jamlib/libaudio/fsutil"
+  "github.com/jamlib/audioc/id3"
   "github.com/jamlib/audioc/metadata"
+  "github.com/jamlib/audioc/fsprofile"
 )
 
 func (a *audioc) InfoFromConfig(index int) *metadata.Info {
@@ -19,21 +24,92 @@ func (a *audioc) InfoFromConfig(index int) *metadata.Info {
   if a.Config.Collection {
     i.Artist = strings.Split(a.Files[index], fsutil.PathSep)[0]
   }
+  // overrides of folder marker (.audioc)
+  if m := a.marker(a.Files[index]); len(m.Artist) > 0 || len(m.Album) > 0 {
+    if len(m.Artist) > 0 {
+      i.Artist = m.Artist
+    }
+    if len(m.Album) > 0 {
+      i.Album = m.Album
+    }
+  }
+  i.AlbumArtist = i.Artist
+
+  // track artists of bundle differ (ie compilation); artist of each track is
+  // kept from its tags
+  if len(a.AlbumArtist) > 0 {
+    i.Artist, i.AlbumArtist, i.Compilation = "", a.AlbumArtist, a.Compilation
+  }
 
   return i
 }
 
+// filesystem profile of resulting paths (default posix)
+func (a *audioc) profile() *fsprofile.Profile {
+  if a.Profile == nil {
+    return fsprofile.Posix
+  }
+  return a.Profile
+}
+
+// folder name (ie artist, album) per filename policy & filesystem profile
+func (a *audioc) folderName(s string) string {
+  return a.profile().Clean(metadata.FolderName(s, a.Config.Filenames))
+}
+
 func (a *audioc) processFile(index int) (*metadata.Metadata, error) {
   m := metadata.New(a.Files[index])
+  m.Filenames = a.Config.Filenames
 
   // info from embedded tags within audio file
-  d, err := a.Ffprobe.GetData(filepath.Join(a.Config.Dir, a.Files[index]))
+  d, err := a.probe(index)
   if err != nil {
     return m, err
   }
 
-  m.Info, m.Match = m.MatchBestInfo(a.InfoFromConfig(index),
-    metadata.ProbeTagsToInfo(d.Format.Tags))
+  tags := metadata.ProbeTagsToInfo(d.Format.Tags)
+  readAlbumArtist(filepath.Join(a.Config.Dir, a.Files[index]), tags)
+
+  m.Info, m.Match = m.MatchBestInfo(a.InfoFromConfig(index), tags)
+
+  // source from path or tags takes precedence over info text files (only
+  // trusted for live performances)
+  live := a.SourceInfo != nil && m.Info.IsLive()
+  if live && len(m.Info.Source) == 0 && len(a.SourceInfo.Source) > 0 {
+    m.Info.Source, m.Match = a.SourceInfo.Source, false
+  }
+  if live && len(m.Info.SourceID) == 0 && len(a.SourceInfo.SourceID) > 0 {
+    m.Info.SourceID, m.Match = a.SourceInfo.SourceID, false
+  }
+
+  // info from matched release takes precedence
+  if a.applyRelease(index, m.Info) {
+    m.Match = false
+  }
+
+  // disc from disc folder & track/disc totals of bundle
+  if a.applyTotals(index, m.Info) {
+    m.Match = false
+  }
+
+  // name stray tracks (ie "Track01.wav") by fingerprint
+  identified, err := a.identify(filepath.Join(a.Config.Dir, a.Files[index]),
+    m.Info)
+  if err != nil {
+    return m, err
+  }
+  if identified {
+    m.Match = false
+  }
+
+  // title case & song title dictionary (--title-case, --titles)
+  if a.Titles != nil {
+    t := a.Titles.Normalize([]string{ m.Info.Artist, m.Info.ToArtist() },
+      m.Info.Title)
+    if t != m.Info.Title {
+      m.Info.Title, m.Match = t, false
+    }
+  }
 
   // skip if sources match (unless --force)
   if m.Match && !a.Config.Force {
@@ -41,19 +117,44 @@ func (a *audioc) processFile(index int) (*metadata.Metadata, error) {
     return m, nil
   }
 
+  // resulting extension
+  ext, outExt := strings.ToLower(filepath.Ext(a.Files[index])), ".mp3"
+  if ext == ".flac" && a.keepFlac(a.Files[index]) {
+    outExt = ".flac"
+  }
+
   // build resulting path
   fpa := strings.Split(a.Files[index], fsutil.PathSep)
 
+  artist := a.folderName(m.Info.ToArtist())
+
   // if --collection or artist/year folder in expected place
   if a.Config.Collection ||
-    (len(fpa) > 2 && fpa[0] == m.Info.Artist && fpa[1] == m.Info.Year) {
+    (len(fpa) > 2 && fpa[0] == artist && fpa[1] == m.Info.Year) {
 
-    // override with custom resultpath
-    m.Resultpath = filepath.Join(m.Info.Artist, m.Info.Year)
+    // override with custom resultpath (ie "Various Artists/1995")
+    m.Resultpath = filepath.Join(artist, m.Info.Year)
   }
 
   // append album name as directory
-  m.Resultpath = filepath.Join(m.Resultpath, m.Info.ToAlbum(), m.Info.ToFile())
+  m.Resultpath = filepath.Join(m.Resultpath, a.folderName(m.Info.ToAlbum()))
+
+  // keep disc folder of multi-disc album (unless --flatten)
+  if len(a.DiscDirs) > 0 && !a.Config.Flatten {
+    m.Resultpath = filepath.Join(m.Resultpath,
+      a.profile().Clean(filepath.Base(filepath.Dir(a.Files[index]))))
+  }
+
+  m.Resultpath = filepath.Join(m.Resultpath,
+    a.profile().Clean(m.Info.ToFile(a.Config.Filenames)))
+
+  // fit within path limits of filesystem (--filesystem), matching case of
+  // folders & never overwriting another track
+  m.Resultpath = a.profile().Shorten(m.Resultpath, outExt)
+  if a.Paths != nil {
+    m.Resultpath = a.Paths.Claim(m.Resultpath)
+  }
+  name := strings.TrimSuffix(filepath.Base(m.Resultpath), outExt)
 
   fp := filepath.Join(a.Config.Dir, a.Files[index])
 
@@ -63,21 +164,88 @@ func (a *audioc) processFile(index int) (*metadata.Metadata, error) {
     p += fmt.Sprintf("  * update tags: %#v\n", m.Info)
   }
 
+  // verify source before converting (if --verify); failed sources are
+  // reported & left untouched so they are never deleted
+  if a.Config.Verify {
+    errs, notes := a.verifyFile(fp)
+    if len(errs) > 0 {
+      p += fmt.Sprintf("  * verify failed, source kept: %s\n",
+        strings.Join(errs, "; "))
+      fmt.Printf(p)
+
+      m.Resultpath = a.Files[index]
+      return m, nil
+    }
+    p += fmt.Sprintf("  * verified\n")
+    for _, n := range notes {
+      p += fmt.Sprintf("  * %s\n", n)
+    }
+  }
+
+  // source tags (read before source is converted or renamed)
+  source := sourceTags(fp, d)
+
   // convert audio (if necessary) & update tags
-  ext := strings.ToLower(filepath.Ext(a.Files[index]))
-  if ext != ".flac" || !skipConvert(a.Files[index]) {
+  if outExt == ".mp3" {
     // convert to mp3
-    m.Resultpath += ".mp3"
     p += fmt.Sprintf("  * convert to MP3 (%s)\n", a.Config.Bitrate)
 
-    _, err := a.processMp3(fp, m.Info)
+    file, err := a.processMp3(fp, m.Info, name)
+    if err != nil {
+      return m, err
+    }
+
+    tags := a.mapTags(source, m.Info, ext == ".mp3" && !a.Config.Fix)
+
+    // iTunes gapless info of file split from live stream (if --gapless)
+    if _, ok := a.Gapless[fp]; ok {
+      g, err := gaplessTags(file)
+      if err != nil {
+        return m, err
+      }
+      for k, v := range g {
+        tags[k] = v
+      }
+    }
+
+    err = a.writeTags(file, tags)
+    if err != nil {
+      return m, err
+    }
+
+    err = a.processLoudness(file, d.Format.Duration)
     if err != nil {
       return m, err
     }
   } else {
-    // TODO: use metaflac to edit flac metadata & embedd artwork
-    m.Resultpath += ".flac"
-    p += fmt.Sprintf("\n*** Flac processing with 'metaflac' not yet implemented.\n")
+    // tags & typed PICTURE blocks are written with metaflac
+    if _, err := exec.LookPath("metaflac"); err != nil && a.Config.Write {
+      p += fmt.Sprintf("  * warning: 'metaflac' not found, FLAC tags & artwork not written\n")
+    }
+
+    // typed PICTURE blocks (front, back, disc, etc)
+    err = a.writePictures(fp)
+    if err != nil {
+      return m, err
+    }
+
+    tags := a.mapTags(source, m.Info, true)
+    if len(m.Info.TrackTotal) > 0 {
+      tags["TRACKTOTAL"] = m.Info.TrackTotal
+    }
+    if len(m.Info.DiscTotal) > 0 {
+      tags["DISCTOTAL"] = m.Info.DiscTotal
+    }
+
+    err = a.writeTags(fp, tags)
+    if err != nil {
+      return m, err
+    }
+
+    err = a.processLoudness(fp, d.Format.Duration)
+    if err != nil {
+      return m, err
+    }
   }
 
   // compare processed to current path
@@ -100,55 +268,136 @@ func skipConvert(file string) bool {
   return true
 }
 
-func (a *audioc) processMp3(f string, i *metadata.Info) (string, error) {
+// convert or update f, resulting in name (without extension) within same
+// folder
+func (a *audioc) processMp3(f string, i *metadata.Info,
+  name string) (string, error) {
+
   // skip if not writing
   if !a.Config.Write {
     return "", nil
   }
 
-  // if already mp3, copy stream; do not convert
+  // split from gapless stream (if --gapless); tagged natively, since
+  // remuxing would replace its encoder delay & padding
+  if piece, ok := a.Gapless[f]; ok {
+    file := filepath.Join(filepath.Dir(f), name + ".mp3")
+    err := os.Rename(piece, file)
+    if err != nil {
+      return file, err
+    }
+    err = os.Remove(f)
+    if err != nil {
+      return file, err
+    }
+    return a.processMp3Tags(file, i, name)
+  }
+
+  // if already mp3, update tag in place; do not convert (unless --fix)
   quality := a.Config.Bitrate
   if strings.ToLower(filepath.Ext(f)) == ".mp3" {
+    if !a.Config.Fix {
+      return a.processMp3Tags(f, i, name)
+    }
     quality = "copy"
   }
 
   // TODO: specify lower bitrate if source file is of low bitrate
 
+  // save new file to Workdir subdir within current path
+  newFile := filepath.Join(a.Workdir, name + ".mp3")
+  err := a.toMp3(f, newFile, quality, a.Image, i)
+  if err != nil {
+    return newFile, err
+  }
+
+  file := filepath.Join(filepath.Dir(f), name + ".mp3")
+
+  // delete original
+  err = os.Remove(f)
+  if err != nil {
+    return file, err
+  }
+
+  // move new to original directory
+  err = os.Rename(newFile, file)
+  return file, err
+}
+
+// convert f (or remux if quality is "copy") to mp3 file dst with tags of
+// info & artwork (if any); shared by processMp3 & syncMp3
+func (a *audioc) toMp3(f, dst, quality, art string, i *metadata.Info) error {
   // build metadata from tag info
   ffmeta := ffmpeg.Metadata{ Artist: i.Artist, Album: i.ToAlbum(),
-    Disc: i.Disc, Track: i.Track, Title: i.Title, Artwork: a.Image }
+    Disc: i.DiscTag(), Track: i.TrackTag(), Title: i.Title, Date: i.DateTag(),
+    Artwork: art }
 
-  // save new file to Workdir subdir within current path
-  newFile := filepath.Join(a.Workdir, i.ToFile() + ".mp3")
-
-  // process or convert to mp3
-  c := &ffmpeg.Mp3Config{ f, quality, newFile, ffmeta, a.Config.Fix }
+  c := &ffmpeg.Mp3Config{ f, quality, dst, ffmeta, a.Config.Fix }
   _, err := a.Ffmpeg.ToMp3(c)
   if err != nil {
-    return newFile, err
+    return err
   }
 
   // ensure output file was written
-  fi, err := os.Stat(newFile)
+  fi, err := os.Stat(dst)
   if err != nil {
-    return newFile, err
+    return err
   }
 
   // ensure resulting file has size
   // TODO: ensure resulting file is good by reading & comparing metadata
   if fi.Size() <= 0 {
-    return newFile, fmt.Errorf("File didn't have size")
+    return fmt.Errorf("File didn't have size")
   }
+  return nil
+}
 
-  file := filepath.Join(filepath.Dir(f), i.ToFile() + ".mp3")
+// update ID3v2 frames of existing mp3 natively (no ffmpeg remux); unknown
+// frames are kept & padding is reused when the tag still fits
+func (a *audioc) processMp3Tags(f string, i *metadata.Info,
+  name string) (string, error) {
 
-  // delete original
-  err = os.Remove(f)
+  t, err := id3.ReadFile(f)
+  if err == id3.ErrNoTag {
+    t, err = id3.New(), nil
+  }
   if err != nil {
-    return file, err
+    return f, err
   }
 
-  // move new to original directory
-  err = os.Rename(newFile, file)
+  t.SetText("TPE1", i.Artist)
+  t.SetText("TALB", i.ToAlbum())
+  t.SetText("TPOS", i.DiscTag())
+  t.SetText("TRCK", i.TrackTag())
+  t.SetText("TIT2", i.Title)
+
+  if len(a.Image) > 0 {
+    b, err := ioutil.ReadFile(a.Image)
+    if err != nil {
+      return f, err
+    }
+    t.SetPicture(&id3.Picture{ MIME: pictureMIME(b), Type: 3, Data: b })
+  }
+
+  err = id3.WriteFile(f, t)
+  if err != nil {
+    return f, err
+  }
+
+  file := filepath.Join(filepath.Dir(f), name + ".mp3")
+  if file == f {
+    return file, nil
+  }
+
+  // rename in place
+  err = os.Rename(f, file)
   return file, err
 }
+
+// MIME type of image data (ie image/png), otherwise image/jpeg
+func pictureMIME(b []byte) string {
+  if m := http.DetectContentType(b); strings.HasPrefix(m, "image/") {
+    return m
+  }
+  return "image/jpeg"
+}
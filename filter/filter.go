@@ -0,0 +1,127 @@
+package filter
+
+import (
+  "fmt"
+  "path"
+  "regexp"
+  "strconv"
+  "strings"
+)
+
+// condition upon a field of an album or track, ie "year>=1995"
+type Cond struct {
+  Field, Op, Value string
+}
+
+// conditions that must all match
+type Filter []*Cond
+
+var condRegexp = regexp.MustCompile(`^\s*([A-Za-z]+)\s*(!=|>=|<=|=|>|<)\s*(.*?)\s*$`)
+
+// parse comma separated conditions, ie "artist=Phish,year>=1995"; commas
+// not followed by a condition are kept within value (ie "album=Ithaca, NY")
+func Parse(s string) (Filter, error) {
+  f := Filter{}
+  if len(strings.TrimSpace(s)) == 0 {
+    return f, nil
+  }
+
+  for _, part := range strings.Split(s, ",") {
+    m := condRegexp.FindStringSubmatch(part)
+    if m == nil {
+      if len(f) == 0 {
+        return f, fmt.Errorf("invalid condition: %v", part)
+      }
+      last := f[len(f)-1]
+      last.Value = strings.TrimSpace(last.Value + "," + part)
+      continue
+    }
+    f = append(f, &Cond{ Field: strings.ToLower(m[1]), Op: m[2],
+      Value: m[3] })
+  }
+  return f, nil
+}
+
+// true if all conditions match values keyed by lowercase field name; empty
+// filter matches everything
+func (f Filter) Match(values map[string]string) bool {
+  for _, c := range f {
+    if !c.Match(values) {
+      return false
+    }
+  }
+  return true
+}
+
+// fields missing from values are empty
+func (c *Cond) Match(values map[string]string) bool {
+  v := values[c.Field]
+  switch c.Op {
+  case "=":
+    return equal(v, c.Value)
+  case "!=":
+    return !equal(v, c.Value)
+  }
+
+  // ordering never matches empty values (ie year of undated album)
+  if len(v) == 0 {
+    return false
+  }
+  r := compare(v, c.Value)
+  switch c.Op {
+  case ">":
+    return r > 0
+  case ">=":
+    return r >= 0
+  case "<":
+    return r < 0
+  }
+  return r <= 0
+}
+
+// case insensitive; value may be glob pattern (ie "Phish*", "*/1995/*") where
+// "**" matches any number of folders (ie "Phish/1995/**")
+func equal(v, pattern string) bool {
+  v, pattern = strings.ToLower(v), strings.ToLower(pattern)
+  if strings.ContainsAny(pattern, "*?[") {
+    return glob(strings.Split(pattern, "/"), strings.Split(v, "/"))
+  }
+  return v == pattern
+}
+
+// match path segments to pattern segments, each as path.Match
+func glob(pattern, segs []string) bool {
+  if len(pattern) == 0 {
+    return len(segs) == 0
+  }
+  if pattern[0] == "**" {
+    for x := 0; x <= len(segs); x++ {
+      if glob(pattern[1:], segs[x:]) {
+        return true
+      }
+    }
+    return false
+  }
+  if len(segs) == 0 {
+    return false
+  }
+  ok, _ := path.Match(pattern[0], segs[0])
+  return ok && glob(pattern[1:], segs[1:])
+}
+
+// numeric when both are numbers, otherwise case insensitive (so dates as
+// "YYYY-MM-DD" order correctly)
+func compare(a, b string) int {
+  fa, erra := strconv.ParseFloat(a, 64)
+  fb, errb := strconv.ParseFloat(b, 64)
+  if erra == nil && errb == nil {
+    switch {
+    case fa < fb:
+      return -1
+    case fa > fb:
+      return 1
+    }
+    return 0
+  }
+  return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
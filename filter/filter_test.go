@@ -0,0 +1,65 @@
+package filter
+
+import (
+  "testing"
+)
+
+func TestParse(t *testing.T) {
+  f, err := Parse("artist=Phish, year>=1995,album=Barton Hall, Ithaca, NY")
+  if err != nil {
+    t.Fatal(err)
+  }
+  e := []Cond{ { "artist", "=", "Phish" }, { "year", ">=", "1995" },
+    { "album", "=", "Barton Hall, Ithaca, NY" } }
+  if len(f) != len(e) {
+    t.Fatalf("Expected %v, got %v", e, f)
+  }
+  for x := range e {
+    if *f[x] != e[x] {
+      t.Errorf("Expected %v, got %v", e[x], *f[x])
+    }
+  }
+
+  if _, err = Parse("Phish"); err == nil {
+    t.Errorf("Expected error of invalid condition")
+  }
+  if f, err = Parse(""); err != nil || len(f) != 0 {
+    t.Errorf("Expected empty filter, got %v %v", f, err)
+  }
+}
+
+func TestMatch(t *testing.T) {
+  v := map[string]string{ "artist": "Phish", "year": "1997",
+    "date": "1997-11-22", "format": "flac",
+    "path": "Phish/1997/1997.11.22 Hampton Coliseum/01 Mike's Song.flac" }
+
+  tests := map[string]bool{
+    "": true,
+    "artist=phish": true,
+    "artist=Grateful Dead": false,
+    "artist!=Grateful Dead": true,
+    "artist=Ph*,year>=1990,year<2000": true,
+    "year>1997": false,
+    "year<=1997": true,
+    "date>=1997-11-01,date<1997-12-01": true,
+    "format=mp3": false,
+    "path=Phish/1997/*/*": true,
+    "path=Phish/1997/*": false,
+    "path=Phish/1997/**": true,
+    "path=Phish/**/*.flac": true,
+    "path=**/01 *": true,
+    "path=Phish/1997/**/*.mp3": false,
+    "album>A": false,
+    "album=": true,
+  }
+
+  for s, e := range tests {
+    f, err := Parse(s)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if r := f.Match(v); r != e {
+      t.Errorf("Expected %v for %q, got %v", e, s, r)
+    }
+  }
+}
@@ -0,0 +1,125 @@
+package audioc
+
+import (
+  "os"
+  "fmt"
+  "regexp"
+  "path/filepath"
+
+  "github.com/jamlib/audioc/metadata"
+  "github.com/jamlib/audioc/fingerprint"
+)
+
+// minimum score to accept fingerprint identification or duplicate
+const fingerprintThreshold = 0.9
+
+// build fingerprint database from an organized collection using its tags,
+// then print any duplicate tracks found
+func (a *audioc) Fingerprints() error {
+  // ensure path is is valid directory
+  fi, err := os.Stat(a.Config.Dir)
+  if err != nil || !fi.IsDir() {
+    return fmt.Errorf("Invalid directory: %s", a.Config.Dir)
+  }
+
+  db, err := fingerprint.LoadDB(a.Config.Fingerprint)
+  if err != nil {
+    return err
+  }
+
+  a.Files, err = a.audioFiles()
+  if err != nil {
+    return err
+  }
+  for x := range a.Files {
+    fp := filepath.Join(a.Config.Dir, a.Files[x])
+    fmt.Printf("Fingerprinting: %v\n", fp)
+
+    e, err := a.fingerprintFile(fp)
+    if err != nil {
+      return err
+    }
+
+    // prefer tags, fallback to path info
+    m := metadata.New(a.Files[x])
+    d, err := a.Ffprobe.GetData(fp)
+    if err != nil {
+      return err
+    }
+    if d.Format.Tags != nil {
+      m.Info, _ = m.MatchBestInfo(a.InfoFromConfig(x),
+        metadata.ProbeTagsToInfo(d.Format.Tags))
+    }
+
+    e.Path = a.Files[x]
+    e.Artist, e.Album, e.Title = m.Info.Artist, m.Info.ToAlbum(), m.Info.Title
+    db.Add(e)
+  }
+
+  err = db.Save(a.Config.Fingerprint)
+  if err != nil {
+    return err
+  }
+
+  for _, g := range db.Duplicates(fingerprintThreshold) {
+    fmt.Printf("\nDuplicate tracks:\n")
+    for _, e := range g {
+      fmt.Printf("  %v\n", e.Path)
+    }
+  }
+
+  fmt.Printf("\naudioc finished.\n")
+  return nil
+}
+
+// decode & fingerprint file
+func (a *audioc) fingerprintFile(file string) (*fingerprint.Entry, error) {
+  e := &fingerprint.Entry{}
+
+  d, err := a.Ffprobe.GetData(file)
+  if err != nil {
+    return e, err
+  }
+  e.Duration = d.Format.Duration
+
+  samples, err := fingerprint.Decode(a.Ffmpeg.Exec, file)
+  if err != nil {
+    return e, err
+  }
+  e.Fingerprint = fingerprint.Compute(samples)
+
+  return e, nil
+}
+
+// titles that do not identify the track, ie "Track01", "Audio Track 3"
+func unknownTitle(title string) bool {
+  return regexp.MustCompile(
+    `^(?i)((audio\s*)?track|untitled|unknown)?\s*\d*$`).MatchString(title)
+}
+
+// identify track by fingerprint; returns true if info changed
+func (a *audioc) identify(file string, i *metadata.Info) (bool, error) {
+  if a.Identifier == nil || !unknownTitle(i.Title) {
+    return false, nil
+  }
+
+  e, err := a.fingerprintFile(file)
+  if err != nil {
+    return false, err
+  }
+
+  found, score, err := a.Identifier.Identify(e.Fingerprint, e.Duration)
+  if err != nil || found == nil || score < fingerprintThreshold {
+    return false, err
+  }
+
+  i.Title = found.Title
+  if len(i.Artist) == 0 {
+    i.Artist = found.Artist
+  }
+  if len(i.Album) == 0 {
+    i.SetAlbum(found.Album)
+  }
+
+  return true, nil
+}
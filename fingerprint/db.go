@@ -0,0 +1,248 @@
+package fingerprint
+
+import (
+  "os"
+  "fmt"
+  "math"
+  "net/url"
+  "net/http"
+  "io/ioutil"
+  "encoding/json"
+  "encoding/base64"
+)
+
+type Entry struct {
+  Path string `json:"path"`
+  Artist string `json:"artist"`
+  Album string `json:"album"`
+  Title string `json:"title"`
+  Duration float64 `json:"duration"`
+  Fingerprint []uint32 `json:"fingerprint"`
+}
+
+// identifies fingerprint returning best entry and score from 0 to 1
+type Identifier interface {
+  Identify(fp []uint32, duration float64) (*Entry, float64, error)
+}
+
+// max offset (in fingerprint items) when aligning fingerprints
+const maxOffset = 80
+
+// max difference in seconds for durations to be compared
+const maxDurationDiff = 7.0
+
+// returns url lookup service if source is url, otherwise loads database
+func New(source, client string) (Identifier, error) {
+  u, err := url.Parse(source)
+  if err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+    return &Service{ BaseURL: source, Client: client,
+      HTTPClient: http.DefaultClient }, nil
+  }
+  return LoadDB(source)
+}
+
+// local fingerprint database stored as JSON
+type DB struct {
+  Entries []*Entry `json:"entries"`
+}
+
+// load database from file; missing file results in empty database
+func LoadDB(file string) (*DB, error) {
+  db := &DB{}
+
+  b, err := ioutil.ReadFile(file)
+  if os.IsNotExist(err) {
+    return db, nil
+  }
+  if err != nil {
+    return db, err
+  }
+
+  err = json.Unmarshal(b, db)
+  return db, err
+}
+
+func (db *DB) Save(file string) error {
+  b, err := json.Marshal(db)
+  if err != nil {
+    return err
+  }
+  return ioutil.WriteFile(file, b, 0644)
+}
+
+// add entry replacing any existing entry with the same path
+func (db *DB) Add(e *Entry) {
+  for x := range db.Entries {
+    if db.Entries[x].Path == e.Path {
+      db.Entries[x] = e
+      return
+    }
+  }
+  db.Entries = append(db.Entries, e)
+}
+
+func (db *DB) Identify(fp []uint32, duration float64) (*Entry, float64, error) {
+  var best *Entry
+  bestScore := 0.0
+
+  for _, e := range db.Entries {
+    if !durationsClose(e.Duration, duration) {
+      continue
+    }
+    s := Similarity(fp, e.Fingerprint, maxOffset)
+    if s > bestScore {
+      best, bestScore = e, s
+    }
+  }
+
+  return best, bestScore, nil
+}
+
+// groups entries whose fingerprints score at or above threshold
+func (db *DB) Duplicates(threshold float64) [][]*Entry {
+  groups := [][]*Entry{}
+  grouped := make(map[int]bool, len(db.Entries))
+
+  for x := range db.Entries {
+    if grouped[x] {
+      continue
+    }
+
+    g := []*Entry{ db.Entries[x] }
+    for y := x+1; y < len(db.Entries); y++ {
+      if grouped[y] || !durationsClose(db.Entries[x].Duration,
+        db.Entries[y].Duration) {
+        continue
+      }
+      s := Similarity(db.Entries[x].Fingerprint, db.Entries[y].Fingerprint,
+        maxOffset)
+      if s >= threshold {
+        g = append(g, db.Entries[y])
+        grouped[y] = true
+      }
+    }
+
+    if len(g) > 1 {
+      groups = append(groups, g)
+    }
+  }
+
+  return groups
+}
+
+// unknown durations are always close
+func durationsClose(a, b float64) bool {
+  return a == 0 || b == 0 || math.Abs(a - b) <= maxDurationDiff
+}
+
+// lookup service implementing the AcoustID web service (/v2/lookup)
+type Service struct {
+  BaseURL, Client string
+  HTTPClient *http.Client
+}
+
+func (s *Service) Identify(fp []uint32, duration float64) (*Entry, float64, error) {
+  v := url.Values{}
+  v.Set("client", s.Client)
+  v.Set("meta", "recordings releases")
+  v.Set("duration", fmt.Sprintf("%d", int(duration)))
+  v.Set("fingerprint", Encode(fp))
+
+  resp, err := s.HTTPClient.PostForm(s.BaseURL + "/v2/lookup", v)
+  if err != nil {
+    return nil, 0, err
+  }
+  defer resp.Body.Close()
+
+  r := struct {
+    Status string `json:"status"`
+    Results []struct {
+      Score float64 `json:"score"`
+      Recordings []struct {
+        Title string `json:"title"`
+        Duration float64 `json:"duration"`
+        Artists []struct {
+          Name string `json:"name"`
+        } `json:"artists"`
+        Releases []struct {
+          Title string `json:"title"`
+        } `json:"releases"`
+      } `json:"recordings"`
+    } `json:"results"`
+  }{}
+
+  err = json.NewDecoder(resp.Body).Decode(&r)
+  if err != nil {
+    return nil, 0, err
+  }
+  if r.Status != "ok" {
+    return nil, 0, fmt.Errorf("Fingerprint lookup failed: %s", r.Status)
+  }
+
+  // results are ordered by score; use first with a recording
+  for _, res := range r.Results {
+    if len(res.Recordings) == 0 {
+      continue
+    }
+    rec := res.Recordings[0]
+
+    e := &Entry{ Title: rec.Title, Duration: rec.Duration, Fingerprint: fp }
+    if len(rec.Artists) > 0 {
+      e.Artist = rec.Artists[0].Name
+    }
+    if len(rec.Releases) > 0 {
+      e.Album = rec.Releases[0].Title
+    }
+    return e, res.Score, nil
+  }
+
+  return nil, 0, nil
+}
+
+// compress fingerprint using chromaprint format, base64 (url safe) encoded
+func Encode(fp []uint32) string {
+  b := []byte{ 1, byte(len(fp) >> 16), byte(len(fp) >> 8), byte(len(fp)) }
+
+  // bit positions of changes between subsequent items, 0 ends each item
+  normal, exceptional := []int{}, []int{}
+  var prev uint32
+  for _, x := range fp {
+    d := x ^ prev
+    prev = x
+
+    bit, last := 1, 0
+    for ; d != 0; d >>= 1 {
+      if d&1 != 0 {
+        v := bit - last
+        last = bit
+        if v >= 7 {
+          normal = append(normal, 7)
+          exceptional = append(exceptional, v - 7)
+        } else {
+          normal = append(normal, v)
+        }
+      }
+      bit++
+    }
+    normal = append(normal, 0)
+  }
+
+  b = append(b, packBits(normal, 3)...)
+  b = append(b, packBits(exceptional, 5)...)
+  return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// pack values using n bits each, least significant bit first
+func packBits(values []int, n int) []byte {
+  out := make([]byte, (len(values)*n + 7) / 8)
+  pos := 0
+  for _, v := range values {
+    for x := 0; x < n; x++ {
+      if v & (1 << uint(x)) != 0 {
+        out[pos/8] |= 1 << uint(pos%8)
+      }
+      pos++
+    }
+  }
+  return out
+}
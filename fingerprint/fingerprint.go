@@ -0,0 +1,272 @@
+package fingerprint
+
+import (
+  "fmt"
+  "math"
+  "math/bits"
+  "math/cmplx"
+  "encoding/binary"
+)
+
+// matches chromaprint defaults (algorithm 2)
+const (
+  SampleRate = 11025
+  MaxLength = 120
+  frameSize = 4096
+  frameHop = frameSize / 3
+  minFreq = 28
+  maxFreq = 3520
+  numBands = 12
+)
+
+// decode audio file through ffmpeg to mono 16-bit PCM at SampleRate
+func Decode(exec func(args ...string) (string, error),
+  file string) ([]int16, error) {
+
+  out, err := exec([]string{ "-v", "quiet", "-i", file, "-t",
+    fmt.Sprintf("%d", MaxLength), "-ac", "1", "-ar",
+    fmt.Sprintf("%d", SampleRate), "-f", "s16le", "-" }...)
+  if err != nil {
+    return []int16{}, err
+  }
+
+  b := []byte(out)
+  samples := make([]int16, len(b)/2)
+  for x := range samples {
+    samples[x] = int16(binary.LittleEndian.Uint16(b[x*2:]))
+  }
+  return samples, nil
+}
+
+// compute chromaprint-compatible fingerprint from mono PCM at SampleRate
+func Compute(samples []int16) []uint32 {
+  return fingerprintImage(chroma(samples))
+}
+
+// Hamming window of frameSize
+var window = func() []float64 {
+  w := make([]float64, frameSize)
+  for x := range w {
+    w[x] = 0.54 - 0.46 * math.Cos(2 * math.Pi * float64(x) / (frameSize - 1))
+  }
+  return w
+}()
+
+// returns filtered & normalized chroma features, one slice per frame
+func chroma(samples []int16) [][]float64 {
+  minIndex := freqToIndex(minFreq)
+  maxIndex := freqToIndex(maxFreq)
+
+  // note (band) for each fft bin
+  notes := make([]int, maxIndex)
+  for i := minIndex; i < maxIndex; i++ {
+    freq := float64(i) * SampleRate / frameSize
+    octave := math.Log2(freq / (440.0 / 16.0))
+    notes[i] = int(numBands * (octave - math.Floor(octave)))
+  }
+
+  raw := [][]float64{}
+  buf := make([]complex128, frameSize)
+  for off := 0; off + frameSize <= len(samples); off += frameHop {
+    for x := range buf {
+      buf[x] = complex(float64(samples[off+x]) * window[x], 0)
+    }
+    fft(buf)
+
+    features := make([]float64, numBands)
+    for i := minIndex; i < maxIndex; i++ {
+      a := cmplx.Abs(buf[i])
+      features[notes[i]] += a * a
+    }
+    raw = append(raw, features)
+  }
+
+  // smooth over time with 5 coefficient filter, then normalize
+  coef := []float64{ 0.25, 0.75, 1.0, 0.75, 0.25 }
+  image := [][]float64{}
+  for x := 0; x + len(coef) <= len(raw); x++ {
+    row := make([]float64, numBands)
+    for y := range coef {
+      for b := range row {
+        row[b] += coef[y] * raw[x+y][b]
+      }
+    }
+    image = append(image, normalize(row))
+  }
+
+  return image
+}
+
+func freqToIndex(freq float64) int {
+  return int(math.Round(frameSize * freq / SampleRate))
+}
+
+// euclidean normalization; near silent frames become zero
+func normalize(row []float64) []float64 {
+  n := 0.0
+  for x := range row {
+    n += row[x] * row[x]
+  }
+  n = math.Sqrt(n)
+
+  for x := range row {
+    if n < 0.01 {
+      row[x] = 0
+    } else {
+      row[x] /= n
+    }
+  }
+  return row
+}
+
+// in-place iterative radix-2 fft; len(a) must be power of 2
+func fft(a []complex128) {
+  n := len(a)
+  for i, j := 1, 0; i < n; i++ {
+    bit := n >> 1
+    for ; j&bit != 0; bit >>= 1 {
+      j ^= bit
+    }
+    j ^= bit
+    if i < j {
+      a[i], a[j] = a[j], a[i]
+    }
+  }
+
+  for size := 2; size <= n; size <<= 1 {
+    w := cmplx.Exp(complex(0, -2 * math.Pi / float64(size)))
+    for start := 0; start < n; start += size {
+      wn := complex(1, 0)
+      for k := 0; k < size/2; k++ {
+        u, v := a[start+k], a[start+k+size/2] * wn
+        a[start+k], a[start+k+size/2] = u + v, u - v
+        wn *= w
+      }
+    }
+  }
+}
+
+type classifier struct {
+  kind, y, height, width int
+  thresholds [3]float64
+}
+
+// chromaprint TEST2 classifiers
+var classifiers = []classifier{
+  { 0, 4, 3, 15, [3]float64{ 1.98215, 2.35817, 2.63523 } },
+  { 4, 4, 6, 15, [3]float64{ -1.03809, -0.651211, -0.282167 } },
+  { 1, 0, 4, 16, [3]float64{ -0.298702, 0.119262, 0.558497 } },
+  { 3, 8, 2, 12, [3]float64{ -0.105439, 0.0153946, 0.135898 } },
+  { 3, 4, 4, 8, [3]float64{ -0.142891, 0.0258736, 0.200632 } },
+  { 4, 0, 3, 5, [3]float64{ -0.826319, -0.590612, -0.368214 } },
+  { 1, 2, 2, 9, [3]float64{ -0.557409, -0.233035, 0.0534525 } },
+  { 2, 7, 3, 4, [3]float64{ -0.0646826, 0.00620476, 0.0784847 } },
+  { 2, 6, 2, 16, [3]float64{ -0.192387, -0.029699, 0.215855 } },
+  { 2, 1, 3, 2, [3]float64{ -0.0397818, -0.00568076, 0.0292026 } },
+  { 5, 10, 1, 15, [3]float64{ -0.53823, -0.369934, -0.190235 } },
+  { 3, 6, 2, 10, [3]float64{ -0.124877, 0.0296483, 0.139239 } },
+  { 2, 1, 1, 14, [3]float64{ -0.101475, 0.0225617, 0.231971 } },
+  { 3, 5, 6, 4, [3]float64{ -0.0799915, -0.00729616, 0.063262 } },
+  { 1, 9, 2, 12, [3]float64{ -0.272556, 0.019424, 0.302559 } },
+  { 3, 4, 2, 14, [3]float64{ -0.164292, -0.0321188, 0.0846339 } },
+}
+
+// gray code of quantized values
+var grayCode = []uint32{ 0, 1, 3, 2 }
+
+func fingerprintImage(image [][]float64) []uint32 {
+  // integral image for constant time area sums
+  ii := make([][]float64, len(image)+1)
+  ii[0] = make([]float64, numBands+1)
+  for x := range image {
+    ii[x+1] = make([]float64, numBands+1)
+    for y := 0; y < numBands; y++ {
+      ii[x+1][y+1] = image[x][y] + ii[x][y+1] + ii[x+1][y] - ii[x][y]
+    }
+  }
+  area := func(x1, y1, x2, y2 int) float64 {
+    return ii[x2][y2] - ii[x1][y2] - ii[x2][y1] + ii[x1][y1]
+  }
+
+  maxWidth := 0
+  for _, c := range classifiers {
+    if c.width > maxWidth {
+      maxWidth = c.width
+    }
+  }
+
+  fp := []uint32{}
+  for x := 0; x + maxWidth <= len(image); x++ {
+    var v uint32
+    for _, c := range classifiers {
+      f := c.apply(area, x)
+      q := 0
+      for q < 3 && f >= c.thresholds[q] {
+        q++
+      }
+      v = (v << 2) | grayCode[q]
+    }
+    fp = append(fp, v)
+  }
+  return fp
+}
+
+func (c classifier) apply(area func(x1, y1, x2, y2 int) float64, x int) float64 {
+  y, w, h := c.y, c.width, c.height
+  var a, b float64
+
+  switch c.kind {
+  case 0:
+    a = area(x, y, x+w, y+h)
+  case 1:
+    h2 := h / 2
+    a = area(x, y+h2, x+w, y+h)
+    b = area(x, y, x+w, y+h2)
+  case 2:
+    w2 := w / 2
+    a = area(x+w2, y, x+w, y+h)
+    b = area(x, y, x+w2, y+h)
+  case 3:
+    w2, h2 := w / 2, h / 2
+    a = area(x, y+h2, x+w2, y+h) + area(x+w2, y, x+w, y+h2)
+    b = area(x, y, x+w2, y+h2) + area(x+w2, y+h2, x+w, y+h)
+  case 4:
+    h3 := h / 3
+    a = area(x, y+h3, x+w, y+2*h3)
+    b = area(x, y, x+w, y+h3) + area(x, y+2*h3, x+w, y+h)
+  case 5:
+    w3 := w / 3
+    a = area(x+w3, y, x+2*w3, y+h)
+    b = area(x, y, x+w3, y+h) + area(x+2*w3, y, x+w, y+h)
+  }
+
+  return math.Log((1 + a) / (1 + b))
+}
+
+// returns similarity from 0 to 1 of the best alignment of two fingerprints
+// within maxOffset items of each other (each item is ~0.124 seconds)
+func Similarity(a, b []uint32, maxOffset int) float64 {
+  best := 0.0
+  for off := -maxOffset; off <= maxOffset; off++ {
+    errs, n := 0, 0
+    for x := range a {
+      y := x + off
+      if y < 0 || y >= len(b) {
+        continue
+      }
+      errs += bits.OnesCount32(a[x] ^ b[y])
+      n++
+    }
+
+    // require meaningful overlap
+    if n == 0 || n < len(a) / 2 && n < len(b) / 2 {
+      continue
+    }
+
+    s := 1 - float64(errs) / float64(n * 32)
+    if s > best {
+      best = s
+    }
+  }
+  return best
+}
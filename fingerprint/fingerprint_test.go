@@ -0,0 +1,137 @@
+package fingerprint
+
+import (
+  "math"
+  "testing"
+  "net/http"
+  "net/http/httptest"
+)
+
+// generate melody of tones changing every quarter second
+func testSamples(seconds int, notes []float64) []int16 {
+  s := make([]int16, seconds * SampleRate)
+  for x := range s {
+    f := notes[(x / (SampleRate / 4)) % len(notes)]
+    s[x] = int16(8000 * math.Sin(2 * math.Pi * f * float64(x) / SampleRate))
+  }
+  return s
+}
+
+func TestDecode(t *testing.T) {
+  exec := func(args ...string) (string, error) {
+    return string([]byte{ 0x01, 0x00, 0xff, 0xff }), nil
+  }
+
+  s, err := Decode(exec, "file.flac")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(s) != 2 || s[0] != 1 || s[1] != -1 {
+    t.Errorf("Expected [1 -1], got %v", s)
+  }
+}
+
+func TestComputeSimilarity(t *testing.T) {
+  a := testSamples(20, []float64{ 262, 330, 392, 523, 440, 349 })
+  b := testSamples(20, []float64{ 196, 587, 247, 370, 659, 294, 415 })
+
+  fpA, fpB := Compute(a), Compute(b)
+  if len(fpA) == 0 {
+    t.Fatalf("Expected fingerprint")
+  }
+
+  // same audio with leading silence still aligns
+  shifted := Compute(append(make([]int16, frameHop * 10), a...))
+
+  tests := []struct {
+    a, b []uint32
+    min, max float64
+  }{
+    { a: fpA, b: fpA, min: 1, max: 1 },
+    { a: fpA, b: shifted, min: 0.9, max: 1 },
+    { a: fpA, b: fpB, min: 0, max: 0.8 },
+  }
+
+  for x := range tests {
+    s := Similarity(tests[x].a, tests[x].b, maxOffset)
+    if s < tests[x].min || s > tests[x].max {
+      t.Errorf("Expected between %v and %v, got %v", tests[x].min,
+        tests[x].max, s)
+    }
+  }
+}
+
+func TestEncode(t *testing.T) {
+  tests := []struct {
+    fp []uint32
+    result string
+  }{
+    // header: algorithm 1, length 1; bit 1 changed then end
+    { fp: []uint32{ 1 }, result: "AQAAAQE" },
+    // bit 9 changed requires exceptional value
+    { fp: []uint32{ 1 << 8 }, result: "AQAAAQcC" },
+  }
+
+  for x := range tests {
+    r := Encode(tests[x].fp)
+    if r != tests[x].result {
+      t.Errorf("Expected %v, got %v", tests[x].result, r)
+    }
+  }
+}
+
+func TestDBIdentifyDuplicates(t *testing.T) {
+  fpA := Compute(testSamples(20, []float64{ 262, 330, 392, 523, 440, 349 }))
+  fpB := Compute(testSamples(20, []float64{ 196, 587, 247, 370, 659, 294 }))
+
+  db := &DB{}
+  db.Add(&Entry{ Path: "a.flac", Title: "A", Duration: 20, Fingerprint: fpA })
+  db.Add(&Entry{ Path: "b.flac", Title: "B", Duration: 20, Fingerprint: fpB })
+  db.Add(&Entry{ Path: "c.mp3", Title: "A", Duration: 21, Fingerprint: fpA })
+  db.Add(&Entry{ Path: "c.mp3", Title: "C", Duration: 80, Fingerprint: fpA })
+
+  if len(db.Entries) != 3 {
+    t.Errorf("Expected 3 entries, got %v", len(db.Entries))
+  }
+
+  e, s, _ := db.Identify(fpB, 19)
+  if e == nil || e.Title != "B" || s != 1 {
+    t.Errorf("Expected B, got %v %v", e, s)
+  }
+
+  // c.mp3 duration differs too much to be a duplicate
+  d := db.Duplicates(0.95)
+  if len(d) != 0 {
+    t.Errorf("Expected no duplicates, got %v", len(d))
+  }
+
+  db.Add(&Entry{ Path: "c.mp3", Title: "A", Duration: 21, Fingerprint: fpA })
+  d = db.Duplicates(0.95)
+  if len(d) != 1 || len(d[0]) != 2 {
+    t.Errorf("Expected 1 group of 2, got %v", d)
+  }
+}
+
+func TestServiceIdentify(t *testing.T) {
+  ts := httptest.NewServer(http.HandlerFunc(
+    func(w http.ResponseWriter, r *http.Request) {
+      if r.URL.Path != "/v2/lookup" || r.FormValue("fingerprint") == "" {
+        http.NotFound(w, r)
+        return
+      }
+      w.Write([]byte(`{"status":"ok","results":[{"score":0.97,
+        "recordings":[{"title":"Sugaree","artists":[{"name":"Jerry Garcia"}],
+        "releases":[{"title":"Garcia"}]}]}]}`))
+  }))
+  defer ts.Close()
+
+  id, _ := New(ts.URL, "key")
+  e, s, err := id.Identify([]uint32{ 1, 2, 3 }, 300)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if e == nil || e.Title != "Sugaree" || e.Artist != "Jerry Garcia" ||
+    e.Album != "Garcia" || s != 0.97 {
+    t.Errorf("Unexpected result %v %v", e, s)
+  }
+}
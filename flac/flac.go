@@ -0,0 +1,223 @@
+package flac
+
+import (
+  "io"
+  "os"
+  "errors"
+  "strings"
+  "encoding/hex"
+  "encoding/binary"
+)
+
+// metadata block types
+const (
+  StreamInfo = 0
+  Padding = 1
+  VorbisComment = 4
+  Picture = 6
+)
+
+var ErrNotFlac = errors.New("Not a FLAC file")
+
+type Block struct {
+  Type int
+  Last bool
+  Data []byte
+}
+
+type Info struct {
+  SampleRate, Channels, BitsPerSample int
+  TotalSamples int64
+  // hex encoded MD5 of unencoded audio; empty if not set by encoder
+  MD5 string
+}
+
+// read all metadata blocks following "fLaC" marker
+func ReadBlocks(r io.Reader) ([]*Block, error) {
+  blocks := []*Block{}
+
+  marker := make([]byte, 4)
+  if _, err := io.ReadFull(r, marker); err != nil || string(marker) != "fLaC" {
+    return blocks, ErrNotFlac
+  }
+
+  for {
+    h := make([]byte, 4)
+    if _, err := io.ReadFull(r, h); err != nil {
+      return blocks, err
+    }
+
+    b := &Block{ Type: int(h[0] & 0x7F), Last: h[0] & 0x80 != 0 }
+    b.Data = make([]byte, int(h[1]) << 16 | int(h[2]) << 8 | int(h[3]))
+    if _, err := io.ReadFull(r, b.Data); err != nil {
+      return blocks, err
+    }
+
+    blocks = append(blocks, b)
+    if b.Last {
+      return blocks, nil
+    }
+  }
+}
+
+func ReadFile(file string) ([]*Block, error) {
+  f, err := os.Open(file)
+  if err != nil {
+    return []*Block{}, err
+  }
+  defer f.Close()
+
+  return ReadBlocks(f)
+}
+
+// parse STREAMINFO block from blocks
+func ReadInfo(blocks []*Block) (*Info, error) {
+  for _, b := range blocks {
+    if b.Type != StreamInfo || len(b.Data) < 34 {
+      continue
+    }
+
+    d := b.Data
+    i := &Info{
+      SampleRate: int(d[10]) << 12 | int(d[11]) << 4 | int(d[12]) >> 4,
+      Channels: int(d[12] >> 1 & 0x07) + 1,
+      BitsPerSample: (int(d[12] & 0x01) << 4 | int(d[13]) >> 4) + 1,
+      TotalSamples: int64(d[13] & 0x0F) << 32 | int64(d[14]) << 24 |
+        int64(d[15]) << 16 | int64(d[16]) << 8 | int64(d[17]),
+    }
+
+    md5 := d[18:34]
+    for _, c := range md5 {
+      if c != 0 {
+        i.MD5 = hex.EncodeToString(md5)
+        break
+      }
+    }
+    return i, nil
+  }
+
+  return &Info{}, errors.New("STREAMINFO not found")
+}
+
+// PICTURE block contents
+type PictureInfo struct {
+  // picture type, ie 3 for front cover
+  Type int
+  MIME, Description string
+  Width, Height, Depth, Colors int
+  Data []byte
+}
+
+// parse PICTURE block
+func ReadPicture(b *Block) (*PictureInfo, error) {
+  err := errors.New("Invalid PICTURE block")
+  d := b.Data
+  if b.Type != Picture {
+    return &PictureInfo{}, err
+  }
+
+  // read 32-bit big endian integer, advancing d
+  u32 := func() (int, bool) {
+    if len(d) < 4 {
+      return 0, false
+    }
+    v := int(binary.BigEndian.Uint32(d[:4]))
+    d = d[4:]
+    return v, true
+  }
+  // read length prefixed bytes, advancing d
+  str := func() ([]byte, bool) {
+    n, ok := u32()
+    if !ok || n > len(d) {
+      return nil, false
+    }
+    s := d[:n]
+    d = d[n:]
+    return s, true
+  }
+
+  p := &PictureInfo{}
+  var ok bool
+  var s []byte
+  if p.Type, ok = u32(); !ok {
+    return p, err
+  }
+  if s, ok = str(); !ok {
+    return p, err
+  }
+  p.MIME = string(s)
+  if s, ok = str(); !ok {
+    return p, err
+  }
+  p.Description = string(s)
+  for _, v := range []*int{ &p.Width, &p.Height, &p.Depth, &p.Colors } {
+    if *v, ok = u32(); !ok {
+      return p, err
+    }
+  }
+  if p.Data, ok = str(); !ok {
+    return p, err
+  }
+
+  return p, nil
+}
+
+// front cover, otherwise first PICTURE block; nil if none
+func FrontPicture(blocks []*Block) *PictureInfo {
+  var first *PictureInfo
+  for _, b := range blocks {
+    if b.Type != Picture {
+      continue
+    }
+    p, err := ReadPicture(b)
+    if err != nil {
+      continue
+    }
+    if p.Type == 3 {
+      return p
+    }
+    if first == nil {
+      first = p
+    }
+  }
+  return first
+}
+
+// vorbis comments from VORBIS_COMMENT block keyed by uppercase name; first
+// value is kept when a name repeats
+func Comments(blocks []*Block) map[string]string {
+  c := map[string]string{}
+  for _, b := range blocks {
+    if b.Type != VorbisComment {
+      continue
+    }
+
+    // vendor string, comment count, then length prefixed "NAME=value"
+    d := b.Data
+    if len(d) < 4 {
+      return c
+    }
+    n := int(binary.LittleEndian.Uint32(d))
+    if n + 8 > len(d) {
+      return c
+    }
+    count := int(binary.LittleEndian.Uint32(d[4+n:]))
+    d = d[8+n:]
+
+    for x := 0; x < count && len(d) >= 4; x++ {
+      n = int(binary.LittleEndian.Uint32(d))
+      if n + 4 > len(d) {
+        break
+      }
+      kv := strings.SplitN(string(d[4:4+n]), "=", 2)
+      d = d[4+n:]
+
+      k := strings.ToUpper(kv[0])
+      if _, ok := c[k]; !ok && len(kv) == 2 {
+        c[k] = kv[1]
+      }
+    }
+    return c
+  }
+  return c
+}
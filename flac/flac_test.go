@@ -0,0 +1,151 @@
+package flac
+
+import (
+  "bytes"
+  "testing"
+)
+
+// STREAMINFO: 44100Hz, 2 channels, 16 bits, 441000 samples, md5
+func testStreamInfo(md5 []byte) []byte {
+  d := make([]byte, 34)
+  d[10], d[11], d[12] = 0x0A, 0xC4, 0x42
+  d[13], d[14], d[15], d[16], d[17] = 0xF0, 0x00, 0x06, 0xBA, 0xA8
+  copy(d[18:], md5)
+  return d
+}
+
+func testFlac(blocks ...*Block) []byte {
+  b := []byte("fLaC")
+  for x, bl := range blocks {
+    h := byte(bl.Type)
+    if x == len(blocks) - 1 {
+      h |= 0x80
+    }
+    b = append(b, h, byte(len(bl.Data) >> 16), byte(len(bl.Data) >> 8),
+      byte(len(bl.Data)))
+    b = append(b, bl.Data...)
+  }
+  return b
+}
+
+func TestReadBlocks(t *testing.T) {
+  _, err := ReadBlocks(bytes.NewReader([]byte("ID3 not flac")))
+  if err != ErrNotFlac {
+    t.Errorf("Expected %v, got %v", ErrNotFlac, err)
+  }
+
+  blocks, err := ReadBlocks(bytes.NewReader(testFlac(
+    &Block{ Type: StreamInfo, Data: testStreamInfo(nil) },
+    &Block{ Type: Padding, Data: make([]byte, 10) },
+  )))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(blocks) != 2 || blocks[1].Type != Padding || !blocks[1].Last {
+    t.Errorf("Unexpected blocks %v", blocks)
+  }
+}
+
+func TestReadInfo(t *testing.T) {
+  md5 := []byte{ 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef,
+    0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef }
+
+  tests := []struct {
+    md5 []byte
+    info Info
+  }{
+    { md5: nil, info: Info{ SampleRate: 44100, Channels: 2,
+      BitsPerSample: 16, TotalSamples: 441000 } },
+    { md5: md5, info: Info{ SampleRate: 44100, Channels: 2,
+      BitsPerSample: 16, TotalSamples: 441000,
+      MD5: "0123456789abcdef0123456789abcdef" } },
+  }
+
+  for x := range tests {
+    i, err := ReadInfo([]*Block{ { Type: StreamInfo,
+      Data: testStreamInfo(tests[x].md5) } })
+    if err != nil {
+      t.Fatal(err)
+    }
+    if *i != tests[x].info {
+      t.Errorf("Expected %v, got %v", tests[x].info, *i)
+    }
+  }
+}
+
+// PICTURE block of type with mime & data
+func testPicture(typ int, mime string, data []byte) []byte {
+  b := []byte{}
+  u32 := func(v int) {
+    b = append(b, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v))
+  }
+  u32(typ)
+  u32(len(mime))
+  b = append(b, mime...)
+  u32(4)
+  b = append(b, "desc"...)
+  for _, v := range []int{ 600, 400, 24, 0, len(data) } {
+    u32(v)
+  }
+  return append(b, data...)
+}
+
+func TestReadPicture(t *testing.T) {
+  blocks, err := ReadBlocks(bytes.NewReader(testFlac(
+    &Block{ Type: StreamInfo, Data: testStreamInfo(nil) },
+    &Block{ Type: Picture, Data: testPicture(4, "image/png", []byte("back")) },
+    &Block{ Type: Picture, Data: testPicture(3, "image/jpeg", []byte("front")) },
+  )))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  p := FrontPicture(blocks)
+  if p == nil || p.Type != 3 || p.MIME != "image/jpeg" || p.Description != "desc" ||
+    p.Width != 600 || p.Height != 400 || string(p.Data) != "front" {
+    t.Errorf("Unexpected front picture %+v", p)
+  }
+
+  _, err = ReadPicture(&Block{ Type: Picture, Data: testPicture(3, "x", nil)[:10] })
+  if err == nil {
+    t.Errorf("Expected error for truncated PICTURE block")
+  }
+}
+
+// VORBIS_COMMENT block data of vendor & comments ("NAME=value")
+func testComments(vendor string, comments ...string) []byte {
+  le := func(n int) []byte {
+    return []byte{ byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24) }
+  }
+  b := append(le(len(vendor)), vendor...)
+  b = append(b, le(len(comments))...)
+  for _, c := range comments {
+    b = append(append(b, le(len(c))...), c...)
+  }
+  return b
+}
+
+func TestComments(t *testing.T) {
+  blocks := []*Block{
+    { Type: StreamInfo, Data: testStreamInfo(nil) },
+    { Type: VorbisComment, Data: testComments("reference libFLAC",
+      "ARTIST=Artist", "albumartist=Various Artists", "ARTIST=Other",
+      "COMPILATION=1", "invalid") },
+  }
+
+  c := Comments(blocks)
+  e := map[string]string{ "ARTIST": "Artist",
+    "ALBUMARTIST": "Various Artists", "COMPILATION": "1" }
+  if len(c) != len(e) {
+    t.Errorf("Expected %v, got %v", e, c)
+  }
+  for k, v := range e {
+    if c[k] != v {
+      t.Errorf("Expected %v=%v, got %v", k, v, c[k])
+    }
+  }
+
+  if c := Comments(blocks[:1]); len(c) != 0 {
+    t.Errorf("Expected no comments, got %v", c)
+  }
+}
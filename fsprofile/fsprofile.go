@@ -0,0 +1,224 @@
+package fsprofile
+
+import (
+  "fmt"
+  "sync"
+  "regexp"
+  "strings"
+  "io/ioutil"
+  "unicode/utf16"
+  "unicode/utf8"
+  "path/filepath"
+)
+
+// naming rules of the filesystem resulting paths are written to
+type Profile struct {
+  Name string
+  // characters not allowed within names
+  illegal *regexp.Regexp
+  // names not allowed (with or without extension), ie "CON", "AUX"
+  reserved map[string]bool
+  // remove trailing dots & spaces
+  trimTrailing bool
+  // names measured in UTF-16 units rather than bytes
+  utf16 bool
+  // maximum length of a name & of a path relative to the collection
+  MaxName, MaxPath int
+  // names differing only by case refer to the same file
+  CaseInsensitive bool
+}
+
+// names reserved by Windows, regardless of extension
+var windowsReserved = func() map[string]bool {
+  m := map[string]bool{ "CON": true, "PRN": true, "AUX": true, "NUL": true }
+  for x := 1; x <= 9; x++ {
+    m[fmt.Sprintf("COM%d", x)], m[fmt.Sprintf("LPT%d", x)] = true, true
+  }
+  return m
+}()
+
+var (
+  // Linux, macOS & other posix filesystems
+  Posix = &Profile{ Name: "posix", illegal: regexp.MustCompile(`[/\x00]+`),
+    MaxName: 255, MaxPath: 4095 }
+  // NTFS & SMB shares; path leaves room for drive or share prefix within
+  // MAX_PATH (260)
+  Windows = &Profile{ Name: "windows",
+    illegal: regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f]+`),
+    reserved: windowsReserved, trimTrailing: true, utf16: true,
+    MaxName: 255, MaxPath: 240, CaseInsensitive: true }
+  // FAT32 & exFAT (ie portable players, SD cards); as windows, also without
+  // DEL & with room for mount point prefix only
+  Fat32 = &Profile{ Name: "fat32",
+    illegal: regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f\x7f]+`),
+    reserved: windowsReserved, trimTrailing: true, utf16: true,
+    MaxName: 255, MaxPath: 250, CaseInsensitive: true }
+)
+
+var profiles = []*Profile{ Posix, Windows, Fat32 }
+
+// profile by name (default posix)
+func Get(name string) (*Profile, error) {
+  if len(name) == 0 {
+    return Posix, nil
+  }
+  for _, p := range profiles {
+    if strings.EqualFold(p.Name, name) {
+      return p, nil
+    }
+  }
+  return nil, fmt.Errorf("unknown filesystem profile: %v", name)
+}
+
+// length of s as measured by filesystem
+func (p *Profile) length(s string) int {
+  if p.utf16 {
+    return len(utf16.Encode([]rune(s)))
+  }
+  return len(s)
+}
+
+// trim s (at rune boundary) to max length, then clean end of name
+func (p *Profile) truncate(s string, max int) string {
+  for p.length(s) > max && len(s) > 0 {
+    _, size := utf8.DecodeLastRuneInString(s)
+    s = s[:len(s)-size]
+  }
+  return p.trimEnd(s)
+}
+
+func (p *Profile) trimEnd(s string) string {
+  if p.trimTrailing {
+    return strings.TrimRight(s, ". ")
+  }
+  return strings.TrimRight(s, " ")
+}
+
+// single name (folder, or file without extension) allowed by filesystem
+func (p *Profile) Clean(s string) string {
+  s = strings.TrimSpace(p.illegal.ReplaceAllString(s, ""))
+  s = p.truncate(s, p.MaxName)
+
+  base := strings.ToUpper(strings.SplitN(s, ".", 2)[0])
+  if p.reserved[strings.TrimSpace(base)] {
+    s = "_" + s
+  }
+  if len(s) == 0 {
+    s = "_"
+  }
+  return s
+}
+
+// shorten longest names of path (relative to collection, without
+// extension) until each name & whole path (with ext) fit within limits
+func (p *Profile) Shorten(path, ext string) string {
+  names := strings.Split(path, string(filepath.Separator))
+  last := len(names)-1
+
+  // file name includes extension
+  if max := p.MaxName - p.length(ext); p.length(names[last]) > max {
+    names[last] = p.truncate(names[last], max)
+  }
+
+  for {
+    total := p.length(ext) + len(names)-1
+    longest := 0
+    for x := range names {
+      total += p.length(names[x])
+      if p.length(names[x]) > p.length(names[longest]) {
+        longest = x
+      }
+    }
+
+    // names are kept at least 16 long
+    over := total - p.MaxPath
+    if over <= 0 || p.length(names[longest]) <= 16 {
+      break
+    }
+    max := p.length(names[longest]) - over
+    if max < 16 {
+      max = 16
+    }
+    names[longest] = p.truncate(names[longest], max)
+  }
+
+  return strings.Join(names, string(filepath.Separator)) + ext
+}
+
+// key of name as compared by filesystem
+func (p *Profile) key(s string) string {
+  if p.CaseInsensitive {
+    return strings.ToLower(s)
+  }
+  return s
+}
+
+// resulting paths claimed during a run, so names differing only by case
+// resolve to one folder & files never overwrite each other
+type Paths struct {
+  Profile *Profile
+  // root folder paths are relative to
+  Root string
+  mu sync.Mutex
+  claimed map[string]string
+}
+
+func (p *Profile) NewPaths(root string) *Paths {
+  return &Paths{ Profile: p, Root: root, claimed: map[string]string{} }
+}
+
+// path (relative to root) with folders matching case of folders already
+// claimed or found on disk, & file name suffixed (ie "01 Intro (2).mp3")
+// when already claimed
+func (c *Paths) Claim(path string) string {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+
+  names := strings.Split(path, string(filepath.Separator))
+  last := len(names)-1
+
+  for x := 0; x < last; x++ {
+    dir := filepath.Join(names[:x]...)
+    k := c.Profile.key(filepath.Join(dir, names[x]))
+    if existing, ok := c.claimed[k]; ok {
+      names[x] = existing
+      continue
+    }
+    if c.Profile.CaseInsensitive {
+      names[x] = c.existing(dir, names[x])
+    }
+    c.claimed[k] = names[x]
+  }
+
+  dir := filepath.Join(names[:last]...)
+  ext := filepath.Ext(names[last])
+  base := strings.TrimSuffix(names[last], ext)
+  for n := 2; ; n++ {
+    k := c.Profile.key(filepath.Join(dir, names[last]))
+    if _, ok := c.claimed[k]; !ok {
+      c.claimed[k] = names[last]
+      break
+    }
+    names[last] = fmt.Sprintf("%s (%d)%s", base, n, ext)
+  }
+
+  return filepath.Join(names...)
+}
+
+// name of folder within dir (under root) equal to name ignoring case
+func (c *Paths) existing(dir, name string) string {
+  infos, err := ioutil.ReadDir(filepath.Join(c.Root, dir))
+  if err != nil {
+    return name
+  }
+  found := name
+  for _, fi := range infos {
+    if fi.IsDir() && fi.Name() == name {
+      return name
+    }
+    if fi.IsDir() && strings.EqualFold(fi.Name(), name) {
+      found = fi.Name()
+    }
+  }
+  return found
+}
@@ -0,0 +1,106 @@
+package fsprofile
+
+import (
+  "os"
+  "strings"
+  "testing"
+  "io/ioutil"
+  "path/filepath"
+)
+
+func TestGet(t *testing.T) {
+  tests := map[string]*Profile{ "": Posix, "posix": Posix,
+    "Windows": Windows, "fat32": Fat32 }
+  for n, e := range tests {
+    if p, err := Get(n); err != nil || p != e {
+      t.Errorf("Expected %v, got %v %v", e.Name, p, err)
+    }
+  }
+  if _, err := Get("hfs"); err == nil {
+    t.Errorf("Expected error of unknown profile")
+  }
+}
+
+func TestClean(t *testing.T) {
+  tests := []struct {
+    p *Profile
+    s, result string
+  }{
+    { Posix, "Why? Because: \"Live\"", "Why? Because: \"Live\"" },
+    { Windows, "Why? Because: \"Live\"", "Why Because Live" },
+    { Windows, "Barton Hall, Ithaca, N.Y.", "Barton Hall, Ithaca, N.Y" },
+    { Fat32, "Trailing...  ", "Trailing" },
+    { Windows, "CON", "_CON" },
+    { Windows, "aux.live", "_aux.live" },
+    { Windows, "Console", "Console" },
+    { Posix, "CON", "CON" },
+    { Windows, "???", "_" },
+  }
+
+  for x := range tests {
+    if r := tests[x].p.Clean(tests[x].s); r != tests[x].result {
+      t.Errorf("Expected %v, got %v", tests[x].result, r)
+    }
+  }
+}
+
+func TestShorten(t *testing.T) {
+  long := strings.Repeat("Á", 200)
+  path := filepath.Join("Artist", "1977", long, "01 " + long)
+
+  r := Windows.Shorten(path, ".mp3")
+  if Windows.length(r) > Windows.MaxPath {
+    t.Errorf("Expected path within %v, got %v", Windows.MaxPath,
+      Windows.length(r))
+  }
+  if !strings.HasSuffix(r, ".mp3") ||
+    !strings.HasPrefix(r, filepath.Join("Artist", "1977") + "/") {
+    t.Errorf("Expected artist, year & extension kept, got %v", r)
+  }
+
+  // posix measures bytes (2 per "Á")
+  r = Posix.Shorten(filepath.Join("Artist", "01 " + long), ".mp3")
+  if n := len(filepath.Base(r)); n > Posix.MaxName {
+    t.Errorf("Expected name within %v bytes, got %v", Posix.MaxName, n)
+  }
+
+  if r = Posix.Shorten("Artist/01 a", ".mp3"); r != "Artist/01 a.mp3" {
+    t.Errorf("Expected path unchanged, got %v", r)
+  }
+}
+
+func TestClaim(t *testing.T) {
+  dir, err := ioutil.TempDir("", "fsprofile")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+  os.MkdirAll(filepath.Join(dir, "Phish", "1995", "1995 sampler"), 0777)
+
+  tests := []struct {
+    p *Profile
+    paths, results []string
+  }{
+    { Windows,
+      []string{ "Phish/1995/1995 Sampler/01 a.mp3", "phish/1995/1995 SAMPLER/01 A.mp3",
+        "Phish/1995/1995 Sampler/01 a.mp3" },
+      []string{ "Phish/1995/1995 sampler/01 a.mp3", "Phish/1995/1995 sampler/01 A (2).mp3",
+        "Phish/1995/1995 sampler/01 a (3).mp3" },
+    },
+    { Posix,
+      []string{ "Phish/1995/1995 Sampler/01 a.mp3", "phish/1995/1995 Sampler/01 a.mp3",
+        "Phish/1995/1995 Sampler/01 a.mp3" },
+      []string{ "Phish/1995/1995 Sampler/01 a.mp3", "phish/1995/1995 Sampler/01 a.mp3",
+        "Phish/1995/1995 Sampler/01 a (2).mp3" },
+    },
+  }
+
+  for x := range tests {
+    c := tests[x].p.NewPaths(dir)
+    for y := range tests[x].paths {
+      if r := c.Claim(tests[x].paths[y]); r != tests[x].results[y] {
+        t.Errorf("Expected %v, got %v", tests[x].results[y], r)
+      }
+    }
+  }
+}
@@ -0,0 +1,151 @@
+package audioc
+
+import (
+  "fmt"
+  "math"
+  "strconv"
+  "strings"
+  "io/ioutil"
+  "path/filepath"
+
+  "github.com/jamlib/libaudio/ffprobe"
+  "github.com/jamlib/audioc/mp3"
+  "github.com/jamlib/audioc/metadata"
+)
+
+// encode live performance (if --gapless) as one continuous stream, then split
+// at the exact sample boundaries of each source, so no encoder delay or
+// padding is heard between tracks. split files are kept within a.Gapless
+// (by source) until processMp3 moves them into place
+func (a *audioc) processGapless(indexes []int) error {
+  a.Gapless = map[string]string{}
+  if !a.Config.Gapless || !a.Config.Write ||
+    !metadata.New(a.Files[indexes[0]]).Info.IsLive() {
+    return nil
+  }
+
+  // only sources converted to mp3 (mp3 sources are never encoded again)
+  sources := []string{}
+  for _, index := range indexes {
+    if strings.ToLower(filepath.Ext(a.Files[index])) == ".mp3" ||
+      a.keepFlac(a.Files[index]) {
+      fmt.Printf("  * gapless: skipped, %v is not encoded\n", a.Files[index])
+      return nil
+    }
+    sources = append(sources, filepath.Join(a.Config.Dir, a.Files[index]))
+  }
+
+  // sample boundaries of each source; all must share rate & channels
+  bounds := []int{ 0 }
+  var format string
+  for _, src := range sources {
+    d, err := a.Ffprobe.GetData(src)
+    if err != nil {
+      return err
+    }
+
+    samples, exact := sourceSamples(d)
+    if !exact {
+      return fmt.Errorf("Gapless: sample count of %v unknown", src)
+    }
+    if f := audioStreamFormat(d); len(format) == 0 {
+      format = f
+    } else if f != format {
+      return fmt.Errorf("Gapless: %v (%v) differs from set (%v)", src, f,
+        format)
+    }
+    bounds = append(bounds, bounds[len(bounds)-1] + samples)
+  }
+
+  // concat demuxer list; quotes escaped within single quoted paths
+  list := filepath.Join(a.Workdir, "gapless.txt")
+  lines := []string{}
+  for _, src := range sources {
+    lines = append(lines, "file '" + strings.Replace(src, "'", `'\''`, -1) +
+      "'")
+  }
+  err := ioutil.WriteFile(list, []byte(strings.Join(lines, "\n") + "\n"), 0644)
+  if err != nil {
+    return err
+  }
+
+  set := filepath.Join(a.Workdir, "gapless.mp3")
+  args := []string{ "-f", "concat", "-safe", "0", "-i", list, "-map", "0:a",
+    "-c:a", "libmp3lame" }
+  if a.Config.Bitrate == "320" {
+    args = append(args, "-b:a", "320k")
+  } else {
+    args = append(args, "-qscale:a", "0")
+  }
+  _, err = a.Ffmpeg.Exec(append(args, "-y", set)...)
+  if err != nil {
+    return err
+  }
+
+  s, err := mp3.Scan(set)
+  if err != nil {
+    return err
+  }
+  if !s.Info.HasLame {
+    return fmt.Errorf("Gapless: %v", mp3.ErrNoLame)
+  }
+  if total := bounds[len(bounds)-1]; s.Samples() != total {
+    return fmt.Errorf("Gapless: encoded %d samples, sources have %d",
+      s.Samples(), total)
+  }
+
+  for x, src := range sources {
+    piece := filepath.Join(a.Workdir, fmt.Sprintf("gapless-%d.mp3", x))
+    err = s.Split(piece, bounds[x], bounds[x+1])
+    if err != nil {
+      return fmt.Errorf("Gapless: %v: %v", src, err)
+    }
+    a.Gapless[src] = piece
+  }
+
+  fmt.Printf("  * gapless: encoded %d tracks as one stream\n", len(sources))
+  return nil
+}
+
+// iTunes gapless info (iTunSMPB tag) of split file, from its LAME header
+func gaplessTags(file string) (map[string]string, error) {
+  i, err := mp3.ReadFile(file)
+  if err != nil {
+    return nil, err
+  }
+  if !i.HasLame {
+    return nil, fmt.Errorf("Gapless: %v: %v", file, mp3.ErrNoLame)
+  }
+  return map[string]string{ "ITUNSMPB": i.ITunSMPB() }, nil
+}
+
+// number of samples within first audio stream; exact when derived from
+// stream duration rather than format duration
+func sourceSamples(d *ffprobe.Data) (int, bool) {
+  for _, s := range d.Streams {
+    if s.CodecType != "audio" {
+      continue
+    }
+
+    rate, _ := strconv.Atoi(s.SampleRate)
+    var den uint64
+    fmt.Sscanf(s.TimeBase, "1/%d", &den)
+    if s.DurationTs > 0 && den > 0 && (s.DurationTs * uint64(rate)) % den == 0 {
+      return int(s.DurationTs * uint64(rate) / den), true
+    }
+    if d.Format != nil {
+      return int(math.Round(d.Format.Duration * float64(rate))), false
+    }
+  }
+  return 0, false
+}
+
+// sample rate & channels of first audio stream, ie "44100/2"
+func audioStreamFormat(d *ffprobe.Data) string {
+  for _, s := range d.Streams {
+    if s.CodecType == "audio" {
+      return fmt.Sprintf("%s/%d", s.SampleRate, s.Channels)
+    }
+  }
+  return ""
+}
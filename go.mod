@@ -2,4 +2,7 @@ module github.com/jamlib/audioc
 
 go 1.13
 
-require github.com/jamlib/libaudio v0.0.0-20191209230148-48889b810e8d
+require (
+	github.com/jamlib/libaudio v0.0.0-20191209230148-48889b810e8d
+	golang.org/x/image v0.0.0-20191206065243-da761ea9ff43
+)
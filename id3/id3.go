@@ -0,0 +1,268 @@
+package id3
+
+import (
+  "io"
+  "os"
+  "bytes"
+  "errors"
+  "encoding/binary"
+)
+
+// tag header flags
+const (
+  FlagUnsync = 0x80
+  FlagExtended = 0x40
+  FlagFooter = 0x10
+)
+
+var ErrNoTag = errors.New("No ID3v2 tag found")
+
+type Frame struct {
+  ID string
+  // status & format flags as stored (v2.3 or v2.4 layout)
+  Flags uint16
+  Data []byte
+}
+
+type Tag struct {
+  // major version: 2, 3 or 4
+  Version byte
+  Flags byte
+  // size of tag excluding 10 byte header (and footer)
+  Size int
+  Frames []*Frame
+}
+
+// attached picture (APIC or v2.2 PIC)
+type Picture struct {
+  MIME, Description string
+  Type int
+  Data []byte
+}
+
+func ReadFile(file string) (*Tag, error) {
+  f, err := os.Open(file)
+  if err != nil {
+    return &Tag{}, err
+  }
+  defer f.Close()
+
+  return Read(f)
+}
+
+// read ID3v2 tag from start of r
+func Read(r io.Reader) (*Tag, error) {
+  t := &Tag{}
+
+  head := make([]byte, 10)
+  if _, err := io.ReadFull(r, head); err != nil ||
+    !bytes.Equal(head[:3], []byte("ID3")) {
+    return t, ErrNoTag
+  }
+
+  t.Version, t.Flags = head[3], head[5]
+  t.Size = SyncsafeInt(head[6:10])
+  if t.Version < 2 || t.Version > 4 {
+    return t, ErrNoTag
+  }
+
+  b := make([]byte, t.Size)
+  if _, err := io.ReadFull(r, b); err != nil {
+    return t, err
+  }
+
+  // v2.2 & v2.3 unsynchronisation applies to whole tag
+  if t.Flags & FlagUnsync != 0 && t.Version < 4 {
+    b = Resync(b)
+  }
+
+  // skip extended header
+  if t.Flags & FlagExtended != 0 && len(b) >= 4 {
+    size := int(binary.BigEndian.Uint32(b[:4])) + 4
+    if t.Version == 4 {
+      size = SyncsafeInt(b[:4])
+    }
+    if size > len(b) {
+      return t, ErrNoTag
+    }
+    b = b[size:]
+  }
+
+  t.Frames = readFrames(t.Version, b)
+  return t, nil
+}
+
+func readFrames(version byte, b []byte) []*Frame {
+  frames := []*Frame{}
+
+  idLen, headLen := 4, 10
+  if version == 2 {
+    idLen, headLen = 3, 6
+  }
+
+  for len(b) >= headLen && b[0] != 0 {
+    f := &Frame{ ID: string(b[:idLen]) }
+
+    var size int
+    switch version {
+    case 2:
+      size = int(b[3]) << 16 | int(b[4]) << 8 | int(b[5])
+    case 3:
+      size = int(binary.BigEndian.Uint32(b[4:8]))
+    default:
+      size = SyncsafeInt(b[4:8])
+    }
+    if version > 2 {
+      f.Flags = binary.BigEndian.Uint16(b[8:10])
+    }
+
+    if size > len(b) - headLen {
+      break
+    }
+    f.Data = b[headLen:headLen+size]
+    b = b[headLen+size:]
+
+    // v2.4 frame unsynchronisation & data length indicator (compressed or
+    // encrypted frames are kept as stored)
+    if version == 4 && f.Flags & 0x000C == 0 {
+      if f.Flags & 0x0002 != 0 {
+        f.Data = Resync(f.Data)
+      }
+      if f.Flags & 0x0001 != 0 && len(f.Data) >= 4 {
+        f.Data = f.Data[4:]
+      }
+      f.Flags &^= 0x0003
+    }
+
+    frames = append(frames, f)
+  }
+
+  return frames
+}
+
+// first frame with id; nil if not found
+func (t *Tag) Frame(id string) *Frame {
+  for _, f := range t.Frames {
+    if f.ID == id {
+      return f
+    }
+  }
+  return nil
+}
+
+// frame data is compressed or encrypted (kept as stored, not decoded)
+func (t *Tag) encoded(f *Frame) bool {
+  switch t.Version {
+  case 3:
+    return f.Flags & 0x00C0 != 0
+  case 4:
+    return f.Flags & 0x000C != 0
+  }
+  return false
+}
+
+// attached pictures from APIC (or v2.2 PIC) frames; compressed or encrypted
+// frames are skipped
+func (t *Tag) Pictures() []*Picture {
+  pics := []*Picture{}
+  for _, f := range t.Frames {
+    if f.ID != "APIC" && f.ID != "PIC" || t.encoded(f) {
+      continue
+    }
+    if p := parsePicture(f); p != nil {
+      pics = append(pics, p)
+    }
+  }
+  return pics
+}
+
+// front cover, otherwise first picture; nil if none
+func (t *Tag) FrontPicture() *Picture {
+  pics := t.Pictures()
+  for _, p := range pics {
+    if p.Type == 3 {
+      return p
+    }
+  }
+  if len(pics) > 0 {
+    return pics[0]
+  }
+  return nil
+}
+
+func parsePicture(f *Frame) *Picture {
+  d := f.Data
+  if len(d) < 2 {
+    return nil
+  }
+  enc := d[0]
+  d = d[1:]
+
+  p := &Picture{}
+  if f.ID == "PIC" {
+    if len(d) < 4 {
+      return nil
+    }
+    p.MIME = "image/" + string(bytes.ToLower(d[:3]))
+    if p.MIME == "image/jpg" {
+      p.MIME = "image/jpeg"
+    }
+    d = d[3:]
+  } else {
+    x := bytes.IndexByte(d, 0)
+    if x < 0 {
+      return nil
+    }
+    p.MIME = string(d[:x])
+    d = d[x+1:]
+  }
+
+  if len(d) < 1 {
+    return nil
+  }
+  p.Type = int(d[0])
+  d = d[1:]
+
+  desc, rest := splitText(enc, d)
+  if rest == nil {
+    return nil
+  }
+  p.Description, p.Data = desc, rest
+  return p
+}
+
+// split null terminated text of encoding from remaining bytes; UTF-16
+// descriptions are returned as their raw bytes
+func splitText(enc byte, d []byte) (string, []byte) {
+  if enc == 1 || enc == 2 {
+    for x := 0; x + 1 < len(d); x += 2 {
+      if d[x] == 0 && d[x+1] == 0 {
+        return string(d[:x]), d[x+2:]
+      }
+    }
+    return "", nil
+  }
+
+  x := bytes.IndexByte(d, 0)
+  if x < 0 {
+    return "", nil
+  }
+  return string(d[:x]), d[x+1:]
+}
+
+// remove unsynchronisation (0x00 inserted after each 0xFF)
+func Resync(b []byte) []byte {
+  out := make([]byte, 0, len(b))
+  for x := 0; x < len(b); x++ {
+    out = append(out, b[x])
+    if b[x] == 0xFF && x + 1 < len(b) && b[x+1] == 0x00 {
+      x++
+    }
+  }
+  return out
+}
+
+// 28-bit integer stored within 4 bytes of 7 bits
+func SyncsafeInt(b []byte) int {
+  return int(b[0]) << 21 | int(b[1]) << 14 | int(b[2]) << 7 | int(b[3])
+}
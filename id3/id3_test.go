@@ -0,0 +1,296 @@
+package id3
+
+import (
+  "os"
+  "bytes"
+  "testing"
+  "io/ioutil"
+  "path/filepath"
+)
+
+// ID3v2 tag of version & flags containing frames (already encoded)
+func testTag(version, flags byte, frames []byte) []byte {
+  n := len(frames)
+  b := []byte{ 'I', 'D', '3', version, 0, flags,
+    byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F),
+    byte(n & 0x7F) }
+  return append(b, frames...)
+}
+
+// v2.3/v2.4 frame with flags; size is syncsafe if v2.4
+func testFrame(version byte, id string, flags uint16, data []byte) []byte {
+  n := len(data)
+  b := []byte(id)
+  if version == 4 {
+    b = append(b, byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F),
+      byte(n >> 7 & 0x7F), byte(n & 0x7F))
+  } else {
+    b = append(b, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n))
+  }
+  b = append(b, byte(flags >> 8), byte(flags))
+  return append(b, data...)
+}
+
+func TestRead(t *testing.T) {
+  apicBack := append([]byte("\x00image/png\x00\x04back\x00"), 0x89, 'P')
+  apicFront := append([]byte("\x00image/jpeg\x00\x03\x00"), 0xFF, 0xD8, 0xFF)
+
+  // v2.4 front picture unsynchronised with data length indicator
+  unsync := append([]byte{ 0, 0, 0, 0 }, []byte("\x00image/jpeg\x00\x03\x00")...)
+  unsync = append(unsync, 0xFF, 0x00, 0xD8, 0xFF, 0x00, 0xE0)
+
+  tests := []struct {
+    data []byte
+    err error
+    frames int
+    front string
+  }{
+    { data: []byte("not a tag"), err: ErrNoTag },
+    { data: testTag(3, 0, append(testFrame(3, "TIT2", 0, []byte("\x00Title")),
+        append(testFrame(3, "APIC", 0, apicBack),
+        testFrame(3, "APIC", 0, apicFront)...)...)),
+      frames: 3, front: "\xFF\xD8\xFF",
+    },{
+      data: testTag(4, 0, append(testFrame(4, "APIC", 0x0003, unsync),
+        make([]byte, 20)...)),
+      frames: 1, front: "\xFF\xD8\xFF\xE0",
+    },{
+      data: testTag(2, 0, append([]byte{ 'P', 'I', 'C', 0, 0, 8 },
+        []byte("\x00JPG\x03\x00ab")...)),
+      frames: 1, front: "ab",
+    },{
+      // v2.3 compressed front picture skipped for uncompressed back
+      data: testTag(3, 0, append(testFrame(3, "APIC", 0x0080,
+        append([]byte{ 0, 0, 0, 9 }, apicFront...)),
+        testFrame(3, "APIC", 0, apicBack)...)),
+      frames: 2, front: "\x89P",
+    },{
+      // v2.3 encrypted picture only
+      data: testTag(3, 0, testFrame(3, "APIC", 0x0040,
+        append([]byte{ 1 }, apicFront...))),
+      frames: 1,
+    },
+  }
+
+  for x := range tests {
+    tag, err := Read(bytes.NewReader(tests[x].data))
+    if err != tests[x].err {
+      t.Errorf("Expected %v, got %v", tests[x].err, err)
+      continue
+    }
+    if err != nil {
+      continue
+    }
+
+    if len(tag.Frames) != tests[x].frames {
+      t.Errorf("Expected %v frames, got %v", tests[x].frames, len(tag.Frames))
+    }
+
+    p := tag.FrontPicture()
+    if len(tests[x].front) == 0 {
+      if p != nil {
+        t.Errorf("Expected no front picture, got %+v", p)
+      }
+      continue
+    }
+    if p == nil || string(p.Data) != tests[x].front {
+      t.Errorf("Expected front picture %q, got %+v", tests[x].front, p)
+    }
+  }
+}
+
+func TestResync(t *testing.T) {
+  r := Resync([]byte{ 0xFF, 0x00, 0xE0, 0x00, 0xFF })
+  if !bytes.Equal(r, []byte{ 0xFF, 0xE0, 0x00, 0xFF }) {
+    t.Errorf("Unexpected %v", r)
+  }
+}
+
+func TestText(t *testing.T) {
+  tag := &Tag{ Version: 3 }
+  tag.SetText("TIT2", "Title")
+  tag.SetText("TPE1", "Björk")
+  tag.SetText("TALB", "日本")
+  tag.SetUserText("REPLAYGAIN_TRACK_GAIN", "-3.5 dB")
+
+  tests := map[string]string{ "TIT2": "Title", "TPE1": "Björk", "TALB": "日本" }
+  for id, v := range tests {
+    if tag.Text(id) != v {
+      t.Errorf("Expected %v %q, got %q", id, v, tag.Text(id))
+    }
+  }
+
+  if tag.Frame("TALB").Data[0] != encUTF16 || tag.Frame("TPE1").Data[0] != encLatin1 {
+    t.Errorf("Expected v2.3 Latin-1 & UTF-16 encodings")
+  }
+
+  if v := tag.UserText("replaygain_track_gain"); v != "-3.5 dB" {
+    t.Errorf("Expected user text, got %q", v)
+  }
+
+  tag.SetText("TIT2", "")
+  tag.SetUserText("REPLAYGAIN_TRACK_GAIN", "")
+  if len(tag.Frames) != 2 {
+    t.Errorf("Expected 2 frames, got %v", len(tag.Frames))
+  }
+
+  // v2.4 multiple values
+  tag = &Tag{ Version: 4, Frames: []*Frame{
+    { ID: "TPE1", Data: []byte("\x03One\x00Two") }}}
+  if v := tag.Text("TPE1"); v != "One/Two" {
+    t.Errorf("Expected One/Two, got %q", v)
+  }
+}
+
+func TestDateComment(t *testing.T) {
+  v3, v4 := &Tag{ Version: 3 }, New()
+  for _, tag := range []*Tag{ v3, v4 } {
+    tag.SetDate("1977-05-08")
+    tag.SetOriginalDate("1977-05-08")
+    tag.SetComment("日本 SBD")
+    tag.SetUserText("Source", "日本")
+
+    if c := tag.Comment(); c != "日本 SBD" {
+      t.Errorf("v2.%v: Expected comment, got %q", tag.Version, c)
+    }
+    if v := tag.UserText("source"); v != "日本" {
+      t.Errorf("v2.%v: Expected user text, got %q", tag.Version, v)
+    }
+  }
+
+  if v4.Text("TDRC") != "1977-05-08" || v4.Text("TDOR") != "1977-05-08" {
+    t.Errorf("Unexpected v2.4 dates %q %q", v4.Text("TDRC"), v4.Text("TDOR"))
+  }
+  if v3.Text("TYER") != "1977" || v3.Text("TDAT") != "0805" ||
+    v3.Text("TORY") != "1977" {
+    t.Errorf("Unexpected v2.3 dates %q %q %q", v3.Text("TYER"),
+      v3.Text("TDAT"), v3.Text("TORY"))
+  }
+
+  v3.SetDate("1978")
+  v3.SetComment("")
+  if v3.Text("TYER") != "1978" || v3.Frame("TDAT") != nil || v3.Comment() != "" {
+    t.Errorf("Expected year only & no comment, got %+v", v3.Frames)
+  }
+}
+
+func TestUpgrade(t *testing.T) {
+  b := testTag(2, 0, append([]byte{ 'T', 'T', '2', 0, 0, 6 },
+    append([]byte("\x00Title"), append([]byte{ 'P', 'I', 'C', 0, 0, 8 },
+    []byte("\x00JPG\x03\x00ab")...)...)...))
+
+  tag, err := Read(bytes.NewReader(b))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  tag.SetText("TPE1", "Artist")
+  tag, err = Read(bytes.NewReader(tag.Bytes(0)))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if tag.Version != 4 || tag.Text("TIT2") != "Title" ||
+    tag.Text("TPE1") != "Artist" {
+    t.Errorf("Unexpected upgraded tag %+v", tag)
+  }
+  if p := tag.FrontPicture(); p == nil || p.MIME != "image/jpeg" ||
+    string(p.Data) != "ab" {
+    t.Errorf("Unexpected upgraded picture %+v", p)
+  }
+}
+
+func TestWriteFile(t *testing.T) {
+  dir, err := ioutil.TempDir("", "id3")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  audio := []byte{ 0xFF, 0xFB, 0x90, 0x64 }
+  unknown := testFrame(4, "PRIV", 0, []byte("owner\x00data"))
+  file := filepath.Join(dir, "test.mp3")
+  data := append(testTag(4, 0, append(testFrame(4, "TIT2", 0,
+    []byte("\x03Old")), append(unknown, make([]byte, 100)...)...)), audio...)
+  if err := ioutil.WriteFile(file, data, 0644); err != nil {
+    t.Fatal(err)
+  }
+
+  // fits within padding: updated in place
+  tag, _ := ReadFile(file)
+  tag.SetText("TIT2", "New Title")
+  tag.SetPicture(&Picture{ MIME: "image/jpeg", Type: 3, Data: []byte("jpg") })
+  if err := WriteFile(file, tag); err != nil {
+    t.Fatal(err)
+  }
+
+  b, _ := ioutil.ReadFile(file)
+  if len(b) != len(data) || !bytes.HasSuffix(b, audio) {
+    t.Errorf("Expected in place update of %v bytes, got %v", len(data), len(b))
+  }
+
+  tag, _ = ReadFile(file)
+  if tag.Text("TIT2") != "New Title" || tag.Frame("PRIV") == nil ||
+    tag.FrontPicture() == nil {
+    t.Errorf("Unexpected tag after update %+v", tag.Frames)
+  }
+
+  // exceeds padding: rewritten with padding
+  tag.SetPicture(&Picture{ MIME: "image/jpeg", Type: 3,
+    Data: make([]byte, 500) })
+  if err := WriteFile(file, tag); err != nil {
+    t.Fatal(err)
+  }
+
+  b, _ = ioutil.ReadFile(file)
+  if !bytes.HasSuffix(b, audio) || len(b) < 500 + Padding {
+    t.Errorf("Expected rewritten file with padding, got %v bytes", len(b))
+  }
+  if fi, _ := os.Stat(file); fi.Mode().Perm() != 0644 {
+    t.Errorf("Expected mode %v, got %v", os.FileMode(0644), fi.Mode().Perm())
+  }
+
+  tag, _ = ReadFile(file)
+  if len(tag.Pictures()) != 1 || len(tag.FrontPicture().Data) != 500 {
+    t.Errorf("Expected replaced front picture, got %+v", tag.Pictures())
+  }
+
+  // file without tag
+  file = filepath.Join(dir, "none.mp3")
+  ioutil.WriteFile(file, audio, 0644)
+  tag = New()
+  tag.SetText("TALB", "Album")
+  if err := WriteFile(file, tag); err != nil {
+    t.Fatal(err)
+  }
+  tag, _ = ReadFile(file)
+  b, _ = ioutil.ReadFile(file)
+  if tag.Text("TALB") != "Album" || !bytes.HasSuffix(b, audio) {
+    t.Errorf("Expected new tag before audio")
+  }
+}
+
+func TestTexts(t *testing.T) {
+  tag := New()
+  tag.SetText("TCOM", "Garcia")
+  tag.SetUserText("MusicBrainz Album Id", "abc")
+  tag.SetComment("SBD")
+  tag.SetLyrics("la la")
+  tag.SetPicture(&Picture{ MIME: "image/jpeg", Type: 3, Data: []byte("jpg") })
+
+  texts := tag.Texts()
+  e := map[string]string{ "TCOM": "Garcia", "MusicBrainz Album Id": "abc",
+    "COMM": "SBD", "USLT": "la la" }
+  if len(texts) != len(e) {
+    t.Errorf("Expected %v, got %v", e, texts)
+  }
+  for k, v := range e {
+    if texts[k] != v {
+      t.Errorf("%v: Expected %q, got %q", k, v, texts[k])
+    }
+  }
+
+  if tag.Lyrics() != "la la" || tag.Comment() != "SBD" {
+    t.Errorf("Expected lyrics & comment, got %q %q", tag.Lyrics(), tag.Comment())
+  }
+}
@@ -0,0 +1,489 @@
+package id3
+
+import (
+  "io"
+  "os"
+  "bytes"
+  "strings"
+  "io/ioutil"
+  "unicode/utf16"
+  "path/filepath"
+  "encoding/binary"
+)
+
+// padding added when tag no longer fits & file is rewritten
+const Padding = 2048
+
+// text encodings
+const (
+  encLatin1 = 0
+  encUTF16 = 1
+  encUTF16BE = 2
+  encUTF8 = 3
+)
+
+// v2.2 frame ids mapped to v2.3/v2.4 ids; others are dropped when upgraded
+var upgradeIDs = map[string]string{
+  "TT2": "TIT2", "TP1": "TPE1", "TP2": "TPE2", "TAL": "TALB", "TRK": "TRCK",
+  "TPA": "TPOS", "TYE": "TDRC", "TCO": "TCON", "TCM": "TCOM", "TXX": "TXXX",
+  "COM": "COMM", "PIC": "APIC",
+}
+
+// new empty ID3v2.4 tag
+func New() *Tag {
+  return &Tag{ Version: 4, Frames: []*Frame{} }
+}
+
+// text of first frame with id (ie "TIT2"); multiple values are joined by "/"
+func (t *Tag) Text(id string) string {
+  f := t.Frame(id)
+  if f == nil || len(f.Data) < 1 || t.encoded(f) {
+    return ""
+  }
+  return strings.Join(splitValues(f.Data[0], f.Data[1:]), "/")
+}
+
+// replace text frame id with value (keeping its position); empty removes
+func (t *Tag) SetText(id, value string) {
+  t.upgrade()
+  if len(value) == 0 {
+    t.Remove(id)
+    return
+  }
+  t.setFrame(id, func(f *Frame) bool { return true }, t.encodeText(value))
+}
+
+// value of TXXX frame with description (case insensitive)
+func (t *Tag) UserText(desc string) string {
+  for _, f := range t.Frames {
+    if t.encoded(f) {
+      continue
+    }
+    if d, v, ok := userText(f); ok && strings.EqualFold(d, desc) {
+      return v
+    }
+  }
+  return ""
+}
+
+// replace TXXX frame with description; empty value removes
+func (t *Tag) SetUserText(desc, value string) {
+  t.upgrade()
+  match := func(f *Frame) bool {
+    d, _, ok := userText(f)
+    return ok && strings.EqualFold(d, desc)
+  }
+
+  if len(value) == 0 {
+    t.removeFunc("TXXX", match)
+    return
+  }
+
+  enc := t.encoding(desc, value)
+  data := append([]byte{ enc }, encodeString(enc, desc, true)...)
+  data = append(data, encodeString(enc, value, false)...)
+  t.setFrame("TXXX", match, data)
+}
+
+// recording date "YYYY[-MM-DD]" as v2.4 TDRC, or v2.3 TYER & TDAT (DDMM)
+func (t *Tag) SetDate(date string) {
+  t.upgrade()
+  if t.Version == 4 {
+    t.SetText("TDRC", date)
+    return
+  }
+
+  t.SetText("TYER", "")
+  t.SetText("TDAT", "")
+  if len(date) >= 4 {
+    t.SetText("TYER", date[:4])
+  }
+  if len(date) == 10 {
+    t.SetText("TDAT", date[8:10] + date[5:7])
+  }
+}
+
+// original release date as v2.4 TDOR, or v2.3 TORY (year only)
+func (t *Tag) SetOriginalDate(date string) {
+  t.upgrade()
+  if t.Version == 4 {
+    t.SetText("TDOR", date)
+    return
+  }
+
+  if len(date) > 4 {
+    date = date[:4]
+  }
+  t.SetText("TORY", date)
+}
+
+// text of COMM frame with empty description
+func (t *Tag) Comment() string {
+  return t.langText("COMM")
+}
+
+// replace COMM frame with empty description; empty value removes
+func (t *Tag) SetComment(value string) {
+  t.setLangText("COMM", value)
+}
+
+// text of USLT (unsynchronised lyrics) frame with empty description
+func (t *Tag) Lyrics() string {
+  return t.langText("USLT")
+}
+
+// replace USLT frame with empty description; empty value removes
+func (t *Tag) SetLyrics(value string) {
+  t.setLangText("USLT", value)
+}
+
+func (t *Tag) langText(id string) string {
+  for _, f := range t.Frames {
+    if d, v, ok := langText(f); ok && f.ID == id && len(d) == 0 {
+      return v
+    }
+  }
+  return ""
+}
+
+func (t *Tag) setLangText(id, value string) {
+  t.upgrade()
+  match := func(f *Frame) bool {
+    d, _, ok := langText(f)
+    return ok && len(d) == 0
+  }
+
+  if len(value) == 0 {
+    t.removeFunc(id, match)
+    return
+  }
+
+  enc := t.encoding(value)
+  data := append([]byte{ enc }, "eng"...)
+  data = append(data, encodeString(enc, "", true)...)
+  data = append(data, encodeString(enc, value, false)...)
+  t.setFrame(id, match, data)
+}
+
+// text frames (TXXX by description), comment & lyrics keyed by frame id;
+// other frames (ie pictures) are not included
+func (t *Tag) Texts() map[string]string {
+  texts := map[string]string{}
+  for _, f := range t.Frames {
+    var k, v string
+    switch {
+    case f.ID == "TXXX" || f.ID == "TXX":
+      d, text, ok := userText(f)
+      if !ok {
+        continue
+      }
+      k, v = d, text
+    case f.ID == "COMM" || f.ID == "USLT":
+      d, text, ok := langText(f)
+      if !ok || len(d) > 0 {
+        continue
+      }
+      k, v = f.ID, text
+    case f.ID[0] == 'T' && len(f.Data) > 0:
+      k, v = f.ID, strings.Join(splitValues(f.Data[0], f.Data[1:]), "/")
+    default:
+      continue
+    }
+
+    if _, ok := texts[k]; !ok {
+      texts[k] = v
+    }
+  }
+  return texts
+}
+
+// replace APIC frame of same picture type
+func (t *Tag) SetPicture(p *Picture) {
+  t.upgrade()
+  data := append([]byte{ encLatin1 }, p.MIME...)
+  data = append(data, 0, byte(p.Type))
+  data = append(data, p.Description...)
+  data = append(data, 0)
+  data = append(data, p.Data...)
+
+  t.setFrame("APIC", func(f *Frame) bool {
+    existing := parsePicture(f)
+    return existing == nil || existing.Type == p.Type
+  }, data)
+}
+
+// remove all frames with id
+func (t *Tag) Remove(id string) {
+  t.removeFunc(id, func(f *Frame) bool { return true })
+}
+
+func (t *Tag) removeFunc(id string, match func(f *Frame) bool) {
+  frames := []*Frame{}
+  for _, f := range t.Frames {
+    if f.ID != id || !match(f) {
+      frames = append(frames, f)
+    }
+  }
+  t.Frames = frames
+}
+
+// replace data of first matching frame, removing other matches; appended
+// if none match
+func (t *Tag) setFrame(id string, match func(f *Frame) bool, data []byte) {
+  frames := []*Frame{}
+  found := false
+  for _, f := range t.Frames {
+    if f.ID != id || !match(f) {
+      frames = append(frames, f)
+      continue
+    }
+    if !found {
+      found = true
+      frames = append(frames, &Frame{ ID: id, Data: data })
+    }
+  }
+  if !found {
+    frames = append(frames, &Frame{ ID: id, Data: data })
+  }
+  t.Frames = frames
+}
+
+// convert v2.2 tag to v2.4; frames without equivalent are dropped
+func (t *Tag) upgrade() {
+  if t.Version != 2 {
+    return
+  }
+
+  frames := []*Frame{}
+  for _, f := range t.Frames {
+    id, ok := upgradeIDs[f.ID]
+    if !ok {
+      continue
+    }
+
+    if f.ID == "PIC" {
+      p := parsePicture(f)
+      if p == nil {
+        continue
+      }
+      data := append([]byte{ encLatin1 }, p.MIME...)
+      data = append(data, 0, byte(p.Type), 0)
+      f = &Frame{ Data: append(data, p.Data...) }
+    }
+    frames = append(frames, &Frame{ ID: id, Data: f.Data })
+  }
+
+  t.Version, t.Frames = 4, frames
+}
+
+// text encoding able to hold strings: v2.4 uses UTF-8, v2.3 Latin-1 or
+// UTF-16
+func (t *Tag) encoding(strs ...string) byte {
+  if t.Version == 4 {
+    return encUTF8
+  }
+  for _, s := range strs {
+    for _, r := range s {
+      if r > 0xFF {
+        return encUTF16
+      }
+    }
+  }
+  return encLatin1
+}
+
+// encoded text frame data (encoding byte & text)
+func (t *Tag) encodeText(s string) []byte {
+  enc := t.encoding(s)
+  return append([]byte{ enc }, encodeString(enc, s, false)...)
+}
+
+// string of encoding; if terminated, followed by null terminator
+func encodeString(enc byte, s string, terminated bool) []byte {
+  b := []byte{}
+  switch enc {
+  case encUTF8:
+    b = append(b, s...)
+  case encUTF16:
+    // little endian with BOM
+    b = append(b, 0xFF, 0xFE)
+    for _, c := range utf16.Encode([]rune(s)) {
+      b = append(b, byte(c), byte(c >> 8))
+    }
+  default:
+    for _, r := range s {
+      b = append(b, byte(r))
+    }
+  }
+
+  if terminated {
+    b = append(b, 0)
+    if enc == encUTF16 {
+      b = append(b, 0)
+    }
+  }
+  return b
+}
+
+// description & value of TXXX frame
+func userText(f *Frame) (string, string, bool) {
+  if f.ID != "TXXX" && f.ID != "TXX" || len(f.Data) < 1 {
+    return "", "", false
+  }
+  desc, rest := splitText(f.Data[0], f.Data[1:])
+  if rest == nil {
+    return "", "", false
+  }
+  return decodeText(f.Data[0], []byte(desc)),
+    strings.Join(splitValues(f.Data[0], rest), "/"), true
+}
+
+// description & text of COMM or USLT frame (language is ignored)
+func langText(f *Frame) (string, string, bool) {
+  if f.ID != "COMM" && f.ID != "COM" && f.ID != "USLT" || len(f.Data) < 4 {
+    return "", "", false
+  }
+  desc, rest := splitText(f.Data[0], f.Data[4:])
+  if rest == nil {
+    return "", "", false
+  }
+  return decodeText(f.Data[0], []byte(desc)),
+    strings.Join(splitValues(f.Data[0], rest), "/"), true
+}
+
+// null separated values of encoding
+func splitValues(enc byte, b []byte) []string {
+  values := []string{}
+  for len(b) > 0 {
+    v, rest := splitText(enc, b)
+    if rest == nil {
+      v, rest = string(b), []byte{}
+    }
+    if s := decodeText(enc, []byte(v)); len(s) > 0 {
+      values = append(values, s)
+    }
+    b = rest
+  }
+  return values
+}
+
+func decodeText(enc byte, b []byte) string {
+  switch enc {
+  case encUTF16, encUTF16BE:
+    order := binary.ByteOrder(binary.BigEndian)
+    if len(b) >= 2 && b[0] == 0xFF && b[1] == 0xFE {
+      order, b = binary.LittleEndian, b[2:]
+    } else if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+      b = b[2:]
+    }
+    u := make([]uint16, 0, len(b)/2)
+    for x := 0; x + 1 < len(b); x += 2 {
+      u = append(u, order.Uint16(b[x:]))
+    }
+    return string(utf16.Decode(u))
+  case encUTF8:
+    return string(b)
+  }
+
+  // Latin-1
+  r := make([]rune, len(b))
+  for x, c := range b {
+    r[x] = rune(c)
+  }
+  return string(r)
+}
+
+// encoded tag (header, frames & padding); footer, extended header &
+// unsynchronisation are not written
+func (t *Tag) Bytes(padding int) []byte {
+  t.upgrade()
+
+  frames := []byte{}
+  for _, f := range t.Frames {
+    n := len(f.Data)
+    frames = append(frames, f.ID...)
+    if t.Version == 4 {
+      frames = append(frames, syncsafe(n)...)
+    } else {
+      frames = append(frames, byte(n >> 24), byte(n >> 16), byte(n >> 8),
+        byte(n))
+    }
+    frames = append(frames, byte(f.Flags >> 8), byte(f.Flags))
+    frames = append(frames, f.Data...)
+  }
+
+  size := len(frames) + padding
+  b := append([]byte{ 'I', 'D', '3', t.Version, 0, 0 }, syncsafe(size)...)
+  b = append(b, frames...)
+  return append(b, make([]byte, padding)...)
+}
+
+// size of existing tag at start of file including header & footer; 0 if none
+func tagSize(f io.ReaderAt) int {
+  head := make([]byte, 10)
+  if _, err := f.ReadAt(head, 0); err != nil ||
+    !bytes.Equal(head[:3], []byte("ID3")) {
+    return 0
+  }
+
+  size := 10 + SyncsafeInt(head[6:10])
+  if head[5] & FlagFooter != 0 {
+    size += 10
+  }
+  return size
+}
+
+// write tag to file; updated in place when tag fits within existing tag (and
+// its padding), otherwise file is rewritten with added padding
+func WriteFile(file string, t *Tag) error {
+  f, err := os.OpenFile(file, os.O_RDWR, 0)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+
+  existing := tagSize(f)
+  b := t.Bytes(0)
+  if existing > 0 && len(b) <= existing {
+    _, err = f.WriteAt(t.Bytes(existing - len(b)), 0)
+    return err
+  }
+
+  fi, err := f.Stat()
+  if err != nil {
+    return err
+  }
+
+  // rewrite with new tag followed by audio, keeping mode of original (temp
+  // files are created 0600)
+  tmp, err := ioutil.TempFile(filepath.Dir(file), ".id3-")
+  if err != nil {
+    return err
+  }
+  defer os.Remove(tmp.Name())
+
+  err = tmp.Chmod(fi.Mode().Perm())
+  if err == nil {
+    _, err = tmp.Write(t.Bytes(Padding))
+  }
+  if err == nil {
+    _, err = f.Seek(int64(existing), io.SeekStart)
+  }
+  if err == nil {
+    _, err = io.Copy(tmp, f)
+  }
+  if cerr := tmp.Close(); err == nil {
+    err = cerr
+  }
+  if err != nil {
+    return err
+  }
+
+  f.Close()
+  return os.Rename(tmp.Name(), file)
+}
+
+func syncsafe(n int) []byte {
+  return []byte{ byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F),
+    byte(n >> 7 & 0x7F), byte(n & 0x7F) }
+}
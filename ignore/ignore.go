@@ -0,0 +1,237 @@
+package ignore
+
+import (
+  "os"
+  "fmt"
+  "sort"
+  "bufio"
+  "regexp"
+  "strings"
+  "path/filepath"
+)
+
+// name of ignore files, found at any level of a collection
+const File = ".audiocignore"
+
+// line of ignore file (gitignore syntax), ie "*.wav", "/Unsorted/", "!keep/"
+type pattern struct {
+  // folder of ignore file, relative to root ("" if root)
+  base string
+  re *regexp.Regexp
+  negate, dirOnly bool
+}
+
+// patterns of all ignore files within a collection
+type Matcher struct {
+  patterns []*pattern
+}
+
+// read ignore files nested within root; patterns of deeper files take
+// precedence over those of their parent folders
+func Read(root string) (*Matcher, error) {
+  m := &Matcher{}
+  err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+    if err != nil {
+      return err
+    }
+    if fi.IsDir() || fi.Name() != File {
+      return nil
+    }
+
+    base, _ := filepath.Rel(root, filepath.Dir(p))
+    if base == "." {
+      base = ""
+    }
+    return m.read(p, filepath.ToSlash(base))
+  })
+
+  // deeper patterns come later (names like "- Live" walk before ".audiocignore")
+  sort.SliceStable(m.patterns, func(x, y int) bool {
+    return depth(m.patterns[x].base) < depth(m.patterns[y].base)
+  })
+  return m, err
+}
+
+func depth(base string) int {
+  if len(base) == 0 {
+    return 0
+  }
+  return strings.Count(base, "/") + 1
+}
+
+func (m *Matcher) read(file, base string) error {
+  f, err := os.Open(file)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+
+  var patterns []*pattern
+  s := bufio.NewScanner(f)
+  for line := 1; s.Scan(); line++ {
+    p, err := parse(s.Text(), base)
+    if err != nil {
+      return fmt.Errorf("%s:%d: %v", file, line, err)
+    }
+    if p != nil {
+      patterns = append(patterns, p)
+    }
+  }
+  if err = s.Err(); err != nil {
+    return err
+  }
+
+  m.patterns = append(m.patterns, patterns...)
+  return nil
+}
+
+// parse line of ignore file within base folder (slash separated, relative
+// to root); nil if blank or comment
+func parse(line, base string) (*pattern, error) {
+  // trailing spaces ignored unless escaped
+  line = strings.TrimRight(line, " \t")
+  if strings.HasSuffix(line, `\`) {
+    line += " "
+  }
+  if len(line) == 0 || strings.HasPrefix(line, "#") {
+    return nil, nil
+  }
+
+  p := &pattern{ base: base }
+  if strings.HasPrefix(line, "!") {
+    p.negate, line = true, line[1:]
+  } else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+    line = line[1:]
+  }
+
+  if strings.HasSuffix(line, "/") {
+    p.dirOnly, line = true, strings.TrimRight(line, "/")
+  }
+  if len(line) == 0 {
+    return nil, nil
+  }
+
+  // without a slash (other than trailing), matches name at any depth
+  anchored := strings.Contains(line, "/")
+  line = strings.TrimPrefix(line, "/")
+
+  expr := globRegexp(line)
+  if !anchored {
+    expr = "(.*/)?" + expr
+  }
+  re, err := regexp.Compile("^" + expr + "$")
+  if err != nil {
+    return nil, fmt.Errorf("Invalid pattern %q: %v", line, err)
+  }
+  p.re = re
+  return p, nil
+}
+
+// regular expression of gitignore glob; "**" matches any number of folders
+func globRegexp(glob string) string {
+  var b strings.Builder
+  for x := 0; x < len(glob); x++ {
+    c := glob[x]
+    switch {
+    case strings.HasPrefix(glob[x:], "**/"):
+      b.WriteString("(.*/)?")
+      x += 2
+    case strings.HasPrefix(glob[x:], "/**") && x+3 == len(glob):
+      b.WriteString("/.*")
+      x += 2
+    case strings.HasPrefix(glob[x:], "**"):
+      b.WriteString(".*")
+      x++
+    case c == '*':
+      b.WriteString("[^/]*")
+    case c == '?':
+      b.WriteString("[^/]")
+    case c == '\\' && x+1 < len(glob):
+      x++
+      b.WriteString(regexp.QuoteMeta(string(glob[x])))
+    case c == '[':
+      // "]" first within class (after any "!") is literal, ie "[]]"
+      start := x+1
+      if start < len(glob) && glob[start] == '!' {
+        start++
+      }
+      if start < len(glob) && glob[start] == ']' {
+        start++
+      }
+      end := strings.IndexByte(glob[start:], ']')
+      if end == -1 {
+        b.WriteString(`\[`)
+        continue
+      }
+      end += start
+      class := glob[x+1:end]
+      negate := strings.HasPrefix(class, "!")
+      if negate {
+        class = class[1:]
+      }
+      class = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(class)
+      if negate {
+        class = "^" + class
+      }
+      b.WriteString("[" + class + "]")
+      x = end
+    default:
+      b.WriteString(regexp.QuoteMeta(string(c)))
+    }
+  }
+  return b.String()
+}
+
+// true if path (relative to root) is ignored; as git, files within an
+// ignored folder are ignored even if a pattern would include them again
+func (m *Matcher) Match(path string, isDir bool) bool {
+  if m == nil || len(m.patterns) == 0 {
+    return false
+  }
+
+  names := strings.Split(filepath.ToSlash(path), "/")
+  for x := 1; x < len(names); x++ {
+    if m.match(strings.Join(names[:x], "/"), true) {
+      return true
+    }
+  }
+  return m.match(strings.Join(names, "/"), isDir)
+}
+
+// last matching pattern decides
+func (m *Matcher) match(path string, isDir bool) bool {
+  ignored := false
+  for _, p := range m.patterns {
+    if p.dirOnly && !isDir {
+      continue
+    }
+
+    rel := path
+    if len(p.base) > 0 {
+      if !strings.HasPrefix(path, p.base + "/") {
+        continue
+      }
+      rel = strings.TrimPrefix(path, p.base + "/")
+    }
+
+    if p.re.MatchString(rel) {
+      ignored = !p.negate
+    }
+  }
+  return ignored
+}
+
+// files (relative to root) not ignored
+func (m *Matcher) Filter(files []string) []string {
+  if m == nil || len(m.patterns) == 0 {
+    return files
+  }
+
+  kept := []string{}
+  for x := range files {
+    if !m.Match(files[x], false) {
+      kept = append(kept, files[x])
+    }
+  }
+  return kept
+}
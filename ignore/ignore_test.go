@@ -0,0 +1,125 @@
+package ignore
+
+import (
+  "os"
+  "strings"
+  "testing"
+  "io/ioutil"
+  "path/filepath"
+)
+
+func TestMatch(t *testing.T) {
+  m := &Matcher{}
+  for _, l := range []string{ "# comment", "", "*.wav", "Unsorted/",
+    "/Phish/1995/*Soundcheck*", "**/bootlegs/**", "!keep.wav", "logs/*.mp3",
+    "*[!0-9].flac", "[]]x.mp3", "[!]a]y.mp3" } {
+    p, err := parse(l, "")
+    if err != nil {
+      t.Fatal(err)
+    }
+    if p != nil {
+      m.patterns = append(m.patterns, p)
+    }
+  }
+  // nested ignore file within Ween folder
+  for _, l := range []string{ "/1997/", "!*.wav" } {
+    p, err := parse(l, "Ween")
+    if err != nil {
+      t.Fatal(err)
+    }
+    m.patterns = append(m.patterns, p)
+  }
+
+  tests := []struct {
+    path string
+    dir, ignored bool
+  }{
+    { "a.mp3", false, false },
+    { "Phish/1995/01 a.wav", false, true },
+    { "Phish/1995/keep.wav", false, false },
+    { "Unsorted", true, true },
+    { "Unsorted", false, false },
+    { "Phish/Unsorted/01 a.mp3", false, true },
+    { "Phish/1995/1995 Soundcheck/01 a.mp3", false, true },
+    { "Ween/1995/1995 Soundcheck/01 a.mp3", false, false },
+    { "Phish/bootlegs/x/01 a.mp3", false, true },
+    { "bootlegs/01 a.mp3", false, true },
+    { "logs/01 a.mp3", false, true },
+    { "Phish/logs/01 a.mp3", false, false },
+    { "Phish/01 a.flac", false, true },
+    { "Phish/01 a1.flac", false, false },
+    { "Ween/1997/01 a.mp3", false, true },
+    { "Ween/1998/01 a.wav", false, false },
+    { "Phish/1997/01 a.mp3", false, false },
+    { "]x.mp3", false, true },
+    { "bx.mp3", false, false },
+    { "by.mp3", false, true },
+    { "]y.mp3", false, false },
+  }
+
+  for i := range tests {
+    r := m.Match(tests[i].path, tests[i].dir)
+    if r != tests[i].ignored {
+      t.Errorf("%v: Expected %v, got %v", tests[i].path, tests[i].ignored, r)
+    }
+  }
+}
+
+func TestRead(t *testing.T) {
+  dir, err := ioutil.TempDir("", "")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  files := map[string]string{
+    File: "*.wav\n",
+    filepath.Join("Ween", File): "!*.wav\n1997/\n",
+  }
+  for f, s := range files {
+    os.MkdirAll(filepath.Join(dir, filepath.Dir(f)), 0777)
+    err = ioutil.WriteFile(filepath.Join(dir, f), []byte(s), 0644)
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+  // folder walked before root ignore file
+  os.MkdirAll(filepath.Join(dir, "- Ween"), 0777)
+
+  m, err := Read(dir)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  in := []string{ "Phish/01 a.wav", "Phish/02 b.mp3", "Ween/01 a.wav",
+    "Ween/1997/01 a.mp3", "Ween/Album 1997/01 a.mp3" }
+  e := []string{ "Phish/02 b.mp3", "Ween/01 a.wav", "Ween/Album 1997/01 a.mp3" }
+  r := m.Filter(in)
+  if len(r) != len(e) {
+    t.Fatalf("Expected %v, got %v", e, r)
+  }
+  for x := range e {
+    if r[x] != e[x] {
+      t.Errorf("Expected %v, got %v", e[x], r[x])
+    }
+  }
+}
+
+func TestReadInvalid(t *testing.T) {
+  dir, err := ioutil.TempDir("", "")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  err = ioutil.WriteFile(filepath.Join(dir, File),
+    []byte("*.wav\n[z-a].wav\n"), 0644)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  _, err = Read(dir)
+  if err == nil || !strings.Contains(err.Error(), File + ":2:") {
+    t.Errorf("Expected error of line 2, got %v", err)
+  }
+}
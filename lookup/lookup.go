@@ -0,0 +1,294 @@
+package lookup
+
+import (
+  "io"
+  "os"
+  "fmt"
+  "math"
+  "bufio"
+  "strings"
+  "net/url"
+  "net/http"
+  "encoding/json"
+)
+
+type Release struct {
+  ID, Title, Artist, Date string
+  Tracks []*Track
+}
+
+type Track struct {
+  ID, Title string
+  Disc, Number int
+  // length in milliseconds
+  Length int
+}
+
+// provides candidate releases for an artist and album
+type Provider interface {
+  Search(artist, album string) ([]*Release, error)
+}
+
+// release as encoded by the MusicBrainz web service & JSON dumps
+type mbRelease struct {
+  ID string `json:"id"`
+  Title string `json:"title"`
+  Date string `json:"date"`
+  ArtistCredit []struct {
+    Name string `json:"name"`
+  } `json:"artist-credit"`
+  Media []struct {
+    Position int `json:"position"`
+    Tracks []struct {
+      ID string `json:"id"`
+      Position int `json:"position"`
+      Title string `json:"title"`
+      Length int `json:"length"`
+    } `json:"tracks"`
+  } `json:"media"`
+}
+
+// returns http provider if source is url, otherwise JSON dump provider
+func New(source string) (Provider, error) {
+  if strings.HasPrefix(source, "http://") ||
+    strings.HasPrefix(source, "https://") {
+    return &HTTP{ BaseURL: strings.TrimSuffix(source, "/"),
+      Client: http.DefaultClient, Limit: 5 }, nil
+  }
+  return NewDump(source)
+}
+
+func (r *mbRelease) toRelease() *Release {
+  rel := &Release{ ID: r.ID, Title: r.Title, Date: r.Date }
+
+  names := []string{}
+  for x := range r.ArtistCredit {
+    names = append(names, r.ArtistCredit[x].Name)
+  }
+  rel.Artist = strings.Join(names, " & ")
+
+  for _, m := range r.Media {
+    for _, t := range m.Tracks {
+      rel.Tracks = append(rel.Tracks, &Track{ ID: t.ID, Title: t.Title,
+        Disc: m.Position, Number: t.Position, Length: t.Length })
+    }
+  }
+
+  return rel
+}
+
+// Year returns first 4 characters of release date
+func (r *Release) Year() string {
+  if len(r.Date) < 4 {
+    return ""
+  }
+  return r.Date[:4]
+}
+
+// Discs returns number of media within release
+func (r *Release) Discs() int {
+  discs := 0
+  for x := range r.Tracks {
+    if r.Tracks[x].Disc > discs {
+      discs = r.Tracks[x].Disc
+    }
+  }
+  return discs
+}
+
+// releases loaded from a MusicBrainz-style JSON dump, either a JSON array or
+// one release object per line
+type Dump struct {
+  Releases []*Release
+}
+
+func NewDump(file string) (*Dump, error) {
+  f, err := os.Open(file)
+  if err != nil {
+    return &Dump{}, err
+  }
+  defer f.Close()
+
+  return readDump(f)
+}
+
+func readDump(r io.Reader) (*Dump, error) {
+  d := &Dump{}
+  br := bufio.NewReader(r)
+
+  // peek first non-space character to determine if JSON array
+  var first byte
+  for {
+    b, err := br.Peek(1)
+    if err != nil {
+      return d, nil
+    }
+    if !strings.ContainsRune(" \t\r\n", rune(b[0])) {
+      first = b[0]
+      break
+    }
+    br.ReadByte()
+  }
+
+  dec := json.NewDecoder(br)
+  if first == '[' {
+    rels := []*mbRelease{}
+    if err := dec.Decode(&rels); err != nil {
+      return d, err
+    }
+    for x := range rels {
+      d.Releases = append(d.Releases, rels[x].toRelease())
+    }
+    return d, nil
+  }
+
+  for {
+    rel := &mbRelease{}
+    err := dec.Decode(rel)
+    if err == io.EOF {
+      break
+    }
+    if err != nil {
+      return d, err
+    }
+    d.Releases = append(d.Releases, rel.toRelease())
+  }
+
+  return d, nil
+}
+
+// returns releases by artist; if album is provided, must also match title
+func (d *Dump) Search(artist, album string) ([]*Release, error) {
+  found := []*Release{}
+  for _, r := range d.Releases {
+    if !strings.EqualFold(r.Artist, artist) {
+      continue
+    }
+    if len(album) > 0 && normalize(r.Title) != normalize(album) {
+      continue
+    }
+    found = append(found, r)
+  }
+  return found, nil
+}
+
+// queries a server implementing the MusicBrainz web service (/ws/2)
+type HTTP struct {
+  BaseURL string
+  Client *http.Client
+  Limit int
+}
+
+// lucene special characters, escaped within search terms
+var luceneEscaper = func() *strings.Replacer {
+  pairs := []string{}
+  for _, c := range `\+-&|!(){}[]^"~*?:/` {
+    pairs = append(pairs, string(c), `\` + string(c))
+  }
+  return strings.NewReplacer(pairs...)
+}()
+
+func (h *HTTP) Search(artist, album string) ([]*Release, error) {
+  q := fmt.Sprintf(`artist:"%s"`, luceneEscaper.Replace(artist))
+  if len(album) > 0 {
+    q += fmt.Sprintf(` AND release:"%s"`, luceneEscaper.Replace(album))
+  }
+
+  v := url.Values{}
+  v.Set("query", q)
+  v.Set("fmt", "json")
+  v.Set("limit", fmt.Sprintf("%d", h.Limit))
+
+  search := struct {
+    Releases []*mbRelease `json:"releases"`
+  }{}
+  err := h.get("/ws/2/release/?" + v.Encode(), &search)
+  if err != nil {
+    return []*Release{}, err
+  }
+
+  // search results do not include tracks, lookup each release
+  found := []*Release{}
+  for _, r := range search.Releases {
+    rel := &mbRelease{}
+    err = h.get("/ws/2/release/" + url.PathEscape(r.ID) +
+      "?inc=recordings+artist-credits&fmt=json", rel)
+    if err != nil {
+      return found, err
+    }
+    found = append(found, rel.toRelease())
+  }
+
+  return found, nil
+}
+
+func (h *HTTP) get(path string, v interface{}) error {
+  req, err := http.NewRequest("GET", h.BaseURL + path, nil)
+  if err != nil {
+    return err
+  }
+  req.Header.Set("User-Agent", "audioc")
+  req.Header.Set("Accept", "application/json")
+
+  resp, err := h.Client.Do(req)
+  if err != nil {
+    return err
+  }
+  defer resp.Body.Close()
+
+  if resp.StatusCode != http.StatusOK {
+    return fmt.Errorf("Lookup failed: %s", resp.Status)
+  }
+
+  return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// returns release whose track lengths best match durations (in seconds)
+// along with a score from 0 (no match) to 1 (exact)
+func Match(releases []*Release, durations []float64) (*Release, float64) {
+  var best *Release
+  bestScore := 0.0
+
+  for _, r := range releases {
+    s := Score(r, durations)
+    if s > bestScore {
+      best, bestScore = r, s
+    }
+  }
+
+  return best, bestScore
+}
+
+// tolerated difference (in seconds) before a track no longer matches
+const trackTolerance = 10.0
+
+// scores release against durations; track count must be equal
+func Score(r *Release, durations []float64) float64 {
+  if len(durations) == 0 || len(r.Tracks) != len(durations) {
+    return 0
+  }
+
+  total := 0.0
+  for x := range durations {
+    // unknown length on either side counts as half a match
+    if r.Tracks[x].Length == 0 || durations[x] == 0 {
+      total += 0.5
+      continue
+    }
+
+    diff := math.Abs(float64(r.Tracks[x].Length) / 1000 - durations[x])
+    total += math.Max(0, 1 - diff / trackTolerance)
+  }
+
+  return total / float64(len(durations))
+}
+
+// lowercase & remove all but letters and numbers
+func normalize(s string) string {
+  return strings.Map(func(r rune) rune {
+    if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+      return r
+    }
+    return -1
+  }, strings.ToLower(s))
+}
@@ -0,0 +1,122 @@
+package lookup
+
+import (
+  "strings"
+  "testing"
+  "net/http"
+  "net/http/httptest"
+)
+
+const testRelease = `{"id":"r1","title":"Blues for Allah","date":"1975-09-01",
+"artist-credit":[{"name":"Grateful Dead"}],"media":[{"position":1,"tracks":[
+{"id":"t1","position":1,"title":"Help on the Way","length":180000},
+{"id":"t2","position":2,"title":"Slipknot!","length":240000}]}]}`
+
+const testRelease2 = `{"id":"r2","title":"Terrapin Station","date":"1977",
+"artist-credit":[{"name":"Grateful Dead"}],"media":[{"position":1,"tracks":[
+{"id":"t3","position":1,"title":"Estimated Prophet","length":300000}]}]}`
+
+func TestReadDump(t *testing.T) {
+  tests := []struct {
+    input string
+    count int
+  }{
+    { input: "", count: 0 },
+    { input: testRelease + "\n" + testRelease2, count: 2 },
+    { input: " [" + testRelease + "," + testRelease2 + "]", count: 2 },
+  }
+
+  for x := range tests {
+    d, err := readDump(strings.NewReader(tests[x].input))
+    if err != nil {
+      t.Fatal(err)
+    }
+    if len(d.Releases) != tests[x].count {
+      t.Errorf("Expected %v, got %v", tests[x].count, len(d.Releases))
+    }
+  }
+}
+
+func TestDumpSearch(t *testing.T) {
+  d, _ := readDump(strings.NewReader(testRelease + testRelease2))
+
+  tests := []struct {
+    artist, album string
+    count int
+  }{
+    { artist: "grateful dead", count: 2 },
+    { artist: "Grateful Dead", album: "Blues For Allah", count: 1 },
+    { artist: "Phish", count: 0 },
+  }
+
+  for x := range tests {
+    r, _ := d.Search(tests[x].artist, tests[x].album)
+    if len(r) != tests[x].count {
+      t.Errorf("Expected %v, got %v", tests[x].count, len(r))
+    }
+  }
+}
+
+func TestHTTPSearch(t *testing.T) {
+  ts := httptest.NewServer(http.HandlerFunc(
+    func(w http.ResponseWriter, r *http.Request) {
+      switch r.URL.Path {
+      case "/ws/2/release/":
+        q := r.URL.Query().Get("query")
+        if q != `artist:"Grateful Dead" AND release:"Blues for Allah"` &&
+          q != `artist:"Grateful Dead" AND release:"Dick's Picks\: \"Vol 1\" \(CD\)"` {
+          t.Errorf("Unexpected query %v", q)
+        }
+        w.Write([]byte(`{"releases":[{"id":"r1"}]}`))
+      case "/ws/2/release/r1":
+        w.Write([]byte(testRelease))
+      default:
+        http.NotFound(w, r)
+      }
+  }))
+  defer ts.Close()
+
+  p, _ := New(ts.URL)
+  r, err := p.Search("Grateful Dead", "Blues for Allah")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(r) != 1 || len(r[0].Tracks) != 2 {
+    t.Fatalf("Expected 1 release with 2 tracks, got %v", r)
+  }
+  if r[0].Artist != "Grateful Dead" || r[0].Tracks[1].Title != "Slipknot!" {
+    t.Errorf("Unexpected release %v", r[0])
+  }
+
+  // special characters escaped
+  _, err = p.Search("Grateful Dead", `Dick's Picks: "Vol 1" (CD)`)
+  if err != nil {
+    t.Fatal(err)
+  }
+}
+
+func TestMatch(t *testing.T) {
+  d, _ := readDump(strings.NewReader(testRelease + testRelease2))
+
+  tests := []struct {
+    durations []float64
+    id string
+    score float64
+  }{
+    { durations: []float64{ 180, 240 }, id: "r1", score: 1 },
+    { durations: []float64{ 185, 240 }, id: "r1", score: 0.75 },
+    { durations: []float64{ 300 }, id: "r2", score: 1 },
+    { durations: []float64{ 1, 2, 3 }, id: "", score: 0 },
+  }
+
+  for x := range tests {
+    r, s := Match(d.Releases, tests[x].durations)
+    id := ""
+    if r != nil {
+      id = r.ID
+    }
+    if id != tests[x].id || s != tests[x].score {
+      t.Errorf("Expected %v %v, got %v %v", tests[x].id, tests[x].score, id, s)
+    }
+  }
+}
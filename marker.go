@@ -0,0 +1,220 @@
+package audioc
+
+import (
+  "os"
+  "fmt"
+  "bytes"
+  "bufio"
+  "strings"
+  "io/ioutil"
+  "path/filepath"
+
+  "github.com/jamlib/libaudio/fsutil"
+  "github.com/jamlib/audioc/ignore"
+)
+
+// name of per folder marker files
+const markerFile = ".audioc"
+
+// options of folder (& folders within) from marker file, one per line:
+// "keep-flac", "skip", "artist = Artist Name" or "album = Album Name"
+type marker struct {
+  // FLAC kept as is (as folder ending with " - FLAC")
+  KeepFlac bool
+  // folder skipped unless --force (as artist folder containing " - ")
+  Skip bool
+  // artist & album overrides (as --artist & --album)
+  Artist, Album string
+}
+
+// read marker file within dir; empty marker if none
+func readMarker(dir string) (*marker, error) {
+  m := &marker{}
+  f, err := os.Open(filepath.Join(dir, markerFile))
+  if os.IsNotExist(err) {
+    return m, nil
+  }
+  if err != nil {
+    return m, err
+  }
+  defer f.Close()
+
+  s := bufio.NewScanner(f)
+  for s.Scan() {
+    line := strings.TrimSpace(s.Text())
+    if len(line) == 0 || strings.HasPrefix(line, "#") {
+      continue
+    }
+
+    kv := strings.SplitN(line, "=", 2)
+    key := strings.ToLower(strings.TrimSpace(kv[0]))
+    value := ""
+    if len(kv) > 1 {
+      value = strings.TrimSpace(kv[1])
+    }
+
+    switch {
+    case key == "keep-flac" && len(kv) == 1:
+      m.KeepFlac = true
+    case key == "skip" && len(kv) == 1:
+      m.Skip = true
+    case key == "artist" && len(value) > 0:
+      m.Artist = value
+    case key == "album" && len(value) > 0:
+      m.Album = value
+    default:
+      return m, fmt.Errorf("Invalid marker in %s: %s", f.Name(), line)
+    }
+  }
+  return m, s.Err()
+}
+
+// combined with marker of parent folder; options of m take precedence
+func (m *marker) inherit(parent *marker) *marker {
+  r := *m
+  r.KeepFlac = r.KeepFlac || parent.KeepFlac
+  r.Skip = r.Skip || parent.Skip
+  if len(r.Artist) == 0 {
+    r.Artist = parent.Artist
+  }
+  if len(r.Album) == 0 {
+    r.Album = parent.Album
+  }
+  return &r
+}
+
+// read markers of each folder containing a.Files (& their parents within
+// a.Config.Dir), keyed by folder relative to a.Config.Dir
+func (a *audioc) readMarkers() error {
+  a.Markers = map[string]*marker{}
+
+  // --artist mode: a.Config.Dir is parent of provided PATH
+  top := 0
+  if a.Config.Artist != "" {
+    top = 1
+  }
+
+  for _, f := range a.Files {
+    names := strings.Split(filepath.Dir(f), fsutil.PathSep)
+    if names[0] == "." {
+      names = []string{}
+    }
+
+    parent := &marker{}
+    for x := top; x <= len(names); x++ {
+      dir := filepath.Join(names[:x]...)
+      if len(dir) == 0 {
+        dir = "."
+      }
+      if m, ok := a.Markers[dir]; ok {
+        parent = m
+        continue
+      }
+
+      m, err := readMarker(filepath.Join(a.Config.Dir, dir))
+      if err != nil {
+        return err
+      }
+      parent = m.inherit(parent)
+      a.Markers[dir] = parent
+    }
+  }
+  return nil
+}
+
+// FLAC kept as is: folder ends with " - FLAC" or marked keep-flac
+func (a *audioc) keepFlac(file string) bool {
+  return skipConvert(file) || a.marker(file).KeepFlac
+}
+
+// marker of folder containing file; empty marker if none
+func (a *audioc) marker(file string) *marker {
+  if m, ok := a.Markers[filepath.Dir(file)]; ok {
+    return m
+  }
+  return &marker{}
+}
+
+// marker & ignore files (.audioc, .audiocignore) nested within dir, relative
+// to dir
+func markerFiles(dir string) []string {
+  files := []string{}
+  filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+    if err != nil || info.IsDir() {
+      return nil
+    }
+    if n := info.Name(); n == markerFile || n == ignore.File {
+      rel, _ := filepath.Rel(dir, p)
+      files = append(files, rel)
+    }
+    return nil
+  })
+  return files
+}
+
+// error if a marker or ignore file of src differs from the one at the same
+// place within dest, since merging src into dest would lose one of them
+func markersConflict(src, dest string) error {
+  for _, f := range markerFiles(src) {
+    d, err := ioutil.ReadFile(filepath.Join(dest, f))
+    if os.IsNotExist(err) {
+      continue
+    }
+    if err != nil {
+      return err
+    }
+    b, err := ioutil.ReadFile(filepath.Join(src, f))
+    if err != nil {
+      return err
+    }
+    if !bytes.Equal(b, d) {
+      return fmt.Errorf("Cannot merge %v into %v: %v differs", src, dest, f)
+    }
+  }
+  return nil
+}
+
+// audio files nested within dir ignored by .audiocignore files, relative to
+// dir; left alone by processing, so merged along with their ignore files.
+// patterns read by audioFiles are reused
+func (a *audioc) ignoredFiles(dir string) ([]string, error) {
+  if a.Ignore == nil {
+    var err error
+    a.Ignore, err = ignore.Read(a.Config.Dir)
+    if err != nil {
+      return []string{}, err
+    }
+  }
+  rel, _ := filepath.Rel(a.Config.Dir, dir)
+
+  files := []string{}
+  for _, f := range fsutil.FilesAudio(dir) {
+    if a.Ignore.Match(filepath.Join(rel, f), false) {
+      files = append(files, f)
+    }
+  }
+  return files, nil
+}
+
+// move marker & ignore files from src into dest where not already present,
+// along with audio files they ignore (made unique if already present)
+func mergeMarkers(src, dest string) error {
+  for _, f := range append(markerFiles(src), fsutil.FilesAudio(src)...) {
+    target := filepath.Join(dest, f)
+    if _, err := os.Stat(target); err == nil {
+      if n := filepath.Base(f); n == markerFile || n == ignore.File {
+        continue
+      }
+      target = uniquePath(target)
+    }
+    err := os.MkdirAll(filepath.Dir(target), 0777)
+    if err != nil {
+      return err
+    }
+    err = os.Rename(filepath.Join(src, f), target)
+    if err != nil {
+      return err
+    }
+  }
+  return nil
+}
@@ -0,0 +1,74 @@
+package metadata
+
+import (
+  "regexp"
+  "strings"
+)
+
+// filename policies of resulting paths; tags always keep original text
+const (
+  // only A-Za-z0-9 & a few punctuation marks (default)
+  FilenamesStrict = "strict"
+  // unicode kept, only characters illegal within filenames removed
+  FilenamesUnicode = "unicode"
+  // unicode transliterated to ASCII (ie "ó" to "o"), then as strict
+  FilenamesASCII = "ascii"
+)
+
+// characters not allowed within filenames (of any common OS)
+var illegalRegexp = regexp.MustCompile(`[:*?"<>|\x00-\x1f\x7f]+`)
+
+// folder name (ie artist or album) per filename policy
+func FolderName(s, mode string) string {
+  s = regexp.MustCompile(`[\/\\]+`).ReplaceAllString(s, "-")
+
+  switch mode {
+  case FilenamesUnicode:
+    return fixWhitespace(illegalRegexp.ReplaceAllString(s, ""))
+  case FilenamesASCII:
+    s = Transliterate(s)
+  }
+  return fixWhitespace(regexp.MustCompile(`[^A-Za-z0-9',.!?&> _()\[\]-]+`).ReplaceAllString(s, ""))
+}
+
+// file name (ie track title) per filename policy
+func fileName(s, mode string) string {
+  switch mode {
+  case FilenamesUnicode:
+    s = regexp.MustCompile(`[\/\\]+`).ReplaceAllString(s, "-")
+    return fixWhitespace(illegalRegexp.ReplaceAllString(s, ""))
+  case FilenamesASCII:
+    s = Transliterate(s)
+  }
+  return safeFilename(s)
+}
+
+// ASCII replacements of accented letters, ligatures & typographic marks
+var transliterations = map[string]string{
+  "ÀÁÂÃÄÅĀĂĄ": "A", "àáâãäåāăą": "a", "ÇĆĈĊČ": "C", "çćĉċč": "c",
+  "ÐĎĐ": "D", "ðďđ": "d", "ÈÉÊËĒĔĖĘĚ": "E", "èéêëēĕėęě": "e",
+  "ĜĞĠĢ": "G", "ĝğġģ": "g", "ĤĦ": "H", "ĥħ": "h", "ÌÍÎÏĨĪĬĮİ": "I",
+  "ìíîïĩīĭįı": "i", "Ĵ": "J", "ĵ": "j", "Ķ": "K", "ķ": "k", "ĹĻĽĿŁ": "L",
+  "ĺļľŀł": "l", "ÑŃŅŇ": "N", "ñńņň": "n", "ÒÓÔÕÖØŌŎŐ": "O",
+  "òóôõöøōŏő": "o", "ŔŖŘ": "R", "ŕŗř": "r", "ŚŜŞŠ": "S", "śŝşš": "s",
+  "ŢŤŦ": "T", "ţťŧ": "t", "ÙÚÛÜŨŪŬŮŰŲ": "U", "ùúûüũūŭůűų": "u", "Ŵ": "W",
+  "ŵ": "w", "ÝŸŶ": "Y", "ýÿŷ": "y", "ŹŻŽ": "Z", "źżž": "z",
+  "Æ": "AE", "æ": "ae", "Œ": "OE", "œ": "oe", "ß": "ss", "Þ": "TH",
+  "þ": "th", "‘’‚′": "'", "“”„″": `"`, "‐‑‒–—―": "-", "…": "...",
+}
+
+var transliterator = func() *strings.Replacer {
+  pairs := []string{}
+  for from, to := range transliterations {
+    for _, r := range from {
+      pairs = append(pairs, string(r), to)
+    }
+  }
+  return strings.NewReplacer(pairs...)
+}()
+
+// replace accented letters (ie "Sigur Rós" to "Sigur Ros"), ligatures &
+// typographic marks with ASCII; other unicode is kept
+func Transliterate(s string) string {
+  return transliterator.Replace(s)
+}
@@ -16,11 +16,29 @@ type Metadata struct {
   Filepath, Resultpath string
   Match bool
   Info *Info
+  // filename policy used to compare info against tags (default strict)
+  Filenames string
 }
 
+// album artist of compilations (tracks by several artists)
+const VariousArtists = "Various Artists"
+
 type Info struct {
-  Artist, Album, Year, Month, Day string
+  // track artist; album artist when differs (ie compilation or guest)
+  Artist, AlbumArtist string
+  Compilation bool
+  Album, Year, Month, Day string
   Disc, Track, Title string
+  // set number or "E" (encore) from title markers
+  Set string
+  DiscTotal, TrackTotal string
+  Genre, Comment string
+  // original release date (ie of a reissue) when known, as "YYYY[-MM-DD]"
+  OriginalDate string
+  // MusicBrainz release & release track IDs
+  MBAlbumID, MBTrackID string
+  // recording source (SBD, AUD, MATRIX, FM) & archive ID (etree shnid)
+  Source, SourceID string
 }
 
 // filePath used to derive info
@@ -46,24 +64,77 @@ func New(filePath string) *Metadata {
 
 // build info from ffprobe.Tags
 func ProbeTagsToInfo(p *ffprobe.Tags) *Info {
-  return &Info{ Artist: p.Artist, Album: p.Album, Disc: p.Disc, Track: p.Track,
-    Title: p.Title }
+  i := &Info{ Artist: p.Artist, Album: p.Album, Disc: p.Disc, Track: p.Track,
+    Title: p.Title, DiscTotal: p.DiscTotal, TrackTotal: p.TrackTotal,
+    Genre: p.Genre, Comment: p.Comment }
+  i.Title = i.matchTitleTag(p.Title)
+
+  // date tag (ie "1977-05-08", "1977")
+  if m := regexp.MustCompile(`^(\d{4})(?:-(\d{2})(?:-(\d{2}))?)?`).FindStringSubmatch(p.Date); len(m) > 0 {
+    i.Year, i.Month, i.Day = m[1], m[2], m[3]
+  }
+
+  // split ID3 style "n/N" into number & total
+  if d := strings.SplitN(i.Disc, "/", 2); len(d) == 2 {
+    i.Disc = d[0]
+    if len(i.DiscTotal) == 0 {
+      i.DiscTotal = d[1]
+    }
+  }
+  if t := strings.SplitN(i.Track, "/", 2); len(t) == 2 {
+    i.Track = t[0]
+    if len(i.TrackTotal) == 0 {
+      i.TrackTotal = t[1]
+    }
+  }
+
+  return i
 }
 
 // compare file & path info against ffprobe.Tags info and combine into best
 // return includes boolean if info sources match (no update necessary)
 func (m *Metadata) MatchBestInfo(c, p *Info) (*Info, bool) {
-  // pull date info from ffprobe.Tags album and force merge into itself
-  p.mergeAlbumInfo(infoFromAlbum(p.Album), true)
+  // date tag is compared once info is combined
+  dateTag := p.DateTag()
+
+  // pull date info from ffprobe.Tags album and force merge into itself;
+  // album date takes precedence over date tag
+  a := infoFromAlbum(p.Album)
+  if len(a.Year) > 0 {
+    p.Year, p.Month, p.Day = "", "", ""
+  }
+  p.mergeAlbumInfo(a, true)
 
-  // compare using safeFilename since info is derived from filename
-  // and it is acceptable for tags to have special characters
-  compare := p
-  compare.Album = safeFilename(compare.Album)
-  compare.Title = safeFilename(compare.Title)
+  // totals, genre & comment are only found within tags
+  if len(m.Info.DiscTotal) == 0 {
+    m.Info.DiscTotal = p.DiscTotal
+  }
+  if len(m.Info.TrackTotal) == 0 {
+    m.Info.TrackTotal = p.TrackTotal
+  }
+  if len(m.Info.Genre) == 0 {
+    m.Info.Genre = p.Genre
+  }
+  if len(m.Info.Comment) == 0 {
+    m.Info.Comment = p.Comment
+  }
+  if len(m.Info.AlbumArtist) == 0 {
+    m.Info.AlbumArtist = p.AlbumArtist
+  }
+  if !m.Info.Compilation {
+    m.Info.Compilation = p.Compilation
+  }
+
+  // compare as filenames since info is derived from filename and it is
+  // acceptable for tags to have special characters (ie unicode)
+  info, compare := *m.Info, *p
+  info.Album = fileName(info.Album, m.Filenames)
+  info.Title = fileTitle(info.Title, m.Filenames)
+  compare.Album = fileName(compare.Album, m.Filenames)
+  compare.Title = fileTitle(compare.Title, m.Filenames)
 
   match := true
-  if *m.Info != *compare {
+  if info != compare {
     match = false
 
     // take longer album
@@ -78,10 +149,15 @@ func (m *Metadata) MatchBestInfo(c, p *Info) (*Info, bool) {
     if len(m.Info.Track) == 0 {
       m.Info.Track = regexp.MustCompile(`^\d+`).FindString(p.Track)
     }
-    // take longer title
-    if len(m.Info.Title) < len(p.Title) {
+    // take longer title; tag title (ie with segues or unicode) over same
+    // title from file
+    if len(m.Info.Title) < len(p.Title) ||
+      info.Title == compare.Title && len(p.Title) > 0 {
       m.Info.Title = p.Title
     }
+    if len(m.Info.Set) == 0 {
+      m.Info.Set = p.Set
+    }
   }
 
   // set custom artist
@@ -92,6 +168,15 @@ func (m *Metadata) MatchBestInfo(c, p *Info) (*Info, bool) {
     m.Info.Artist = c.Artist
   }
 
+  // set custom album artist & compilation
+  if len(c.AlbumArtist) > 0 {
+    if c.AlbumArtist != m.Info.AlbumArtist ||
+      c.Compilation != m.Info.Compilation {
+      match = false
+    }
+    m.Info.AlbumArtist, m.Info.Compilation = c.AlbumArtist, c.Compilation
+  }
+
   // set custom album
   if len(c.Album) > 0 {
     if c.Album != m.Info.ToAlbum() {
@@ -100,6 +185,11 @@ func (m *Metadata) MatchBestInfo(c, p *Info) (*Info, bool) {
     m.Info.mergeAlbumInfo(infoFromAlbum(c.Album), true)
   }
 
+  // date tag missing or differs
+  if dateTag != m.Info.DateTag() {
+    match = false
+  }
+
   return m.Info, match
 }
 
@@ -144,11 +234,17 @@ func (m *Metadata) fromFile(s string) {
 
   // match disc, track number, title
   s = m.Info.matchDiscTrack(s)
-  m.Info.Title = matchAlbumOrTitle(s)
+  m.Info.Title = m.Info.matchTitle(s)
+}
+
+// set album & date info from album string (ie "1977 Terrapin Station")
+func (i *Info) SetAlbum(s string) {
+  i.mergeAlbumInfo(infoFromAlbum(s), true)
 }
 
 func infoFromAlbum(s string) *Info {
   i := &Info{}
+  s = i.matchSource(s)
   s = i.matchDiscOnly(s)
   s = i.matchDate(s)
   s = i.matchYearOnly(s)
@@ -169,22 +265,119 @@ func (i *Info) mergeAlbumInfo(a *Info, force bool) {
   if len(a.Day) > 0 && (force || !force && len(i.Day) == 0) {
     i.Day = a.Day
   }
+  if len(a.Source) > 0 && (force || !force && len(i.Source) == 0) {
+    i.Source = a.Source
+  }
+  if len(a.SourceID) > 0 && (force || !force && len(i.SourceID) == 0) {
+    i.SourceID = a.SourceID
+  }
+}
+
+// live performances have a full date
+func (i *Info) IsLive() bool {
+  return len(i.Month) > 0 && len(i.Day) > 0
 }
 
 // returns album prefixed with fulldate, year, or nothing (if no year)
+// suffixed with source & source ID if known (ex: "Album [SBD 4982]")
 func (i *Info) ToAlbum() string {
+  album := i.Album
+  if len(i.Source) > 0 {
+    src := i.Source
+    if len(i.SourceID) > 0 {
+      src += " " + i.SourceID
+    }
+    album = fmt.Sprintf("%s [%s]", album, src)
+  }
+
   if len(i.Year) > 0 {
     if len(i.Month) > 0 && len(i.Day) > 0 {
-      return fmt.Sprintf("%s.%s.%s %s", i.Year, i.Month, i.Day, i.Album)
+      return fmt.Sprintf("%s.%s.%s %s", i.Year, i.Month, i.Day, album)
     }
-    return fmt.Sprintf("%s %s", i.Year, i.Album)
+    return fmt.Sprintf("%s %s", i.Year, album)
+  }
+  return album
+}
+
+// returns album artist, otherwise artist (ex: "Various Artists")
+func (i *Info) ToArtist() string {
+  if len(i.AlbumArtist) > 0 {
+    return i.AlbumArtist
   }
-  return i.Album
+  return i.Artist
+}
+
+// returns tags not covered by ffmpeg.Metadata keyed by vorbis comment name
+func (i *Info) ExtraTags() map[string]string {
+  t := map[string]string{}
+  if len(i.MBAlbumID) > 0 {
+    t["MUSICBRAINZ_ALBUMID"] = i.MBAlbumID
+  }
+  if len(i.MBTrackID) > 0 {
+    t["MUSICBRAINZ_RELEASETRACKID"] = i.MBTrackID
+  }
+  if len(i.Source) > 0 {
+    t["SOURCE"] = i.Source
+  }
+  if len(i.SourceID) > 0 {
+    t["SHNID"] = i.SourceID
+  }
+  if d := i.DateTag(); len(d) > 0 {
+    t["DATE"] = d
+  }
+  if len(i.OriginalDate) > 0 {
+    t["ORIGINALDATE"] = i.OriginalDate
+  }
+  if a := i.ToArtist(); len(a) > 0 {
+    t["ALBUMARTIST"] = a
+  }
+  if i.Compilation {
+    t["COMPILATION"] = "1"
+  }
+  if len(i.Genre) > 0 {
+    t["GENRE"] = i.Genre
+  }
+  if len(i.Comment) > 0 {
+    t["COMMENT"] = i.Comment
+  }
+  if len(i.Set) > 0 {
+    t["SET"] = i.Set
+  }
+  return t
+}
+
+// returns date as "YYYY-MM-DD" (first day of multi-day run), or "YYYY" when
+// only year is known (ID3 TDRC, vorbis DATE)
+func (i *Info) DateTag() string {
+  if len(i.Year) == 0 {
+    return ""
+  }
+  day := regexp.MustCompile(`^\d{2}`).FindString(i.Day)
+  if len(i.Month) > 0 && len(day) > 0 {
+    return i.Year + "-" + i.Month + "-" + day
+  }
+  return i.Year
+}
+
+// returns disc as "n/N" when total is known (ID3 TPOS)
+func (i *Info) DiscTag() string {
+  if len(i.Disc) > 0 && len(i.DiscTotal) > 0 {
+    return i.Disc + "/" + i.DiscTotal
+  }
+  return i.Disc
+}
+
+// returns track as "n/N" when total is known (ID3 TRCK)
+func (i *Info) TrackTag() string {
+  if len(i.Track) > 0 && len(i.TrackTotal) > 0 {
+    return i.Track + "/" + i.TrackTotal
+  }
+  return i.Track
 }
 
 // returns filename string from Disc, Track, Title (ex: "01-01 Title")
-// without Disc (ex: "01 Title")
-func (i *Info) ToFile() string {
+// without Disc (ex: "01 Title") per filename policy
+func (i *Info) ToFile(mode string) string {
   // closure to pad Disc & Track
   pad := func (s string) string {
     d, _ := strconv.Atoi(s)
@@ -201,7 +394,7 @@ func (i *Info) ToFile() string {
   if len(i.Track) > 0 {
     out += pad(i.Track) + " "
   }
-  return out + safeFilename(i.Title)
+  return out + fileTitle(i.Title, mode)
 }
 
 // converts roman numeral to int; only needs to support up to 5
@@ -342,6 +535,15 @@ func (i *Info) matchDiscTrack(s string) string {
   return s
 }
 
+// returns disc number if folder name only identifies a disc (ie "CD1")
+func DiscFolder(name string) string {
+  m := regexp.MustCompile(`^(?i)\s*(cd|disc|set|disk)\s*(\d{1,2})\s*$`).FindStringSubmatch(name)
+  if len(m) < 3 {
+    return ""
+  }
+  return regexp.MustCompile(`^0+`).ReplaceAllString(m[2], "")
+}
+
 func (i *Info) matchDiscOnly(s string) string {
   m, r := regexpMatch(s, `(?i)(cd|disc|set|disk)\s*(?P<disc>\d{1,2})\s*`)
   if len(m) >= 3 && len(i.Disc) == 0 {
@@ -362,11 +564,92 @@ func regexpMatch(s, regExpStr string) ([]string, string) {
   return m, s
 }
 
+// recording source names; mtx is shorthand for matrix
+var sourceNames = map[string]string{
+  "sbd": "SBD", "aud": "AUD", "matrix": "MATRIX", "mtx": "MATRIX", "fm": "FM",
+}
+
+// archive ID (etree shnid) within brackets or following "shnid"
+var sourceIDRegexps = []string{
+  `(?i)shnid[\s#:=_.-]*(\d+)`,
+  `(?:^|\s)(\d{4,7})(?:\s|$)`,
+}
+
+// match & remove source from album string. source & ID within trailing
+// brackets (ie "[SBD 4982]") are removed while source words elsewhere (ie
+// "Barton Hall SBD") are only matched
+func (i *Info) matchSource(s string) string {
+  // from anywhere: shnid
+  m, _ := regexpMatch(s, sourceIDRegexps[0])
+  if len(m) > 1 {
+    i.SourceID = m[1]
+    s = fixWhitespace(strings.Replace(s, m[0], " ", 1))
+  }
+
+  // from end: [*] containing source
+  m, _ = regexpMatch(s, `\s*\[([^\[\]]*)\]\s*$`)
+  if len(m) > 1 {
+    if src := sourceFromString(m[1]); len(src) > 0 {
+      i.Source = src
+      if id, _ := regexpMatch(m[1], sourceIDRegexps[1]); len(id) > 1 {
+        i.SourceID = id[1]
+      }
+      return strings.TrimSuffix(s, m[0])
+    }
+  }
+
+  // anywhere: bracketed source only, ie "(SBD)"
+  m, _ = regexpMatch(s, `(?i)\s*[\(\[]\s*(sbd|aud|matrix|mtx|fm)\s*[\)\]]`)
+  if len(m) > 1 {
+    i.Source = sourceNames[strings.ToLower(m[1])]
+    return fixWhitespace(strings.Replace(s, m[0], " ", 1))
+  }
+
+  // from end: uppercase source word (except FM, common within station
+  // names), ie "Barton Hall SBD"; "The Matrix" is kept
+  m, _ = regexpMatch(s, `(?:\s+-)?\s+(SBD|AUD|MATRIX|MTX)\s*$`)
+  if len(m) > 1 {
+    i.Source = sourceNames[strings.ToLower(m[1])]
+    return strings.TrimSuffix(s, m[0])
+  }
+  return s
+}
+
+// returns first source name found as a word within string
+func sourceFromString(s string) string {
+  m := regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(sbd|aud|matrix|mtx|fm)(?:[^a-z0-9]|$)`).FindStringSubmatch(s)
+  if len(m) < 2 {
+    return ""
+  }
+  return sourceNames[strings.ToLower(m[1])]
+}
+
+// derive source & archive ID from info text file contents. source only from
+// lines starting with "source" or "lineage" (ie "FM radio" elsewhere within
+// notes is not a source)
+func SourceFromText(text string) *Info {
+  i := &Info{}
+
+  lines := regexp.MustCompile(`(?im)^\s*(?:source|src|lineage)[^:=]*[:=](.*)$`).FindAllStringSubmatch(text, -1)
+  for x := range lines {
+    if i.Source = sourceFromString(lines[x][1]); len(i.Source) > 0 {
+      break
+    }
+  }
+
+  if m, _ := regexpMatch(text, sourceIDRegexps[0]); len(m) > 1 {
+    i.SourceID = m[1]
+  }
+
+  return i
+}
+
 var albumTitleRemoveRegexps = []string{
   // from end: remove [*] from end where * is wildcard
   `\s*\[[^\[\]]*\]\s*$`,
-  // anywhere: only these chars allowed: A-Za-z0-9-',.!?&> _()
-  `[^A-Za-z0-9-',.!?&> _()]+`,
+  // anywhere: only letters (any language), numbers & these chars allowed:
+  // -',.!?&> _()
+  `[^\p{L}\p{M}\p{N}',.!?&> _()-]+`,
   // anywhere: remove () (1) ( )
   `\s*\({1}[\d\s]*\){1}\s*`,
   // from end: remove file extension
@@ -17,6 +17,10 @@ func TestToAlbum(t *testing.T) {
     },{
       i: &Info{ Year: "2004", Album: "Great Album" },
       result: "2004 Great Album",
+    },{
+      i: &Info{ Year: "1977", Month: "05", Day: "08", Album: "Barton Hall",
+        Source: "SBD", SourceID: "4982" },
+      result: "1977.05.08 Barton Hall [SBD 4982]",
     },
   }
 
@@ -38,11 +42,20 @@ func TestToFile(t *testing.T) {
     },{
       i: &Info{ Disc: "2", Track: "03", Title: "Russian Lullaby" },
       result: "02-03 Russian Lullaby",
+    },{
+      i: &Info{ Track: "4", Title: "Scarlet Begonias > Fire on the Mountain" },
+      result: "04 Scarlet Begonias - Fire on the Mountain",
+    },{
+      i: &Info{ Track: "5", Title: "Dark Star >" },
+      result: "05 Dark Star",
+    },{
+      i: &Info{ Track: "1", Title: "Motörhead" },
+      result: "01 Motrhead",
     },
   }
 
   for x := range tests {
-    r := tests[x].i.ToFile()
+    r := tests[x].i.ToFile(FilenamesStrict)
     if r != tests[x].result {
       t.Errorf("Expected %v, got %v", tests[x].result, r)
     }
@@ -60,11 +73,29 @@ func TestMatchProbeInfo(t *testing.T) {
       tags: &ffprobe.Tags{ Album: "Something Else" },
       comb: &Info{ Album: "Kean College After Midnight", Title: "After Midnight" },
       match: false,
+    },{
+      m: &Metadata{Info: &Info{ Album: "Kean College After Midnight", Year: "1980" }},
+      tags: &ffprobe.Tags{ Album: "1980 Kean College After Midnight",
+        Date: "1980" },
+      comb: &Info{ Album: "Kean College After Midnight", Year: "1980" },
+      match: true,
     },{
       m: &Metadata{Info: &Info{ Album: "Kean College After Midnight", Year: "1980" }},
       tags: &ffprobe.Tags{ Album: "1980 Kean College After Midnight" },
       comb: &Info{ Album: "Kean College After Midnight", Year: "1980" },
+      match: false,
+    },{
+      m: &Metadata{Info: &Info{ Album: "Barton Hall", Year: "1977", Month: "05", Day: "08" }},
+      tags: &ffprobe.Tags{ Album: "1977.05.08 Barton Hall", Date: "1977-05-08",
+        Genre: "Rock", Comment: "SBD" },
+      comb: &Info{ Album: "Barton Hall", Year: "1977", Month: "05", Day: "08",
+        Genre: "Rock", Comment: "SBD" },
       match: true,
+    },{
+      m: &Metadata{Info: &Info{ Album: "Terrapin Station", Year: "1977" }},
+      tags: &ffprobe.Tags{ Album: "1977 Terrapin Station", Date: "1977-07-27" },
+      comb: &Info{ Album: "Terrapin Station", Year: "1977" },
+      match: false,
     },{
       m: &Metadata{Info: &Info{ Album: "Kean College After Midnight", Year: "1980" }},
       tags: &ffprobe.Tags{ Album: "1980.02.28 Kean College After Midnight" },
@@ -73,7 +104,12 @@ func TestMatchProbeInfo(t *testing.T) {
     },{
       m: &Metadata{Info: &Info{ Disc: "1" }},
       tags: &ffprobe.Tags{ Disc: "1/2" },
-      comb: &Info{ Disc: "1" },
+      comb: &Info{ Disc: "1", DiscTotal: "2" },
+      match: true,
+    },{
+      m: &Metadata{Info: &Info{ Disc: "1", Track: "3" }},
+      tags: &ffprobe.Tags{ Disc: "2", Track: "3/12" },
+      comb: &Info{ Disc: "1", Track: "3", TrackTotal: "12" },
       match: false,
     },
   }
@@ -92,11 +128,30 @@ func TestMatchProbeInfo(t *testing.T) {
   }
 }
 
+func TestMatchAlbumArtist(t *testing.T) {
+  c := &Info{ AlbumArtist: VariousArtists, Compilation: true }
+
+  m := &Metadata{ Info: &Info{ Title: "a" } }
+  i, match := m.MatchBestInfo(c, &Info{ Artist: "Ween", Title: "a" })
+  if match || i.Artist != "Ween" || i.ToArtist() != VariousArtists {
+    t.Errorf("Expected compilation track by Ween, got %v %v", i, match)
+  }
+
+  m = &Metadata{ Info: &Info{ Artist: "Ween", Title: "a" } }
+  _, match = m.MatchBestInfo(c, &Info{ Artist: "Ween", Title: "a",
+    AlbumArtist: VariousArtists, Compilation: true })
+  if !match {
+    t.Errorf("Expected match of album artist & compilation tags")
+  }
+}
+
 func TestInfoFromFile(t *testing.T) {
   tests := [][][]string{
     { { "sci160318d1_01_Shine.mp3" }, { "2016", "03", "18", "1", "1", "Shine" } },
     { { "jgb1980-02-28d1t1 Sugaree.flac" }, { "1980", "02", "28", "1", "1", "Sugaree" } },
     { { "03 - 02 Cold Rain and Snow.m4a"}, { "", "", "", "3", "2", "Cold Rain and Snow" } },
+    { { "d2t04 Scarlet Begonias -> Fire on the Mountain.flac"}, { "", "", "", "2", "4", "Scarlet Begonias > Fire on the Mountain" } },
+    { { "12 Dark Star *->.mp3"}, { "", "", "", "", "12", "Dark Star >" } },
   }
 
   for x := range tests {
@@ -283,3 +338,232 @@ func TestSafeFilename(t *testing.T) {
     }
   }
 }
+
+func TestMatchSource(t *testing.T) {
+  tests := [][]string{
+    { "Barton Hall, Ithaca, NY [SBD]", "SBD", "", "Barton Hall, Ithaca, NY" },
+    { "Barton Hall [MTX 12345]", "MATRIX", "12345", "Barton Hall" },
+    { "Barton Hall shnid-4982 [aud]", "AUD", "4982", "Barton Hall" },
+    { "Whereever [SBD 320-MP3]", "SBD", "", "Whereever" },
+    { "Barton Hall SBD", "SBD", "", "Barton Hall" },
+    { "Barton Hall - MTX", "MATRIX", "", "Barton Hall" },
+    { "Barton Hall (aud) Hicks", "AUD", "", "Barton Hall Hicks" },
+    { "Barton Hall SBD Hicks", "", "", "Barton Hall SBD Hicks" },
+    { "Aud Lang Syne", "", "", "Aud Lang Syne" },
+    { "The Matrix", "", "", "The Matrix" },
+    { "KSAN FM Broadcast", "", "", "KSAN FM Broadcast" },
+    { "Album [Remastered]", "", "", "Album [Remastered]" },
+  }
+
+  for x := range tests {
+    i := &Info{}
+    r := i.matchSource(tests[x][0])
+    compare := []string{ i.Source, i.SourceID, r }
+    if strings.Join(compare, "\n") != strings.Join(tests[x][1:], "\n") {
+      t.Errorf("Expected %v, got %v", tests[x][1:], compare)
+    }
+  }
+}
+
+func TestSourceFromText(t *testing.T) {
+  tests := [][]string{
+    { "Grateful Dead\nBarton Hall\nSource: SBD > Reel > DAT\nshnid 4982", "SBD", "4982" },
+    { "Recorded by someone (no aud mics)\nLineage: Matrix of SBD + AUD", "MATRIX", "" },
+    { "taped from the aud", "", "" },
+    { "Studio album, single first aired on FM radio", "", "" },
+    { "nothing here", "", "" },
+  }
+
+  for x := range tests {
+    i := SourceFromText(tests[x][0])
+    if i.Source != tests[x][1] || i.SourceID != tests[x][2] {
+      t.Errorf("Expected %v %v, got %v %v", tests[x][1], tests[x][2],
+        i.Source, i.SourceID)
+    }
+  }
+}
+
+func TestInfoFromPathSource(t *testing.T) {
+  m := New("Grateful Dead/1977/1977.05.08 Barton Hall, Ithaca, NY [SBD 4982]")
+  e := Info{ Year: "1977", Month: "05", Day: "08",
+    Album: "Barton Hall, Ithaca, NY", Source: "SBD", SourceID: "4982" }
+  if *m.Info != e {
+    t.Errorf("Expected %v, got %v", e, *m.Info)
+  }
+}
+
+func TestDiscFolder(t *testing.T) {
+  tests := [][]string{
+    { "CD1", "1" },
+    { "disc 02", "2" },
+    { "Set 3 ", "3" },
+    { "Album CD1", "" },
+    { "1977 Terrapin Station", "" },
+  }
+
+  for x := range tests {
+    r := DiscFolder(tests[x][0])
+    if r != tests[x][1] {
+      t.Errorf("Expected %v, got %v", tests[x][1], r)
+    }
+  }
+}
+
+func TestDateTag(t *testing.T) {
+  tests := []struct {
+    i *Info
+    result string
+  }{
+    { i: &Info{}, result: "" },
+    { i: &Info{ Year: "1977" }, result: "1977" },
+    { i: &Info{ Year: "1977", Month: "05", Day: "08" }, result: "1977-05-08" },
+    { i: &Info{ Year: "2000", Month: "01", Day: "31,01" }, result: "2000-01-31" },
+  }
+
+  for x := range tests {
+    if r := tests[x].i.DateTag(); r != tests[x].result {
+      t.Errorf("Expected %v, got %v", tests[x].result, r)
+    }
+  }
+}
+
+func TestDiscTrackTag(t *testing.T) {
+  i := &Info{ Disc: "1", DiscTotal: "2", Track: "3" }
+  if i.DiscTag() != "1/2" || i.TrackTag() != "3" {
+    t.Errorf("Expected 1/2 3, got %v %v", i.DiscTag(), i.TrackTag())
+  }
+}
+
+func TestMatchTitleTag(t *testing.T) {
+  tests := []struct {
+    title, result, set string
+  }{
+    { "Scarlet Begonias -> Fire on the Mountain", "Scarlet Begonias > Fire on the Mountain", "" },
+    { "Help on the Way>Slipknot!-->", "Help on the Way > Slipknot! >", "" },
+    { "E: Johnny B. Goode", "Johnny B. Goode", "E" },
+    { "Sugar Magnolia (encore)", "Sugar Magnolia", "E" },
+    { "Set II: Playing in the Band ->", "Playing in the Band >", "2" },
+    { "Sugaree**", "Sugaree", "" },
+    { "E-Bow the Letter", "E-Bow the Letter", "" },
+  }
+
+  for x := range tests {
+    i := &Info{}
+    r := i.matchTitleTag(tests[x].title)
+    if r != tests[x].result || i.Set != tests[x].set {
+      t.Errorf("Expected %v %v, got %v %v", tests[x].result, tests[x].set,
+        r, i.Set)
+    }
+  }
+}
+
+func TestMatchTitleSegue(t *testing.T) {
+  m := &Metadata{ Info: &Info{ Track: "4",
+    Title: "Scarlet Begonias - Fire on the Mountain" } }
+  p := ProbeTagsToInfo(&ffprobe.Tags{ Track: "4",
+    Title: "Scarlet Begonias -> Fire on the Mountain" })
+
+  i, match := m.MatchBestInfo(&Info{}, p)
+  if !match || i.Title != "Scarlet Begonias - Fire on the Mountain" {
+    t.Errorf("Expected match, got %v %v", i.Title, match)
+  }
+
+  m = &Metadata{ Info: &Info{ Track: "4",
+    Title: "Scarlet Begonias - Fire on the Mountain" } }
+  p = ProbeTagsToInfo(&ffprobe.Tags{ Track: "4", Title: "E: Scarlet Begonias > Fire on the Mountain" })
+  i, match = m.MatchBestInfo(&Info{}, p)
+  if match || i.Title != "Scarlet Begonias > Fire on the Mountain" ||
+    i.Set != "E" {
+    t.Errorf("Expected segue title & encore, got %v %v %v", i.Title, i.Set,
+      match)
+  }
+}
+
+func TestTitleCase(t *testing.T) {
+  tests := [][]string{
+    { "fire on the mountain", "Fire on the Mountain" },
+    { "PLAYING IN THE BAND", "Playing in the Band" },
+    { "Goin' Down the Road Feeling Bad", "Goin' Down the Road Feeling Bad" },
+    { "born in the USA", "Born in the USA" },
+    { "the other one", "The Other One" },
+    { "what's become of the baby", "What's Become of the Baby" },
+  }
+
+  for x := range tests {
+    if r := TitleCase(tests[x][0]); r != tests[x][1] {
+      t.Errorf("Expected %v, got %v", tests[x][1], r)
+    }
+  }
+}
+
+func TestTitlesNormalize(t *testing.T) {
+  ts := NewTitles()
+  ts.Dictionary["grateful dead"] = map[string]string{
+    titleKey("Scarlett Begonias"): "Scarlet Begonias" }
+  ts.Dictionary["*"] = map[string]string{
+    titleKey("Johnny B Goode"): "Johnny B. Goode" }
+
+  tests := [][]string{
+    { "scarlett begonias > fire on the mountain >", "Scarlet Begonias > fire on the mountain >" },
+    { "Johnny B. Goode", "Johnny B. Goode" },
+  }
+  for x := range tests {
+    r := ts.Normalize([]string{ "Grateful Dead" }, tests[x][0])
+    if r != tests[x][1] {
+      t.Errorf("Expected %v, got %v", tests[x][1], r)
+    }
+  }
+
+  ts.Case = true
+  r := ts.Normalize([]string{ "Phish" }, "scarlett begonias > fire on the mountain")
+  if r != "Scarlett Begonias > Fire on the Mountain" {
+    t.Errorf("Expected title case without dictionary, got %v", r)
+  }
+}
+
+func TestFilenames(t *testing.T) {
+  tests := []struct {
+    s, mode, folder, file string
+  }{
+    { "Sigur Rós", FilenamesStrict, "Sigur Rs", "Sigur Rs" },
+    { "Sigur Rós", FilenamesUnicode, "Sigur Rós", "Sigur Rós" },
+    { "Sigur Rós", FilenamesASCII, "Sigur Ros", "Sigur Ros" },
+    { "Motörhead: Live?", FilenamesUnicode, "Motörhead Live", "Motörhead Live" },
+    { "AC/DC", "", "AC-DC", "ACDC" },
+    { "Œuvre – Straße", FilenamesASCII, "OEuvre - Strasse", "OEuvre - Strasse" },
+    { "1977.05.08 Barton Hall [SBD]", FilenamesStrict,
+      "1977.05.08 Barton Hall [SBD]", "19770508 Barton Hall SBD" },
+  }
+
+  for x := range tests {
+    f, n := FolderName(tests[x].s, tests[x].mode), fileName(tests[x].s, tests[x].mode)
+    if f != tests[x].folder || n != tests[x].file {
+      t.Errorf("Expected %v %v, got %v %v", tests[x].folder, tests[x].file, f, n)
+    }
+  }
+}
+
+func TestMatchUnicode(t *testing.T) {
+  m := New("Sigur Rs/1999/1999 Agaetis byrjun/04 Svefn-g-englar.mp3")
+  i, match := m.MatchBestInfo(&Info{ Artist: "Sigur Rós" },
+    &Info{ Artist: "Sigur Rós", Album: "1999 Ágætis byrjun", Track: "4",
+      Title: "Svefn-g-englar", Year: "1999" })
+  if match || i.Album != "Ágætis byrjun" {
+    t.Errorf("Expected unicode album tag, got %v %v", i.Album, match)
+  }
+
+  m = New("Sigur Ros/1999/1999 Agaetis byrjun/04 Svefn-g-englar.mp3")
+  m.Info.Artist, m.Filenames = "Sigur Rós", FilenamesASCII
+  _, match = m.MatchBestInfo(&Info{},
+    &Info{ Artist: "Sigur Rós", Album: "1999 Agætis byrjun", Track: "4",
+      Title: "Svefn-g-englar", Year: "1999" })
+  if !match {
+    t.Errorf("Expected transliterated path to match unicode tags")
+  }
+
+  m = New("Sigur Rós/1999/1999 Ágætis byrjun/04 Svefn-g-englar.mp3")
+  if m.Info.Album != "Ágætis byrjun" ||
+    m.Info.ToFile(FilenamesUnicode) != "04 Svefn-g-englar" {
+    t.Errorf("Expected unicode album from path, got %v", m.Info.Album)
+  }
+}
@@ -0,0 +1,221 @@
+package metadata
+
+import (
+  "os"
+  "fmt"
+  "bufio"
+  "regexp"
+  "strings"
+  "unicode"
+)
+
+// words kept lowercase within title case (unless first or last word)
+var smallWords = map[string]bool{
+  "a": true, "an": true, "and": true, "as": true, "at": true, "but": true,
+  "by": true, "for": true, "from": true, "in": true, "into": true, "nor": true,
+  "of": true, "on": true, "or": true, "the": true, "to": true, "vs": true,
+  "vs.": true, "with": true,
+}
+
+// set & encore markers, ie "E: Johnny B. Goode", "Set 2: Playing in the Band"
+var markerRegexps = []struct {
+  set string
+  re *regexp.Regexp
+}{
+  { "E", regexp.MustCompile(`(?i)^\s*(?:e|enc|encore)\s*(?::|[.-]\s)\s*`) },
+  { "E", regexp.MustCompile(`(?i)\s*[(\[]\s*encore\s*[)\]]\s*$`) },
+  { "", regexp.MustCompile(`(?i)^\s*(?:s|set)\s*(\d|i{1,3})\s*(?::|[.-]\s)\s*`) },
+}
+
+// segue markers: "->", "-->", "=>", ">" & "~>"
+var segueRegexp = regexp.MustCompile(`\s*(?:-+>|=+>|~+>|>+)\s*`)
+var trailingSegueRegexp = regexp.MustCompile(`(?:-+>|=+>|~+>|>+)\s*$`)
+
+// footnote marks (ie "Sugaree*", "Morning Dew **") referring to info files
+var footnoteRegexp = regexp.MustCompile(`\s*[*#^@]+\s*$`)
+
+// match & remove set or encore marker & footnote marks from title
+func (i *Info) matchMarkers(s string) string {
+  s = footnoteRegexp.ReplaceAllString(s, "")
+
+  for _, m := range markerRegexps {
+    sm := m.re.FindStringSubmatch(s)
+    if sm == nil {
+      continue
+    }
+
+    if set := m.set; len(set) > 0 {
+      i.Set = set
+    } else {
+      i.Set = strings.ToUpper(sm[1])
+      if r, ok := romanNumeralMap[i.Set]; ok {
+        i.Set = r
+      }
+    }
+    s = strings.Replace(s, sm[0], " ", 1)
+    break
+  }
+
+  return footnoteRegexp.ReplaceAllString(strings.TrimSpace(s), "")
+}
+
+// split title into songs at segues; trailing is true when title segues
+// into the next track
+func splitSegues(s string) ([]string, bool) {
+  s = strings.TrimSpace(s)
+  trailing := trailingSegueRegexp.MatchString(s)
+
+  songs := []string{}
+  for _, song := range segueRegexp.Split(s, -1) {
+    if song = strings.TrimSpace(song); len(song) > 0 {
+      songs = append(songs, song)
+    }
+  }
+  return songs, trailing
+}
+
+// join songs with standardized segues (ie "Scarlet Begonias > Fire on the
+// Mountain", "Dark Star >")
+func joinSegues(songs []string, trailing bool) string {
+  s := strings.Join(songs, " > ")
+  if trailing && len(s) > 0 {
+    s += " >"
+  }
+  return s
+}
+
+// title with segues standardized & set/encore markers removed
+func (i *Info) matchTitleTag(s string) string {
+  return joinSegues(splitSegues(i.matchMarkers(s)))
+}
+
+// title from filename, cleaned per song so segues are kept
+func (i *Info) matchTitle(s string) string {
+  songs, trailing := splitSegues(i.matchMarkers(s))
+  for x := range songs {
+    songs[x] = matchAlbumOrTitle(songs[x])
+  }
+  return joinSegues(songs, trailing)
+}
+
+// title as used within filename: segues between songs become " - " & a
+// trailing segue is dropped (">" is not allowed on all filesystems)
+func fileTitle(s, mode string) string {
+  songs, _ := splitSegues(s)
+  return fileName(strings.Join(songs, " - "), mode)
+}
+
+// title casing & per artist song title dictionary
+type Titles struct {
+  // title case, keeping small words & acronyms
+  Case bool
+  // correct titles keyed by lowercase artist ("*" for all artists), then
+  // lowercase title
+  Dictionary map[string]map[string]string
+}
+
+func NewTitles() *Titles {
+  return &Titles{ Dictionary: map[string]map[string]string{} }
+}
+
+// read song titles, one per line: "Artist: misspelled = Correct Title"
+// ("*: ..." applies to all artists)
+func (t *Titles) ReadDictionary(file string) error {
+  f, err := os.Open(file)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+
+  s := bufio.NewScanner(f)
+  for s.Scan() {
+    l := strings.TrimSpace(s.Text())
+    if len(l) == 0 || strings.HasPrefix(l, "#") {
+      continue
+    }
+
+    ak := strings.SplitN(l, ":", 2)
+    kv := []string{}
+    if len(ak) == 2 {
+      kv = strings.SplitN(ak[1], "=", 2)
+    }
+    if len(kv) != 2 || len(strings.TrimSpace(kv[0])) == 0 ||
+      len(strings.TrimSpace(kv[1])) == 0 {
+      return fmt.Errorf("invalid song title: %v", l)
+    }
+
+    artist := strings.ToLower(strings.TrimSpace(ak[0]))
+    if t.Dictionary[artist] == nil {
+      t.Dictionary[artist] = map[string]string{}
+    }
+    t.Dictionary[artist][titleKey(kv[0])] = strings.TrimSpace(kv[1])
+  }
+
+  return s.Err()
+}
+
+// dictionary key ignoring case, accents & punctuation
+func titleKey(s string) string {
+  return strings.ToLower(safeFilename(Transliterate(s)))
+}
+
+// normalize each song of title (segues kept) by dictionary of any of artists
+// (or "*"), then by title case (if enabled)
+func (t *Titles) Normalize(artists []string, title string) string {
+  songs, trailing := splitSegues(title)
+  for x := range songs {
+    songs[x] = t.song(artists, songs[x])
+  }
+  return joinSegues(songs, trailing)
+}
+
+func (t *Titles) song(artists []string, s string) string {
+  for _, a := range append(artists, "*") {
+    if d, ok := t.Dictionary[strings.ToLower(a)][titleKey(s)]; ok {
+      return d
+    }
+  }
+
+  if t.Case {
+    return TitleCase(s)
+  }
+  return s
+}
+
+// capitalize words except small words (unless first or last) & acronyms
+// (ie "USA", "II"); all caps or all lowercase titles are cased from scratch
+func TitleCase(s string) string {
+  if strings.ToUpper(s) == s || strings.ToLower(s) == s {
+    s = strings.ToLower(s)
+  }
+
+  words := strings.Fields(s)
+  for x, w := range words {
+    lw := strings.ToLower(strings.Trim(w, `("'[`))
+    if len(w) > 1 && strings.ToUpper(w) == w && lw != w {
+      continue
+    }
+    if x > 0 && x < len(words)-1 && smallWords[lw] &&
+      !strings.HasSuffix(words[x-1], ":") {
+      words[x] = strings.ToLower(w)
+      continue
+    }
+    words[x] = capitalize(w)
+  }
+  return strings.Join(words, " ")
+}
+
+// uppercase first letter of word (after any leading punctuation)
+func capitalize(w string) string {
+  r := []rune(w)
+  for x := range r {
+    if unicode.IsLetter(r[x]) {
+      r[x] = unicode.ToUpper(r[x])
+      break
+    }
+    if unicode.IsDigit(r[x]) {
+      break
+    }
+  }
+  return string(r)
+}
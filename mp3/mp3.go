@@ -0,0 +1,234 @@
+package mp3
+
+import (
+  "io"
+  "os"
+  "fmt"
+  "bytes"
+  "errors"
+  "io/ioutil"
+  "encoding/binary"
+)
+
+// info from first frame & Xing/Info + LAME header
+type Info struct {
+  SampleRate, SamplesPerFrame int
+  // audio frames as stored within Xing header
+  Frames int
+  // encoder delay & padding (in samples) from LAME header
+  Delay, Padding int
+  HasXing, HasLame bool
+}
+
+var ErrNoFrame = errors.New("No MP3 frame found")
+
+// decoder delay added by mp3 decoders (528 + 1)
+const DecoderDelay = 529
+
+var sampleRates = map[int][]int{
+  3: { 44100, 48000, 32000 }, // MPEG1
+  2: { 22050, 24000, 16000 }, // MPEG2
+  0: { 11025, 12000, 8000 },  // MPEG2.5
+}
+
+func ReadFile(file string) (*Info, error) {
+  f, err := os.Open(file)
+  if err != nil {
+    return &Info{}, err
+  }
+  defer f.Close()
+
+  return Read(f)
+}
+
+// read first frame header following any ID3v2 tag
+func Read(r io.Reader) (*Info, error) {
+  i, _, err := read(r)
+  return i, err
+}
+
+// info & offset of first frame
+func read(r io.Reader) (*Info, int64, error) {
+  i := &Info{}
+
+  // skip ID3v2 tag
+  var base int64
+  head := make([]byte, 10)
+  n, _ := io.ReadFull(r, head)
+  head = head[:n]
+  if n == 10 && bytes.Equal(head[:3], []byte("ID3")) {
+    size := int64(SyncsafeInt(head[6:10]))
+    if head[5] & 0x10 != 0 {
+      size += 10
+    }
+    if _, err := io.CopyN(ioutil.Discard, r, size); err != nil {
+      return i, 0, ErrNoFrame
+    }
+    head, base = head[:0], 10 + size
+  }
+
+  // first frame is within first 64KB (allows for junk between tag & audio)
+  buf := make([]byte, 65536)
+  n, _ = io.ReadFull(r, buf[len(head):])
+  copy(buf, head)
+  buf = buf[:len(head)+n]
+
+  for x := 0; x + 4 <= len(buf); x++ {
+    h, ok := parseHeader(buf[x:])
+    if !ok {
+      continue
+    }
+
+    i.SampleRate, i.SamplesPerFrame = h.sampleRate, h.samplesPerFrame
+    i.readXing(buf[x:], h)
+    return i, base + int64(x), nil
+  }
+
+  return i, 0, ErrNoFrame
+}
+
+// MPEG audio layer III frame header
+type header struct {
+  version, sampleRate, samplesPerFrame, size int
+  mono, crc bool
+}
+
+// bitrates (kbps) by bitrate index for MPEG1 & MPEG2/2.5
+var bitrates = map[bool][]int{
+  true: { 0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320 },
+  false: { 0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160 },
+}
+
+// parse layer III frame header at start of b; size is 0 if free format
+func parseHeader(b []byte) (*header, bool) {
+  if len(b) < 4 || b[0] != 0xFF || b[1] & 0xE0 != 0xE0 {
+    return nil, false
+  }
+
+  version := int(b[1] >> 3) & 3
+  layer := int(b[1] >> 1) & 3
+  rateIndex := int(b[2] >> 2) & 3
+  bitrateIndex := int(b[2] >> 4)
+  if version == 1 || layer != 1 || rateIndex == 3 || bitrateIndex == 15 {
+    return nil, false
+  }
+
+  h := &header{ version: version, sampleRate: sampleRates[version][rateIndex],
+    samplesPerFrame: 1152, mono: int(b[3] >> 6) == 3, crc: b[1] & 1 == 0 }
+  coef := 144
+  if version != 3 {
+    h.samplesPerFrame, coef = 576, 72
+  }
+  if bitrateIndex > 0 {
+    h.size = coef * bitrates[version == 3][bitrateIndex] * 1000 /
+      h.sampleRate + int(b[2] >> 1) & 1
+  }
+  return h, true
+}
+
+// byte positions of Xing/Info header fields within frame (-1 if absent)
+type xingLayout struct {
+  flags, frames, bytes, toc, lame int
+}
+
+// locate Xing/Info header & LAME extension within frame
+func layoutXing(frame []byte, h *header) (*xingLayout, bool) {
+  // side info follows header & CRC (if protected)
+  off := 4 + 32
+  switch {
+  case h.version == 3 && h.mono:
+    off = 4 + 17
+  case h.version != 3 && h.mono:
+    off = 4 + 9
+  case h.version != 3:
+    off = 4 + 17
+  }
+  if h.crc {
+    off += 2
+  }
+
+  if len(frame) < off + 8 {
+    return nil, false
+  }
+  id := string(frame[off:off+4])
+  if id != "Xing" && id != "Info" {
+    return nil, false
+  }
+
+  l := &xingLayout{ flags: off + 4, frames: -1, bytes: -1, toc: -1, lame: -1 }
+  flags := binary.BigEndian.Uint32(frame[off+4:])
+  off += 8
+  if flags & 1 != 0 {
+    l.frames, off = off, off + 4
+  }
+  if flags & 2 != 0 {
+    l.bytes, off = off, off + 4
+  }
+  if flags & 4 != 0 {
+    l.toc, off = off, off + 100
+  }
+  if flags & 8 != 0 {
+    off += 4
+  }
+
+  // encoder version (9), revision (1), lowpass (1), replaygain (8),
+  // flags (1), bitrate (1), delay & padding (3), misc (4), music length (4)
+  // & CRCs (4)
+  if len(frame) >= off + lameSize && frame[off] != 0 {
+    l.lame = off
+  }
+  if l.frames != -1 && len(frame) < l.frames + 4 {
+    l.frames = -1
+  }
+  return l, true
+}
+
+// length of LAME extension
+const lameSize = 36
+
+// parse Xing/Info header & LAME extension from frame
+func (i *Info) readXing(frame []byte, h *header) {
+  l, ok := layoutXing(frame, h)
+  if !ok {
+    return
+  }
+  i.HasXing = true
+
+  if l.frames != -1 {
+    i.Frames = int(binary.BigEndian.Uint32(frame[l.frames:]))
+  }
+
+  // 12 bits delay & 12 bits padding
+  if l.lame == -1 {
+    return
+  }
+  off := l.lame + 21
+  i.HasLame = true
+  i.Delay = int(frame[off]) << 4 | int(frame[off+1]) >> 4
+  i.Padding = int(frame[off+1] & 0x0F) << 8 | int(frame[off+2])
+}
+
+// original (unpadded) number of samples
+func (i *Info) Samples() int {
+  if i.Frames == 0 {
+    return 0
+  }
+  return i.Frames * i.SamplesPerFrame - i.Delay - i.Padding
+}
+
+// iTunes gapless info (iTunSMPB) as decoded: delay includes decoder delay
+func (i *Info) ITunSMPB() string {
+  padding := i.Padding - DecoderDelay
+  if padding < 0 {
+    padding = 0
+  }
+  return fmt.Sprintf(" 00000000 %08X %08X %016X 00000000 00000000 00000000" +
+    " 00000000 00000000 00000000 00000000 00000000", i.Delay + DecoderDelay,
+    padding, i.Samples())
+}
+
+// decode 28 bit syncsafe integer
+func SyncsafeInt(b []byte) int {
+  return int(b[0] & 0x7F) << 21 | int(b[1] & 0x7F) << 14 |
+    int(b[2] & 0x7F) << 7 | int(b[3] & 0x7F)
+}
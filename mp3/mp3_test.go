@@ -0,0 +1,177 @@
+package mp3
+
+import (
+  "os"
+  "bytes"
+  "testing"
+  "io/ioutil"
+  "path/filepath"
+  "encoding/binary"
+)
+
+// build MPEG1 Layer III stereo frame with Xing & LAME header
+func testFrame(frames, delay, padding int, encoder string) []byte {
+  f := make([]byte, 417)
+  copy(f, []byte{ 0xFF, 0xFB, 0x90, 0x00 })
+
+  off := 4 + 32
+  copy(f[off:], "Info")
+  binary.BigEndian.PutUint32(f[off+4:], 1)
+  binary.BigEndian.PutUint32(f[off+8:], uint32(frames))
+
+  off += 12
+  copy(f[off:], encoder)
+  lame := off
+  off += 21
+  f[off] = byte(delay >> 4)
+  f[off+1] = byte(delay << 4) | byte(padding >> 8)
+  f[off+2] = byte(padding)
+  binary.BigEndian.PutUint16(f[lame+34:], crc16(0, f[:lame+34]))
+  return f
+}
+
+// Info frame followed by audio frames numbered within their first byte
+func testStream(frames, delay, padding int) []byte {
+  b := testFrame(frames, delay, padding, "LAME3.100")
+  for x := 0; x < frames; x++ {
+    f := make([]byte, 417)
+    copy(f, []byte{ 0xFF, 0xFB, 0x90, 0x00, byte(x) })
+    b = append(b, f...)
+  }
+  return append(b, "TAG"...)
+}
+
+func TestRead(t *testing.T) {
+  id3 := []byte{ 'I', 'D', '3', 4, 0, 0, 0, 0, 0, 5, 1, 2, 3, 4, 5 }
+
+  tests := []struct {
+    data []byte
+    info Info
+    err error
+  }{
+    { data: []byte("not an mp3 file"), err: ErrNoFrame },
+    { data: testFrame(100, 576, 1000, "LAME3.100"),
+      info: Info{ SampleRate: 44100, SamplesPerFrame: 1152, Frames: 100,
+        Delay: 576, Padding: 1000, HasXing: true, HasLame: true },
+    },{
+      data: append(id3, testFrame(10, 576, 1500, "Lavc58.54")...),
+      info: Info{ SampleRate: 44100, SamplesPerFrame: 1152, Frames: 10,
+        Delay: 576, Padding: 1500, HasXing: true, HasLame: true },
+    },{
+      data: []byte{ 0, 0xFF, 0xFB, 0x90, 0x00, 0, 0 },
+      info: Info{ SampleRate: 44100, SamplesPerFrame: 1152 },
+    },
+  }
+
+  for x := range tests {
+    i, err := Read(bytes.NewReader(tests[x].data))
+    if err != tests[x].err {
+      t.Errorf("Expected %v, got %v", tests[x].err, err)
+    }
+    if err == nil && *i != tests[x].info {
+      t.Errorf("Expected %v, got %v", tests[x].info, *i)
+    }
+  }
+}
+
+func TestITunSMPB(t *testing.T) {
+  i := &Info{ SamplesPerFrame: 1152, Frames: 100, Delay: 576, Padding: 1000 }
+
+  if i.Samples() != 113624 {
+    t.Errorf("Expected %v, got %v", 113624, i.Samples())
+  }
+
+  e := " 00000000 00000451 000001D7 000000000001BBD8 00000000 00000000" +
+    " 00000000 00000000 00000000 00000000 00000000 00000000"
+  if i.ITunSMPB() != e {
+    t.Errorf("Expected %v, got %v", e, i.ITunSMPB())
+  }
+}
+
+func TestReadCRC(t *testing.T) {
+  // protected frame: side info follows 16 bit CRC
+  f := testFrame(100, 576, 1000, "LAME3.100")
+  f = append([]byte{ 0xFF, 0xFA, 0x90, 0x00, 0xAB, 0xCD }, f[4:]...)
+
+  i, err := Read(bytes.NewReader(f))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !i.HasLame || i.Frames != 100 || i.Delay != 576 || i.Padding != 1000 {
+    t.Errorf("Expected LAME header after CRC, got %v", *i)
+  }
+}
+
+func TestSplit(t *testing.T) {
+  dir, err := ioutil.TempDir("", "")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  // 20 frames: 20*1152 - 576 - 1000 = 21464 samples
+  file := filepath.Join(dir, "set.mp3")
+  err = ioutil.WriteFile(file, testStream(20, 576, 1000), 0644)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  s, err := Scan(file)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(s.Frames) != 20 || s.Samples() != 21464 {
+    t.Fatalf("Expected 20 frames of 21464 samples, got %v, %v",
+      len(s.Frames), s.Samples())
+  }
+
+  tests := []struct {
+    start, end int
+    first, frames, delay, padding int
+  }{
+    // from start of stream, keeping original delay
+    { start: 0, end: 10000, first: 0, frames: 10, delay: 576, padding: 944 },
+    // two frames prime decoder; original padding kept at end of stream
+    { start: 10000, end: 21464, first: 7, frames: 13, delay: 2512,
+      padding: 1000 },
+    // within stream, ending at frame boundary
+    { start: 5000, end: 9263, first: 3, frames: 6, delay: 2120,
+      padding: 529 },
+  }
+
+  for x := range tests {
+    out := filepath.Join(dir, "split.mp3")
+    err = s.Split(out, tests[x].start, tests[x].end)
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    i, err := ReadFile(out)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if i.Frames != tests[x].frames || i.Delay != tests[x].delay ||
+      i.Padding != tests[x].padding ||
+      i.Samples() != tests[x].end - tests[x].start {
+      t.Errorf("Expected %v frames, delay %v & padding %v, got %v",
+        tests[x].frames, tests[x].delay, tests[x].padding, *i)
+    }
+
+    b, _ := ioutil.ReadFile(out)
+    if len(b) != 417 * (tests[x].frames + 1) || b[417+4] != byte(tests[x].first) {
+      t.Errorf("Expected frames from %v, got %v bytes starting %v",
+        tests[x].first, len(b), b[417+4])
+    }
+
+    // music length & LAME tag CRC
+    lame := 4 + 32 + 12
+    if binary.BigEndian.Uint32(b[lame+28:]) != uint32(len(b)) ||
+      binary.BigEndian.Uint16(b[lame+34:]) != crc16(0, b[:lame+34]) {
+      t.Errorf("Expected music length & tag CRC to be updated")
+    }
+  }
+
+  if err = s.Split(filepath.Join(dir, "x.mp3"), 0, 30000); err == nil {
+    t.Errorf("Expected error of samples beyond stream")
+  }
+}
@@ -0,0 +1,222 @@
+package mp3
+
+import (
+  "io"
+  "os"
+  "fmt"
+  "bufio"
+  "errors"
+  "encoding/binary"
+)
+
+// audio frame within file
+type Frame struct {
+  Offset int64
+  Size int
+}
+
+// audio frames of file following Xing/Info frame
+type Stream struct {
+  Info *Info
+  Frames []Frame
+  file string
+  // Xing/Info frame (with LAME extension), copied into each split file
+  header []byte
+  layout *xingLayout
+}
+
+// frames decoded before the first sample of a split file, priming the
+// bit reservoir & overlap of the frames that follow
+const primeFrames = 2
+
+// largest delay & padding stored within LAME extension (12 bits)
+const maxDelay = 4095
+
+var ErrNoLame = errors.New("No LAME encoder delay & padding found")
+
+// locate each frame of file; stops at first invalid frame (ie ID3v1 tag)
+func Scan(file string) (*Stream, error) {
+  f, err := os.Open(file)
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+
+  i, off, err := read(f)
+  if err != nil {
+    return nil, err
+  }
+  s := &Stream{ Info: i, file: file }
+
+  _, err = f.Seek(off, io.SeekStart)
+  if err != nil {
+    return nil, err
+  }
+  r := bufio.NewReaderSize(f, 65536)
+
+  var first *header
+  for {
+    b, err := r.Peek(4)
+    if err != nil {
+      break
+    }
+    h, ok := parseHeader(b)
+    if !ok || h.size < 4 || first != nil && (h.version != first.version ||
+      h.sampleRate != first.sampleRate) {
+      break
+    }
+
+    frame := make([]byte, h.size)
+    if _, err = io.ReadFull(r, frame); err != nil {
+      break
+    }
+
+    // Xing/Info frame is silent, not audio
+    if first == nil {
+      first = h
+      if l, ok := layoutXing(frame, h); ok {
+        s.header, s.layout = frame, l
+        off += int64(h.size)
+        continue
+      }
+    }
+
+    s.Frames = append(s.Frames, Frame{ Offset: off, Size: h.size })
+    off += int64(h.size)
+  }
+
+  if first == nil {
+    return nil, ErrNoFrame
+  }
+  return s, nil
+}
+
+// number of samples as decoded by gapless players
+func (s *Stream) Samples() int {
+  return len(s.Frames) * s.Info.SamplesPerFrame - s.Info.Delay -
+    s.Info.Padding
+}
+
+// write samples [start, end) of stream to file as the frames containing
+// them (along with preceding frames priming the decoder) & an Info header
+// whose encoder delay & padding trim playback to exactly those samples
+func (s *Stream) Split(file string, start, end int) error {
+  if s.layout == nil || s.layout.lame == -1 || s.layout.frames == -1 {
+    return ErrNoLame
+  }
+  if start < 0 || end <= start || end > s.Samples() {
+    return fmt.Errorf("Samples %d to %d not within stream of %d samples",
+      start, end, s.Samples())
+  }
+
+  // positions within decoded frames (before trimming decoder delay)
+  spf := s.Info.SamplesPerFrame
+  skip := s.Info.Delay + DecoderDelay
+  first := (start + skip) / spf - primeFrames
+  if first < 0 {
+    first = 0
+  }
+  last := (end + skip - 1) / spf
+
+  delay := start + skip - first * spf - DecoderDelay
+  padding := (last - first + 1) * spf - delay - (end - start)
+
+  // padding always includes decoder delay, as last frame ends past end
+  if delay > maxDelay || padding > maxDelay {
+    return fmt.Errorf("Samples %d to %d cannot be split (delay %d, " +
+      "padding %d)", start, end, delay, padding)
+  }
+
+  return s.write(file, s.Frames[first:last+1], delay, padding)
+}
+
+// write Info header & frames to file
+func (s *Stream) write(file string, frames []Frame, delay, padding int) error {
+  src, err := os.Open(s.file)
+  if err != nil {
+    return err
+  }
+  defer src.Close()
+
+  dst, err := os.Create(file)
+  if err != nil {
+    return err
+  }
+  defer dst.Close()
+
+  h := append([]byte{}, s.header...)
+  if _, err = dst.Write(h); err != nil {
+    return err
+  }
+
+  // copy audio frames (contiguous within source)
+  first, end := frames[0].Offset, frames[len(frames)-1].Offset +
+    int64(frames[len(frames)-1].Size)
+  crc := &crc16Writer{ w: dst }
+  _, err = io.Copy(crc, io.NewSectionReader(src, first, end - first))
+  if err != nil {
+    return err
+  }
+
+  total := int64(len(h)) + end - first
+  l := s.layout
+  binary.BigEndian.PutUint32(h[l.frames:], uint32(len(frames)))
+  if l.bytes != -1 {
+    binary.BigEndian.PutUint32(h[l.bytes:], uint32(total))
+  }
+  if l.toc != -1 {
+    for x := 0; x < 100; x++ {
+      f := frames[x * len(frames) / 100]
+      h[l.toc+x] = byte((int64(len(h)) + f.Offset - first) * 256 / total)
+    }
+  }
+
+  // LAME delay & padding, music length & CRCs
+  off := l.lame + 21
+  h[off] = byte(delay >> 4)
+  h[off+1] = byte(delay << 4) | byte(padding >> 8)
+  h[off+2] = byte(padding)
+  binary.BigEndian.PutUint32(h[l.lame+28:], uint32(total))
+  binary.BigEndian.PutUint16(h[l.lame+32:], crc.crc)
+  binary.BigEndian.PutUint16(h[l.lame+34:], crc16(0, h[:l.lame+34]))
+
+  _, err = dst.WriteAt(h, 0)
+  if err != nil {
+    return err
+  }
+  return dst.Close()
+}
+
+// CRC-16 (as LAME: polynomial 0x8005, reflected) of bytes written
+type crc16Writer struct {
+  w io.Writer
+  crc uint16
+}
+
+func (c *crc16Writer) Write(b []byte) (int, error) {
+  c.crc = crc16(c.crc, b)
+  return c.w.Write(b)
+}
+
+var crc16Table = func() [256]uint16 {
+  var t [256]uint16
+  for x := range t {
+    c := uint16(x)
+    for y := 0; y < 8; y++ {
+      if c & 1 != 0 {
+        c = c >> 1 ^ 0xA001
+      } else {
+        c >>= 1
+      }
+    }
+    t[x] = c
+  }
+  return t
+}()
+
+func crc16(crc uint16, b []byte) uint16 {
+  for _, c := range b {
+    crc = crc >> 8 ^ crc16Table[byte(crc) ^ c]
+  }
+  return crc
+}
@@ -0,0 +1,131 @@
+package audioc
+
+import (
+  "fmt"
+  "strconv"
+
+  "github.com/jamlib/audioc/lookup"
+  "github.com/jamlib/audioc/albumart"
+  "github.com/jamlib/audioc/metadata"
+)
+
+// match bundle to a release by track count & durations; studio albums only
+func (a *audioc) processLookup(indexes []int) error {
+  a.Release, a.ReleaseTracks = nil, map[int]*lookup.Track{}
+  if a.Lookup == nil {
+    return nil
+  }
+
+  // live performances (full date) are not looked up
+  m := metadata.New(a.Files[indexes[0]])
+  if m.Info.IsLive() {
+    return nil
+  }
+
+  i := a.InfoFromConfig(indexes[0])
+  i.Artist = i.ToArtist()
+  album := m.Info.Album
+  if len(i.Album) > 0 {
+    album = metadata.New(i.Album).Info.Album
+  }
+
+  // obtain durations (and artist if not specified) from each file
+  durations := make([]float64, 0, len(indexes))
+  for _, x := range indexes {
+    d, err := a.probe(x)
+    if err != nil {
+      return err
+    }
+    if len(i.Artist) == 0 && d.Format.Tags != nil {
+      i.Artist = d.Format.Tags.Artist
+    }
+    durations = append(durations, d.Format.Duration)
+  }
+  if len(i.Artist) == 0 {
+    return nil
+  }
+
+  releases, err := a.Lookup.Search(i.Artist, album)
+  if err != nil {
+    return err
+  }
+
+  // album name may not match, try all releases by artist
+  if len(releases) == 0 && len(album) > 0 {
+    releases, err = a.Lookup.Search(i.Artist, "")
+    if err != nil {
+      return err
+    }
+  }
+
+  r, score := lookup.Match(releases, durations)
+  if r == nil || score < a.Config.LookupThreshold {
+    return nil
+  }
+
+  fmt.Printf("  * matched release: %s - %s (%s, score %.2f)\n",
+    r.Artist, r.Title, r.ID, score)
+
+  a.Release = r
+  for x := range indexes {
+    a.ReleaseTracks[indexes[x]] = r.Tracks[x]
+  }
+
+  return nil
+}
+
+// apply matched release to info; returns true if info changed
+func (a *audioc) applyRelease(index int, i *metadata.Info) bool {
+  t, ok := a.ReleaseTracks[index]
+  if a.Release == nil || !ok {
+    return false
+  }
+  before := *i
+
+  // artist specified via --artist or --collection takes precedence; track
+  // artists of compilations are kept
+  if len(a.Config.Artist) == 0 && !a.Config.Collection &&
+    len(a.AlbumArtist) == 0 {
+    i.Artist = a.Release.Artist
+  }
+
+  // keep date from path or tags as original date of a later release
+  if y := a.Release.Year(); len(y) > 0 && len(i.Year) > 0 && y > i.Year {
+    i.OriginalDate = i.DateTag()
+  }
+
+  i.Month, i.Day = "", ""
+  i.SetAlbum(a.Release.Title)
+  i.Year = a.Release.Year()
+
+  i.Disc = ""
+  if a.Release.Discs() > 1 {
+    i.Disc = strconv.Itoa(t.Disc)
+  }
+  i.Track = strconv.Itoa(t.Number)
+  i.Title = t.Title
+
+  i.MBAlbumID, i.MBTrackID = a.Release.ID, t.ID
+
+  return *i != before
+}
+
+// resolve cover art release ids by artist & album through release lookup
+func (a *audioc) setCoverSearch(p albumart.CoverProvider) {
+  if c, ok := p.(*albumart.CoverCache); ok {
+    p = c.Provider
+  }
+
+  caa, ok := p.(*albumart.CoverArtArchive)
+  if !ok || a.Lookup == nil {
+    return
+  }
+
+  caa.Search = func(artist, album string) (string, error) {
+    releases, err := a.Lookup.Search(artist, album)
+    if err != nil || len(releases) == 0 {
+      return "", err
+    }
+    return releases[0].ID, nil
+  }
+}
@@ -0,0 +1,127 @@
+package audioc
+
+import (
+  "fmt"
+  "math"
+  "regexp"
+  "strconv"
+)
+
+// ReplayGain 2.0 reference loudness (LUFS)
+const replayGainReference = -18.0
+
+type trackGain struct {
+  File string
+  Loudness, Peak, Duration float64
+}
+
+// analyze integrated loudness & true peak with ffmpeg ebur128 filter
+func (a *audioc) analyzeLoudness(file string, duration float64) (*trackGain, error) {
+  out, err := a.Ffmpeg.Exec([]string{ "-nostats", "-i", file, "-map", "0:a",
+    "-af", "ebur128=peak=true:metadata=1,ametadata=mode=print:file=-",
+    "-f", "null", "-" }...)
+  if err != nil {
+    return nil, err
+  }
+
+  l, p, ok := parseLoudness(out)
+  if !ok {
+    return nil, nil
+  }
+  return &trackGain{ File: file, Loudness: l, Peak: p, Duration: duration }, nil
+}
+
+// last integrated loudness & max linear peak printed by ametadata
+func parseLoudness(out string) (float64, float64, bool) {
+  loudness, peak, found := 0.0, 0.0, false
+
+  re := regexp.MustCompile(`lavfi\.r128\.(I|true_peaks_ch\d+)=(-?[\d.]+|-?inf)`)
+  for _, m := range re.FindAllStringSubmatch(out, -1) {
+    v, err := strconv.ParseFloat(m[2], 64)
+    if err != nil {
+      continue
+    }
+    if m[1] == "I" {
+      loudness, found = v, true
+    } else if v > peak {
+      peak = v
+    }
+  }
+
+  // silence has no measurable loudness
+  if math.IsInf(loudness, 0) || loudness < -70 {
+    return loudness, peak, false
+  }
+  return loudness, peak, found
+}
+
+// analyze processed file (if --replaygain), storing result for bundle
+func (a *audioc) processLoudness(file string, duration float64) error {
+  if !a.Config.ReplayGain || !a.Config.Write {
+    return nil
+  }
+
+  t, err := a.analyzeLoudness(file, duration)
+  if err != nil || t == nil {
+    return err
+  }
+
+  a.gainsMutex.Lock()
+  a.Gains = append(a.Gains, t)
+  a.gainsMutex.Unlock()
+  return nil
+}
+
+// duration weighted energy mean of track loudness & max track peak
+func albumGain(tracks []*trackGain) (float64, float64) {
+  energy, duration, peak := 0.0, 0.0, 0.0
+  for _, t := range tracks {
+    d := t.Duration
+    if d <= 0 {
+      d = 1
+    }
+    energy += d * math.Pow(10, t.Loudness / 10)
+    duration += d
+    peak = math.Max(peak, t.Peak)
+  }
+  return 10 * math.Log10(energy / duration), peak
+}
+
+func replayGainTags(prefix string, loudness, peak float64) map[string]string {
+  return map[string]string{
+    "REPLAYGAIN_" + prefix + "_GAIN": fmt.Sprintf("%.2f dB",
+      replayGainReference - loudness),
+    "REPLAYGAIN_" + prefix + "_PEAK": fmt.Sprintf("%.6f", peak),
+  }
+}
+
+// write track & album gain once all tracks of bundle have been analyzed;
+// album gain is skipped (with warning) if any track was not analyzed
+func (a *audioc) processReplayGain(count int) error {
+  if len(a.Gains) == 0 {
+    return nil
+  }
+
+  var album map[string]string
+  if len(a.Gains) == count {
+    l, p := albumGain(a.Gains)
+    album = replayGainTags("ALBUM", l, p)
+  } else {
+    fmt.Printf("\n  * album gain not written: %d of %d tracks analyzed " +
+      "(unchanged tracks are skipped unless --force)\n", len(a.Gains), count)
+  }
+
+  for _, t := range a.Gains {
+    tags := replayGainTags("TRACK", t.Loudness, t.Peak)
+    for k, v := range album {
+      tags[k] = v
+    }
+
+    err := a.writeTags(t.File, tags)
+    if err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
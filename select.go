@@ -0,0 +1,84 @@
+package audioc
+
+import (
+  "os"
+  "strings"
+  "path/filepath"
+
+  "github.com/jamlib/audioc/filter"
+  "github.com/jamlib/audioc/metadata"
+)
+
+// fields of file (relative to a.Config.Dir) matched by --select, --include
+// & --exclude; derived from path so files are never probed
+func (a *audioc) selectValues(file string, i *metadata.Info) map[string]string {
+  artwork := "no"
+  if hasFolderArt(filepath.Join(a.Config.Dir, filepath.Dir(file))) {
+    artwork = "yes"
+  }
+
+  return map[string]string{ "artist": i.ToArtist(), "album": i.Album,
+    "year": i.Year, "date": i.DateTag(), "title": i.Title,
+    "format": strings.TrimPrefix(strings.ToLower(filepath.Ext(file)), "."),
+    "path": filepath.ToSlash(file), "artwork": artwork }
+}
+
+// folder.jpg within dir, or album folder of disc folder (ie "CD1")
+func hasFolderArt(dir string) bool {
+  if _, err := os.Stat(filepath.Join(dir, "folder.jpg")); err == nil {
+    return true
+  }
+  if len(metadata.DiscFolder(filepath.Base(dir))) > 0 {
+    _, err := os.Stat(filepath.Join(filepath.Dir(dir), "folder.jpg"))
+    return err == nil
+  }
+  return false
+}
+
+// files of albums with any file matching --include (if provided) & not
+// matching --exclude; albums are kept whole since processBundle moves the
+// album folder as a whole
+func (a *audioc) filterFiles() error {
+  if len(a.Config.Include) == 0 && len(a.Config.Exclude) == 0 {
+    return nil
+  }
+
+  include, err := filter.Parse(a.Config.Include)
+  if err != nil {
+    return err
+  }
+  exclude, err := filter.Parse(a.Config.Exclude)
+  if err != nil {
+    return err
+  }
+
+  selected := map[int]bool{}
+  err = a.bundleFiles(func(indexes []int) error {
+    for _, x := range indexes {
+      i := metadata.New(a.Files[x]).Info
+      i.Artist = a.InfoFromConfig(x).Artist
+
+      v := a.selectValues(a.Files[x], i)
+      if include.Match(v) && (len(exclude) == 0 || !exclude.Match(v)) {
+        for _, y := range indexes {
+          selected[y] = true
+        }
+        break
+      }
+    }
+    return nil
+  })
+  if err != nil {
+    return err
+  }
+
+  files := []string{}
+  for x := range a.Files {
+    if selected[x] {
+      files = append(files, a.Files[x])
+    }
+  }
+
+  a.Files = files
+  return nil
+}
@@ -0,0 +1,421 @@
+package audioc
+
+import (
+  "os"
+  "fmt"
+  "sort"
+  "image"
+  "strings"
+  "io/ioutil"
+  "encoding/json"
+  "path/filepath"
+
+  "github.com/jamlib/libaudio/fsutil"
+  "github.com/jamlib/audioc/filter"
+  "github.com/jamlib/audioc/fsprofile"
+  "github.com/jamlib/audioc/metadata"
+  "github.com/jamlib/audioc/albumart"
+)
+
+// manifest of device copies within root of sync destination
+const syncManifest = ".audioc-sync.json"
+
+// extension of each sync format
+var syncFormats = map[string]string{
+  "mp3": ".mp3", "opus": ".opus", "aac": ".m4a", "flac": ".flac",
+}
+
+// device copy of library file; copied again when source, format or options
+// affecting the copy (--bitrate of lossy conversions, --artwork of embedded
+// & exported artwork) change
+type syncEntry struct {
+  Source string
+  Size, ModTime int64
+  Format string
+  Bitrate, Artwork string
+}
+
+// library file selected for sync
+type syncItem struct {
+  dst string
+  entry *syncEntry
+  info *metadata.Info
+}
+
+// mirror library (a.Config.Dir) to device (--to) in format (--format),
+// copying only new or changed files selected by --select & removing files
+// no longer selected
+func (a *audioc) Sync() error {
+  fi, err := os.Stat(a.Config.Dir)
+  if err != nil || !fi.IsDir() {
+    return fmt.Errorf("Invalid directory: %s", a.Config.Dir)
+  }
+  if len(a.Config.To) == 0 {
+    return fmt.Errorf("Must provide --to device folder")
+  }
+
+  format := strings.ToLower(a.Config.Format)
+  if len(format) == 0 {
+    format = "mp3"
+  }
+  if _, ok := syncFormats[format]; !ok {
+    return fmt.Errorf("Invalid sync format: %s", a.Config.Format)
+  }
+
+  sel, err := filter.Parse(a.Config.Select)
+  if err != nil {
+    return err
+  }
+
+  a.Profile, err = fsprofile.Get(a.Config.Filesystem)
+  if err != nil {
+    return err
+  }
+  a.Paths = a.Profile.NewPaths(a.Config.To)
+  a.ArtOptions, err = albumart.ParseOptions(a.Config.Artwork)
+  if err != nil {
+    return err
+  }
+
+  manifest, err := readSyncManifest(a.Config.To)
+  if err != nil {
+    return err
+  }
+
+  // select library files & resolve device paths
+  a.Files, err = a.audioFiles()
+  if err != nil {
+    return err
+  }
+  items := []*syncItem{}
+  for x := range a.Files {
+    i := syncInfo(a.Files[x])
+    if !sel.Match(a.selectValues(a.Files[x], i)) {
+      continue
+    }
+
+    fi, err := os.Stat(filepath.Join(a.Config.Dir, a.Files[x]))
+    if err != nil {
+      return err
+    }
+
+    ext := syncFormats[format]
+    // lossy sources are never converted to FLAC; copied as is
+    if format == "flac" && strings.ToLower(filepath.Ext(a.Files[x])) != ".flac" {
+      ext = strings.ToLower(filepath.Ext(a.Files[x]))
+    }
+
+    e := &syncEntry{ Source: a.Files[x], Size: fi.Size(),
+      ModTime: fi.ModTime().Unix(), Format: format }
+    if ext != strings.ToLower(filepath.Ext(a.Files[x])) {
+      e.Bitrate = a.syncBitrate(ext)
+    }
+    if ext == ".mp3" || ext == ".m4a" {
+      e.Artwork = a.Config.Artwork
+    }
+
+    items = append(items, &syncItem{ dst: a.syncPath(a.Files[x], ext),
+      info: i, entry: e })
+  }
+
+  // device copies known current (written even if sync fails part way, so
+  // files already copied are not copied again)
+  synced := map[string]*syncEntry{}
+  for k, v := range manifest {
+    synced[k] = v
+  }
+  copied, removed, err := a.syncItems(items, manifest, synced)
+  if a.Config.Write {
+    if e := writeSyncManifest(a.Config.To, synced); err == nil {
+      err = e
+    }
+  }
+  if err != nil {
+    return err
+  }
+
+  fmt.Printf("\n%d files synced, %d removed, %d up to date.\n", copied,
+    removed, len(items) - copied)
+  fmt.Printf("\naudioc finished.\n")
+  return nil
+}
+
+// copy artwork & files of items not current within manifest, then remove
+// device copies no longer selected; synced is updated as each is written
+func (a *audioc) syncItems(items []*syncItem, manifest,
+  synced map[string]*syncEntry) (int, int, error) {
+
+  var err error
+
+  result := map[string]*syncEntry{}
+  copied, removed := 0, 0
+
+  // front artwork once per device album folder (before tracks embed it)
+  for _, it := range items {
+    art := filepath.Join(filepath.Dir(it.dst), "folder.jpg")
+    if _, ok := result[art]; ok {
+      continue
+    }
+    e := syncArtwork(a.Config.Dir, filepath.Dir(it.entry.Source))
+    if e == nil {
+      continue
+    }
+    e.Artwork = a.Config.Artwork
+    result[art] = e
+
+    if a.syncCurrent(manifest[art], e, art) {
+      continue
+    }
+    fmt.Printf("artwork: %v\n", filepath.Join(a.Config.To, art))
+    if a.Config.Write {
+      err = os.MkdirAll(filepath.Join(a.Config.To, filepath.Dir(art)), 0777)
+      if err != nil {
+        return copied, removed, err
+      }
+      err = a.ArtOptions.Export(filepath.Join(a.Config.Dir, e.Source),
+        filepath.Join(a.Config.To, art))
+      if err != nil {
+        return copied, removed, err
+      }
+      synced[art] = e
+    }
+  }
+
+  for _, it := range items {
+    result[it.dst] = it.entry
+    if a.syncCurrent(manifest[it.dst], it.entry, it.dst) {
+      continue
+    }
+
+    copied++
+    fmt.Printf("sync: %v\n  * to: %v\n", filepath.Join(a.Config.Dir,
+      it.entry.Source), filepath.Join(a.Config.To, it.dst))
+    if !a.Config.Write {
+      continue
+    }
+
+    err = a.syncFile(it)
+    if err != nil {
+      return copied, removed, err
+    }
+    synced[it.dst] = it.entry
+  }
+
+  // remove device copies no longer selected (only those synced before)
+  dsts := make([]string, 0, len(manifest))
+  for dst := range manifest {
+    dsts = append(dsts, dst)
+  }
+  sort.Strings(dsts)
+  for _, dst := range dsts {
+    if _, ok := result[dst]; ok {
+      continue
+    }
+    if filepath.Ext(dst) != ".jpg" {
+      removed++
+    }
+    fmt.Printf("remove: %v\n", filepath.Join(a.Config.To, dst))
+    if a.Config.Write {
+      err = removeSynced(a.Config.To, dst)
+      if err != nil {
+        return copied, removed, err
+      }
+      delete(synced, dst)
+    }
+  }
+
+  return copied, removed, nil
+}
+
+// info of organized library file; artist from top folder
+func syncInfo(file string) *metadata.Info {
+  i := metadata.New(file).Info
+  i.Artist = strings.Split(file, fsutil.PathSep)[0]
+  return i
+}
+
+// device path mirroring library path (Artist/Year/Album) made valid for
+// filesystem profile (--filesystem)
+func (a *audioc) syncPath(file, ext string) string {
+  names := strings.Split(strings.TrimSuffix(file, filepath.Ext(file)),
+    fsutil.PathSep)
+  for x := range names {
+    names[x] = a.profile().Clean(names[x])
+  }
+
+  // match case of device folders & never overwrite another file (ie names
+  // differing only by case on FAT32)
+  p := a.profile().Shorten(filepath.Join(names...), ext)
+  if a.Paths != nil {
+    p = a.Paths.Claim(p)
+  }
+  return p
+}
+
+// true if device copy exists & matches entry synced before
+func (a *audioc) syncCurrent(old, e *syncEntry, dst string) bool {
+  if old == nil || *old != *e {
+    return false
+  }
+  _, err := os.Stat(filepath.Join(a.Config.To, dst))
+  return err == nil
+}
+
+// folder.jpg, otherwise front image, within library folder dir
+func syncArtwork(root, dir string) *syncEntry {
+  src := filepath.Join(root, dir, "folder.jpg")
+  if _, err := os.Stat(src); err != nil {
+    img := albumart.FrontImage(albumart.Classify(filepath.Join(root, dir),
+      image.DecodeConfig))
+    if img == nil {
+      return nil
+    }
+    src = img.Path
+  }
+
+  fi, err := os.Stat(src)
+  if err != nil {
+    return nil
+  }
+  rel, _ := filepath.Rel(root, src)
+  return &syncEntry{ Source: rel, Size: fi.Size(),
+    ModTime: fi.ModTime().Unix(), Format: "jpg" }
+}
+
+// convert (or copy) library file to temp file within device folder, then
+// rename so interrupted syncs never leave partial copies
+func (a *audioc) syncFile(it *syncItem) error {
+  src := filepath.Join(a.Config.Dir, it.entry.Source)
+  dst := filepath.Join(a.Config.To, it.dst)
+  ext := filepath.Ext(dst)
+  tmp := strings.TrimSuffix(dst, ext) + ".audioc-tmp" + ext
+
+  err := os.MkdirAll(filepath.Dir(dst), 0777)
+  if err != nil {
+    return err
+  }
+  defer os.Remove(tmp)
+
+  art := filepath.Join(filepath.Dir(dst), "folder.jpg")
+  if _, err := os.Stat(art); err != nil {
+    art = ""
+  }
+
+  srcExt := strings.ToLower(filepath.Ext(src))
+  switch {
+  case srcExt == ext:
+    if ext != ".mp3" {
+      err = fsutil.CopyFile(src, tmp)
+      break
+    }
+    fallthrough
+  case ext == ".mp3":
+    err = a.syncMp3(src, tmp, art, it.info)
+  case ext == ".m4a":
+    args := []string{ "-i", src }
+    if len(art) > 0 {
+      args = append(args, "-i", art, "-map", "1:v", "-c:v", "copy",
+        "-disposition:v", "attached_pic")
+    }
+    args = append(args, "-map", "0:a", "-c:a", "aac", "-b:a",
+      a.syncBitrate(ext), "-map_metadata", "0", "-movflags", "+faststart",
+      "-y", tmp)
+    _, err = a.Ffmpeg.Exec(args...)
+  case ext == ".opus":
+    _, err = a.Ffmpeg.Exec("-i", src, "-map", "0:a", "-c:a", "libopus",
+      "-b:a", a.syncBitrate(ext), "-map_metadata", "0", "-y", tmp)
+  default:
+    err = fmt.Errorf("Cannot sync %s as %s", src, ext)
+  }
+  if err != nil {
+    return err
+  }
+
+  if _, err = os.Stat(tmp); err != nil {
+    return fmt.Errorf("File not synced: %s", src)
+  }
+  return os.Rename(tmp, dst)
+}
+
+// bitrate of lossy conversion to ext per --bitrate; V0 converts AAC at 256k &
+// Opus at 128k, 320 converts both at 320k. empty if lossless
+func (a *audioc) syncBitrate(ext string) string {
+  switch ext {
+  case ".mp3":
+    return a.Config.Bitrate
+  case ".m4a", ".opus":
+    if a.Config.Bitrate == "320" {
+      return "320k"
+    }
+    if ext == ".m4a" {
+      return "256k"
+    }
+    return "128k"
+  }
+  return ""
+}
+
+// convert to mp3 (mp3 sources copied) with tags of source & front artwork
+func (a *audioc) syncMp3(src, dst, art string, i *metadata.Info) error {
+  m := &metadata.Metadata{ Info: i }
+  d, err := a.Ffprobe.GetData(src)
+  if err != nil {
+    return err
+  }
+  if d.Format != nil && d.Format.Tags != nil {
+    i, _ = m.MatchBestInfo(&metadata.Info{ Artist: i.Artist },
+      metadata.ProbeTagsToInfo(d.Format.Tags))
+  }
+
+  quality := a.Config.Bitrate
+  if strings.ToLower(filepath.Ext(src)) == ".mp3" {
+    quality = "copy"
+  }
+
+  err = a.toMp3(src, dst, quality, art, i)
+  if err != nil {
+    return err
+  }
+
+  // keep album artist, genre, etc (writeTags requires --write)
+  return a.writeTags(dst, a.mapTags(sourceTags(src, d), i, false))
+}
+
+// remove device copy, then folders left empty (up to device root)
+func removeSynced(root, dst string) error {
+  err := os.Remove(filepath.Join(root, dst))
+  if err != nil && !os.IsNotExist(err) {
+    return err
+  }
+
+  for dir := filepath.Dir(dst); dir != "." && dir != fsutil.PathSep; dir = filepath.Dir(dir) {
+    if os.Remove(filepath.Join(root, dir)) != nil {
+      break
+    }
+  }
+  return nil
+}
+
+func readSyncManifest(root string) (map[string]*syncEntry, error) {
+  m := map[string]*syncEntry{}
+  b, err := ioutil.ReadFile(filepath.Join(root, syncManifest))
+  if os.IsNotExist(err) {
+    return m, nil
+  }
+  if err != nil {
+    return m, err
+  }
+  return m, json.Unmarshal(b, &m)
+}
+
+func writeSyncManifest(root string, m map[string]*syncEntry) error {
+  b, err := json.MarshalIndent(m, "", "  ")
+  if err != nil {
+    return err
+  }
+  err = os.MkdirAll(root, 0777)
+  if err != nil {
+    return err
+  }
+  return ioutil.WriteFile(filepath.Join(root, syncManifest), b, 0644)
+}
@@ -0,0 +1,186 @@
+package tagmap
+
+import (
+  "os"
+  "fmt"
+  "sort"
+  "bufio"
+  "strings"
+)
+
+// tags written by audioc itself; never passed through from source
+var Managed = map[string]bool{
+  "ARTIST": true, "ALBUM": true, "ALBUMARTIST": true, "TITLE": true,
+  "TRACKNUMBER": true, "TRACKTOTAL": true, "TOTALTRACKS": true,
+  "DISCNUMBER": true, "DISCTOTAL": true, "TOTALDISCS": true,
+  "DATE": true, "ORIGINALDATE": true, "COMPILATION": true, "ENCODER": true,
+  "MUSICBRAINZ_ALBUMID": true, "MUSICBRAINZ_RELEASETRACKID": true,
+  "SOURCE": true, "SHNID": true, "SET": true, "ITUNSMPB": true,
+  "REPLAYGAIN_TRACK_GAIN": true, "REPLAYGAIN_TRACK_PEAK": true,
+  "REPLAYGAIN_ALBUM_GAIN": true, "REPLAYGAIN_ALBUM_PEAK": true,
+}
+
+// which source tags are preserved & how they are named
+type Rules struct {
+  // whitelist of tags kept; empty keeps all (except Drop)
+  Keep map[string]bool
+  // blacklist of tags removed
+  Drop map[string]bool
+  // source tag names renamed, ie "ARTIST SORT" to "ARTISTSORT"
+  Rename map[string]string
+  // tag values set per artist (lowercase)
+  Set map[string]map[string]string
+}
+
+func NewRules() *Rules {
+  return &Rules{ Keep: map[string]bool{}, Drop: map[string]bool{},
+    Rename: map[string]string{}, Set: map[string]map[string]string{} }
+}
+
+// read rules, one per line:
+//   keep = GENRE, COMPOSER, LYRICS
+//   drop = COMMENT
+//   rename ARTIST SORT = ARTISTSORT
+//   set Grateful Dead: GENRE = Rock
+func ReadRules(file string) (*Rules, error) {
+  r := NewRules()
+
+  f, err := os.Open(file)
+  if err != nil {
+    return r, err
+  }
+  defer f.Close()
+
+  s := bufio.NewScanner(f)
+  for s.Scan() {
+    l := strings.TrimSpace(s.Text())
+    if len(l) == 0 || strings.HasPrefix(l, "#") {
+      continue
+    }
+
+    err = r.parse(l)
+    if err != nil {
+      return r, err
+    }
+  }
+
+  return r, s.Err()
+}
+
+func (r *Rules) parse(l string) error {
+  invalid := fmt.Errorf("invalid tag rule: %v", l)
+
+  op := strings.ToLower(strings.Fields(l)[0])
+  kv := strings.SplitN(strings.TrimSpace(l[len(op):]), "=", 2)
+  if len(kv) != 2 {
+    return invalid
+  }
+  k, v := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+
+  switch op {
+  case "keep", "drop":
+    if len(k) > 0 {
+      return invalid
+    }
+    for _, n := range strings.Split(v, ",") {
+      if n = Name(n); len(n) > 0 && op == "keep" {
+        r.Keep[n] = true
+      } else if len(n) > 0 {
+        r.Drop[n] = true
+      }
+    }
+  case "rename":
+    if len(k) == 0 || len(v) == 0 {
+      return invalid
+    }
+    r.Rename[strings.ToUpper(k)] = Name(v)
+  case "set":
+    ak := strings.SplitN(k, ":", 2)
+    if len(ak) != 2 || len(strings.TrimSpace(ak[1])) == 0 {
+      return invalid
+    }
+    artist := strings.ToLower(strings.TrimSpace(ak[0]))
+    if r.Set[artist] == nil {
+      r.Set[artist] = map[string]string{}
+    }
+    r.Set[artist][Name(ak[1])] = v
+  default:
+    return invalid
+  }
+  return nil
+}
+
+// vorbis comment name of source tag after rename rules
+func (r *Rules) name(key string) string {
+  if n, ok := r.Rename[strings.ToUpper(strings.TrimSpace(key))]; ok {
+    return n
+  }
+  n := Name(key)
+  if rn, ok := r.Rename[n]; ok {
+    return rn
+  }
+  return n
+}
+
+func (r *Rules) kept(name string) bool {
+  if r.Drop[name] {
+    return false
+  }
+  return len(r.Keep) == 0 || r.Keep[name]
+}
+
+// tags to write keyed by vorbis comment name: source tags (any naming) kept
+// by rules, then tags set by audioc, then values set for any of artists.
+// source tags not kept map to "" so they are removed
+func (r *Rules) Apply(artists []string, source,
+  tags map[string]string) map[string]string {
+
+  // sorted so renamed duplicates resolve consistently
+  keys := make([]string, 0, len(source))
+  for k := range source {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+
+  out := map[string]string{}
+  for _, k := range keys {
+    v, n := source[k], r.name(k)
+    if Managed[n] || len(n) == 0 {
+      continue
+    }
+    if _, ok := tags[n]; ok {
+      continue
+    }
+
+    // remove source tag under former name
+    if o := Name(k); o != n && !Managed[o] {
+      if _, ok := out[o]; !ok {
+        out[o] = ""
+      }
+    }
+
+    if !r.kept(n) {
+      v = ""
+    }
+    // first of renamed duplicates (ie "ARTIST SORT" & "ARTISTSORT") wins
+    if existing, ok := out[n]; !ok || len(existing) == 0 {
+      out[n] = v
+    }
+  }
+
+  // set by audioc; genre & comment may be dropped
+  for k, v := range tags {
+    if !Managed[k] && !r.kept(k) {
+      v = ""
+    }
+    out[k] = v
+  }
+
+  for _, a := range artists {
+    for k, v := range r.Set[strings.ToLower(a)] {
+      out[k] = v
+    }
+  }
+
+  return out
+}
@@ -0,0 +1,112 @@
+package tagmap
+
+import (
+  "regexp"
+  "strings"
+)
+
+// vorbis comment names mapped to ID3v2.4 text frames
+var id3Frames = map[string]string{
+  "ARTIST": "TPE1",
+  "ALBUM": "TALB",
+  "TITLE": "TIT2",
+  "TRACKNUMBER": "TRCK",
+  "DISCNUMBER": "TPOS",
+  "DATE": "TDRC",
+  "ORIGINALDATE": "TDOR",
+  "ALBUMARTIST": "TPE2",
+  "COMPILATION": "TCMP",
+  "GENRE": "TCON",
+  "COMPOSER": "TCOM",
+  "CONDUCTOR": "TPE3",
+  "LYRICIST": "TEXT",
+  "BPM": "TBPM",
+  "COPYRIGHT": "TCOP",
+  "LABEL": "TPUB",
+  "ISRC": "TSRC",
+  "ENCODEDBY": "TENC",
+  "ENCODER": "TSSE",
+  "MOOD": "TMOO",
+  "MEDIA": "TMED",
+  "GROUPING": "TIT1",
+  "SUBTITLE": "TIT3",
+  "LANGUAGE": "TLAN",
+  "KEY": "TKEY",
+  "ARTISTSORT": "TSOP",
+  "ALBUMSORT": "TSOA",
+  "TITLESORT": "TSOT",
+  "ALBUMARTISTSORT": "TSO2",
+  "COMPOSERSORT": "TSOC",
+  "COMMENT": "COMM",
+  "LYRICS": "USLT",
+}
+
+// vorbis comment names mapped to ID3v2 TXXX descriptions
+var id3Descriptions = map[string]string{
+  "MUSICBRAINZ_ALBUMID": "MusicBrainz Album Id",
+  "MUSICBRAINZ_ARTISTID": "MusicBrainz Artist Id",
+  "MUSICBRAINZ_ALBUMARTISTID": "MusicBrainz Album Artist Id",
+  "MUSICBRAINZ_RELEASETRACKID": "MusicBrainz Release Track Id",
+  "MUSICBRAINZ_TRACKID": "MusicBrainz Track Id",
+  "ITUNSMPB": "iTunSMPB",
+}
+
+// alternate names (ie ffprobe & v2.3 frames) of vorbis comment names
+var aliases = map[string]string{
+  "ALBUM_ARTIST": "ALBUMARTIST",
+  "ALBUM ARTIST": "ALBUMARTIST",
+  "TRACK": "TRACKNUMBER",
+  "DISC": "DISCNUMBER",
+  "YEAR": "DATE",
+  "ORIGINALYEAR": "ORIGINALDATE",
+  "ENCODED_BY": "ENCODEDBY",
+  "PUBLISHER": "LABEL",
+  "DESCRIPTION": "COMMENT",
+  "UNSYNCEDLYRICS": "LYRICS",
+  "TYER": "DATE",
+  "TDAT": "DATE",
+  "TORY": "ORIGINALDATE",
+}
+
+var id3Names, descNames = reverse(id3Frames), reverse(id3Descriptions)
+
+func reverse(m map[string]string) map[string]string {
+  r := make(map[string]string, len(m))
+  for k, v := range m {
+    r[strings.ToUpper(v)] = k
+  }
+  return r
+}
+
+// vorbis comment name of any vorbis, ffprobe or ID3 frame (or TXXX
+// description) name, ie "TCOM" is "COMPOSER"
+func Name(key string) string {
+  k := strings.ToUpper(strings.TrimSpace(key))
+
+  if n, ok := aliases[k]; ok {
+    return n
+  }
+  if n, ok := id3Names[k]; ok {
+    return n
+  }
+  if n, ok := descNames[k]; ok {
+    return n
+  }
+  return k
+}
+
+// ID3v2 frame of vorbis comment name; TXXX frames include description
+func ID3(name string) (string, string) {
+  name = Name(name)
+  if f, ok := id3Frames[name]; ok {
+    return f, ""
+  }
+  if d, ok := id3Descriptions[name]; ok {
+    return "TXXX", d
+  }
+  // other ID3v2 text frames (ie "TLEN") kept as is
+  if regexp.MustCompile(`^T[A-Z0-9]{3}$`).MatchString(name) {
+    return name, ""
+  }
+  return "TXXX", name
+}
@@ -0,0 +1,100 @@
+package tagmap
+
+import (
+  "os"
+  "testing"
+  "io/ioutil"
+  "path/filepath"
+)
+
+func TestName(t *testing.T) {
+  tests := map[string]string{
+    "composer": "COMPOSER",
+    "TCOM": "COMPOSER",
+    "album_artist": "ALBUMARTIST",
+    "MusicBrainz Album Id": "MUSICBRAINZ_ALBUMID",
+    "custom": "CUSTOM",
+  }
+
+  for k, v := range tests {
+    if n := Name(k); n != v {
+      t.Errorf("%v: Expected %v, got %v", k, v, n)
+    }
+  }
+}
+
+func TestID3(t *testing.T) {
+  tests := []struct {
+    name, frame, desc string
+  }{
+    { name: "GENRE", frame: "TCON" },
+    { name: "album_artist", frame: "TPE2" },
+    { name: "LYRICS", frame: "USLT" },
+    { name: "MUSICBRAINZ_ALBUMID", frame: "TXXX", desc: "MusicBrainz Album Id" },
+    { name: "TLEN", frame: "TLEN" },
+    { name: "custom", frame: "TXXX", desc: "CUSTOM" },
+  }
+
+  for _, tt := range tests {
+    f, d := ID3(tt.name)
+    if f != tt.frame || d != tt.desc {
+      t.Errorf("%v: Expected %v %v, got %v %v", tt.name, tt.frame, tt.desc, f, d)
+    }
+  }
+}
+
+func TestReadRules(t *testing.T) {
+  dir, err := ioutil.TempDir("", "tagmap")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  file := filepath.Join(dir, "rules.txt")
+  ioutil.WriteFile(file, []byte("# rules\n" +
+    "keep = genre, TCOM, ARTISTSORT, mood\n" +
+    "drop = comment\n" +
+    "rename ARTIST SORT = ARTISTSORT\n" +
+    "set Grateful Dead: GENRE = Rock\n"), 0644)
+
+  r, err := ReadRules(file)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if !r.Keep["COMPOSER"] || !r.Drop["COMMENT"] ||
+    r.Rename["ARTIST SORT"] != "ARTISTSORT" ||
+    r.Set["grateful dead"]["GENRE"] != "Rock" {
+    t.Errorf("Unexpected rules %+v", r)
+  }
+
+  source := map[string]string{ "artist": "GD", "ARTIST SORT": "Dead, Grateful",
+    "composer": "Garcia", "LYRICS": "...", "COMMENT": "old", "GENRE": "Jam" }
+  tags := map[string]string{ "ARTIST": "Grateful Dead", "COMMENT": "new" }
+
+  out := r.Apply([]string{ "Grateful Dead" }, source, tags)
+  e := map[string]string{ "ARTIST": "Grateful Dead", "ARTISTSORT": "Dead, Grateful",
+    "ARTIST SORT": "", "COMPOSER": "Garcia", "LYRICS": "", "COMMENT": "",
+    "GENRE": "Rock" }
+  if len(out) != len(e) {
+    t.Errorf("Expected %v, got %v", e, out)
+  }
+  for k, v := range e {
+    if out[k] != v {
+      t.Errorf("%v: Expected %q, got %q", k, v, out[k])
+    }
+  }
+
+  // no rules keeps all
+  out = NewRules().Apply(nil, source, map[string]string{})
+  if out["LYRICS"] != "..." || out["GENRE"] != "Jam" || len(out) != 5 {
+    t.Errorf("Expected all source tags except artist, got %v", out)
+  }
+
+  for _, l := range []string{ "keep GENRE", "rename = X", "set GENRE = Rock",
+    "other = 1" } {
+    if err := NewRules().parse(l); err == nil {
+      t.Errorf("%v: Expected error", l)
+    }
+  }
+}
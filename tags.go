@@ -0,0 +1,220 @@
+package audioc
+
+import (
+  "fmt"
+  "sort"
+  "strings"
+  "os/exec"
+  "path/filepath"
+
+  "github.com/jamlib/libaudio/ffprobe"
+  "github.com/jamlib/audioc/id3"
+  "github.com/jamlib/audioc/flac"
+  "github.com/jamlib/audioc/tagmap"
+  "github.com/jamlib/audioc/metadata"
+  "github.com/jamlib/audioc/albumart"
+)
+
+// write tags not supported by ffmpeg.Metadata; keys are vorbis comment names
+func (a *audioc) writeTags(file string, tags map[string]string) error {
+  if !a.Config.Write || len(tags) == 0 {
+    return nil
+  }
+
+  // sort keys so args are consistent
+  keys := make([]string, 0, len(tags))
+  for k := range tags {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+
+  switch strings.ToLower(filepath.Ext(file)) {
+  case ".mp3":
+    return a.writeTagsMp3(file, keys, tags)
+  case ".flac":
+    return writeTagsFlac(file, keys, tags)
+  }
+  return nil
+}
+
+// set frames natively within existing ID3v2 tag; tags without a matching
+// frame are written as TXXX. empty values remove frames
+func (a *audioc) writeTagsMp3(file string, keys []string,
+  tags map[string]string) error {
+
+  t, err := id3.ReadFile(file)
+  if err == id3.ErrNoTag {
+    t, err = id3.New(), nil
+  }
+  if err != nil {
+    return err
+  }
+
+  for _, k := range keys {
+    switch k {
+    case "DATE":
+      t.SetDate(tags[k])
+      continue
+    case "ORIGINALDATE":
+      t.SetOriginalDate(tags[k])
+      continue
+    }
+
+    switch id, desc := tagmap.ID3(k); id {
+    case "COMM":
+      t.SetComment(tags[k])
+    case "USLT":
+      t.SetLyrics(tags[k])
+    case "TXXX":
+      t.SetUserText(desc, tags[k])
+    default:
+      t.SetText(id, tags[k])
+    }
+  }
+
+  return id3.WriteFile(file, t)
+}
+
+// set vorbis comments (empty values removed) with metaflac; skipped if
+// metaflac is not installed (warned of by processFile)
+func writeTagsFlac(file string, keys []string, tags map[string]string) error {
+  bin, err := exec.LookPath("metaflac")
+  if err != nil {
+    return nil
+  }
+
+  args := []string{}
+  for _, k := range keys {
+    args = append(args, "--remove-tag=" + k)
+    if len(tags[k]) > 0 {
+      args = append(args, "--set-tag=" + k + "=" + tags[k])
+    }
+  }
+  args = append(args, file)
+
+  out, err := exec.Command(bin, args...).CombinedOutput()
+  if err != nil {
+    return fmt.Errorf("%v: %s", err, out)
+  }
+  return nil
+}
+
+// replace FLAC PICTURE blocks with front cover (a.Image) & typed artwork
+// found within album folder; skipped if metaflac is not installed (warned
+// of by processFile)
+func (a *audioc) writePictures(file string) error {
+  if !a.Config.Write || len(a.Image) == 0 ||
+    strings.ToLower(filepath.Ext(file)) != ".flac" {
+    return nil
+  }
+
+  bin, err := exec.LookPath("metaflac")
+  if err != nil {
+    return nil
+  }
+
+  args := []string{ fmt.Sprintf("--import-picture-from=%d||||%s",
+    albumart.RoleFront.PictureType(), a.Image) }
+  for _, img := range a.Pictures {
+    if img.Role == albumart.RoleFront || img.Role == albumart.RoleOther {
+      continue
+    }
+    args = append(args, fmt.Sprintf("--import-picture-from=%d||||%s",
+      img.Role.PictureType(), img.Path))
+  }
+
+  cmds := [][]string{ { "--remove", "--block-type=PICTURE", file },
+    append(args, file) }
+  for _, c := range cmds {
+    out, err := exec.Command(bin, c...).CombinedOutput()
+    if err != nil {
+      return fmt.Errorf("%v: %s", err, out)
+    }
+  }
+  return nil
+}
+
+// album artist & compilation tags (not reported by ffprobe) read natively
+// from ID3v2 (TPE2, TCMP) or vorbis comments (ALBUMARTIST, COMPILATION)
+func readAlbumArtist(file string, i *metadata.Info) {
+  var artist, compilation string
+
+  switch strings.ToLower(filepath.Ext(file)) {
+  case ".mp3":
+    t, err := id3.ReadFile(file)
+    if err != nil {
+      return
+    }
+    artist, compilation = t.Text("TPE2"), t.Text("TCMP")
+  case ".flac":
+    blocks, err := flac.ReadFile(file)
+    if err != nil {
+      return
+    }
+    c := flac.Comments(blocks)
+    artist, compilation = c["ALBUMARTIST"], c["COMPILATION"]
+    if len(artist) == 0 {
+      artist = c["ALBUM ARTIST"]
+    }
+  }
+
+  i.AlbumArtist, i.Compilation = artist, compilation == "1"
+}
+
+// tags of source keyed as stored (ID3 frame id or TXXX description, vorbis
+// comment name), otherwise as reported by ffprobe
+func sourceTags(file string, d *ffprobe.Data) map[string]string {
+  switch strings.ToLower(filepath.Ext(file)) {
+  case ".mp3":
+    if t, err := id3.ReadFile(file); err == nil {
+      return t.Texts()
+    }
+  case ".flac":
+    if blocks, err := flac.ReadFile(file); err == nil {
+      return flac.Comments(blocks)
+    }
+  }
+
+  tags := map[string]string{}
+  if d != nil && d.Format != nil && d.Format.Tags != nil {
+    tags["GENRE"], tags["COMMENT"] = d.Format.Tags.Genre, d.Format.Tags.Comment
+  }
+  return tags
+}
+
+// tags to write keyed by vorbis comment name: source tags preserved &
+// renamed by --tag-rules, info tags, then per artist values. when tags are
+// updated in place, values already within source are skipped
+func (a *audioc) mapTags(source map[string]string, i *metadata.Info,
+  inPlace bool) map[string]string {
+
+  rules := a.TagRules
+  if rules == nil {
+    rules = tagmap.NewRules()
+  }
+  tags := rules.Apply([]string{ i.ToArtist(), i.Artist }, source,
+    i.ExtraTags())
+
+  if inPlace {
+    // sorted so aliases of a name (ie "TCON" & "GENRE") resolve consistently
+    keys := make([]string, 0, len(source))
+    for k := range source {
+      keys = append(keys, k)
+    }
+    sort.Strings(keys)
+
+    existing := map[string]string{}
+    for _, k := range keys {
+      if _, ok := existing[tagmap.Name(k)]; !ok {
+        existing[tagmap.Name(k)] = source[k]
+      }
+    }
+    for k, v := range tags {
+      if e, ok := existing[k]; ok && e == v || !ok && len(v) == 0 {
+        delete(tags, k)
+      }
+    }
+  }
+
+  return tags
+}
@@ -1,9 +1,53 @@
 package audioc
 
 import (
+  "sync"
+  "path/filepath"
+
+  "github.com/jamlib/libaudio/ffprobe"
   "github.com/jamlib/audioc/metadata"
 )
 
+// probe each audio file within bundle in separate cpu thread, keeping data by
+// index so processArtists, processLookup & processFile probe each file once.
+// files failing to probe are left for processFile to report
+func (a *audioc) probeThreaded(indexes []int) {
+  a.Probes = make(map[int]*ffprobe.Data, len(indexes))
+  jobs := make(chan int)
+  var mutex sync.Mutex
+  var wg sync.WaitGroup
+
+  for i := 0; i < a.Workers; i++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      for job := range jobs {
+        d, err := a.Ffprobe.GetData(filepath.Join(a.Config.Dir, a.Files[job]))
+        if err != nil {
+          continue
+        }
+        mutex.Lock()
+        a.Probes[job] = d
+        mutex.Unlock()
+      }
+    }()
+  }
+
+  for x := range indexes {
+    jobs <- indexes[x]
+  }
+  close(jobs)
+  wg.Wait()
+}
+
+// probe data of file at index; from probeThreaded when available
+func (a *audioc) probe(index int) (*ffprobe.Data, error) {
+  if d, ok := a.Probes[index]; ok {
+    return d, nil
+  }
+  return a.Ffprobe.GetData(filepath.Join(a.Config.Dir, a.Files[index]))
+}
+
 // process each audio file within bundle in separate cpu thread
 func (a *audioc) processThreaded(indexes []int) ([]*metadata.Metadata, error) {
   var err error
@@ -0,0 +1,174 @@
+package audioc
+
+import (
+  "os"
+  "fmt"
+  "regexp"
+  "strconv"
+  "strings"
+  "path/filepath"
+
+  "github.com/jamlib/audioc/flac"
+)
+
+// peak level (dBFS) at or below which a track is considered silent
+const silenceThreshold = -60.0
+
+// fully decode each audio file within path reporting any failures
+func (a *audioc) Verify() error {
+  // ensure path is is valid directory
+  fi, err := os.Stat(a.Config.Dir)
+  if err != nil || !fi.IsDir() {
+    return fmt.Errorf("Invalid directory: %s", a.Config.Dir)
+  }
+
+  a.Files, err = a.audioFiles()
+  if err != nil {
+    return err
+  }
+
+  failed := 0
+  for x := range a.Files {
+    fp := filepath.Join(a.Config.Dir, a.Files[x])
+
+    errs, notes := a.verifyFile(fp)
+    if len(errs) == 0 {
+      fmt.Printf("OK: %v\n", fp)
+      for _, n := range notes {
+        fmt.Printf("  * %v\n", n)
+      }
+      continue
+    }
+
+    failed++
+    fmt.Printf("FAILED: %v\n", fp)
+    for _, e := range errs {
+      fmt.Printf("  * %v\n", e)
+    }
+  }
+
+  fmt.Printf("\n%d of %d files failed verification.\n", failed, len(a.Files))
+  fmt.Printf("\naudioc finished.\n")
+  return nil
+}
+
+// decode file through ffmpeg returning any problems found: decode errors,
+// zero-length or silent audio & FLAC MD5 mismatch; notes are checks skipped
+func (a *audioc) verifyFile(file string) ([]string, []string) {
+  errs, notes := []string{}, []string{}
+
+  fi, err := os.Stat(file)
+  if err != nil {
+    return append(errs, err.Error()), notes
+  }
+  if fi.Size() == 0 {
+    return append(errs, "file is empty"), notes
+  }
+
+  d, err := a.Ffprobe.GetData(file)
+  if err != nil {
+    return append(errs, "probe failed: " + err.Error()), notes
+  }
+  if d.Format != nil && d.Format.Duration == 0 && len(d.Streams) > 0 {
+    errs = append(errs, "zero length")
+  }
+
+  // decode entire file, exiting on first error, while measuring peak
+  out, err := a.Ffmpeg.Exec([]string{ "-v", "error", "-xerror", "-i", file,
+    "-map", "0:a", "-af", "astats=metadata=1:reset=0,ametadata=mode=print:" +
+    "key=lavfi.astats.Overall.Peak_level:file=-", "-f", "null", "-" }...)
+  if err != nil {
+    return append(errs, "decode error: " + strings.TrimSpace(err.Error())), notes
+  }
+  if peak, ok := parsePeakLevel(out); ok && peak <= silenceThreshold {
+    errs = append(errs, fmt.Sprintf("silent (peak %.1f dBFS)", peak))
+  }
+
+  if strings.ToLower(filepath.Ext(file)) == ".flac" {
+    e, n := a.verifyFlacMD5(file)
+    if len(e) > 0 {
+      errs = append(errs, e)
+    }
+    if len(n) > 0 {
+      notes = append(notes, n)
+    }
+  }
+
+  return errs, notes
+}
+
+// compare STREAMINFO MD5 to MD5 of decoded audio; returns problem found, or
+// note if comparison is skipped
+func (a *audioc) verifyFlacMD5(file string) (string, string) {
+  blocks, err := flac.ReadFile(file)
+  if err != nil {
+    return "invalid FLAC: " + err.Error(), ""
+  }
+  info, err := flac.ReadInfo(blocks)
+  if err != nil {
+    return "invalid FLAC: " + err.Error(), ""
+  }
+  // total samples of 0 is unknown (ie streamed encodes), not zero length;
+  // empty audio is caught by the decode & silence checks
+  if len(info.MD5) == 0 {
+    return "", ""
+  }
+  // ffmpeg decodes bit depths other than whole bytes (ie 20-bit) as samples
+  // shifted left into the next, so its MD5 never matches STREAMINFO's
+  if info.BitsPerSample % 8 != 0 {
+    return "", fmt.Sprintf("MD5 not checked (%d-bit)", info.BitsPerSample)
+  }
+
+  // FLAC MD5 is of signed little-endian samples at original bit depth
+  out, err := a.Ffmpeg.Exec([]string{ "-v", "error", "-i", file, "-map", "0:a",
+    "-c:a", pcmCodec(info.BitsPerSample), "-f", "md5", "-" }...)
+  if err != nil {
+    return "decode error: " + strings.TrimSpace(err.Error()), ""
+  }
+
+  m := regexp.MustCompile(`MD5=([0-9a-f]{32})`).FindStringSubmatch(out)
+  if len(m) > 1 && m[1] != info.MD5 {
+    return fmt.Sprintf("MD5 mismatch: decoded %s, expected %s", m[1],
+      info.MD5), ""
+  }
+  return "", ""
+}
+
+// signed little-endian PCM codec of bit depth (rounded up to whole bytes;
+// samples of other bit depths are shifted, see verifyFlacMD5)
+func pcmCodec(bits int) string {
+  bytesPerSample := (bits + 7) / 8
+  if bytesPerSample == 1 {
+    return "pcm_s8"
+  }
+  return fmt.Sprintf("pcm_s%dle", bytesPerSample * 8)
+}
+
+// bit depth of FLAC file from STREAMINFO; 16 for other files
+func sourceBits(file string) int {
+  if strings.ToLower(filepath.Ext(file)) != ".flac" {
+    return 16
+  }
+  blocks, err := flac.ReadFile(file)
+  if err != nil {
+    return 16
+  }
+  info, err := flac.ReadInfo(blocks)
+  if err != nil || info.BitsPerSample == 0 {
+    return 16
+  }
+  return info.BitsPerSample
+}
+
+// last overall peak level printed by ametadata
+func parsePeakLevel(out string) (float64, bool) {
+  m := regexp.MustCompile(`lavfi\.astats\.Overall\.Peak_level=(-?[\d.]+|-?inf)`).FindAllStringSubmatch(out, -1)
+  if len(m) == 0 {
+    return 0, false
+  }
+  v, err := strconv.ParseFloat(m[len(m)-1][1], 64)
+  if err != nil {
+    return 0, false
+  }
+  return v, true
+}